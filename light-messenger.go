@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
+	"github.com/usb-radiology/light-messenger/src/authentication"
 	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/deviceclient"
+	"github.com/usb-radiology/light-messenger/src/export"
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 	"github.com/usb-radiology/light-messenger/src/server"
 	"github.com/usb-radiology/light-messenger/src/version"
@@ -35,13 +42,139 @@ func main() {
 			},
 		},
 		{
-			Name:  "db-exec",
-			Usage: "execute db script",
+			Name:  "migrate",
+			Usage: "manage the database schema",
+			Subcommands: []cli.Command{
+				{
+					Name:  "up",
+					Usage: "apply all pending migrations",
+					Action: func(c *cli.Context) error {
+						return actionMigrateUp(initConfig)
+					},
+				},
+				{
+					Name:  "down",
+					Usage: "revert applied migrations, the most recent first",
+					Action: func(c *cli.Context) error {
+						return actionMigrateDown(initConfig, c)
+					},
+					Flags: []cli.Flag{
+						cli.IntFlag{Name: "steps", Value: 1, Usage: "number of migrations to revert"},
+						cli.BoolFlag{Name: "all", Usage: "revert all applied migrations"},
+					},
+				},
+				{
+					Name:  "status",
+					Usage: "list applied and pending migrations",
+					Action: func(c *cli.Context) error {
+						return actionMigrateStatus(initConfig)
+					},
+				},
+			},
+		},
+		{
+			Name:  "export",
+			Usage: "export the notifications created in a period as csv or xlsx",
 			Action: func(c *cli.Context) error {
-				return actionDbExec(initConfig, c)
+				return actionExport(initConfig, c)
 			},
 			Flags: []cli.Flag{
-				cli.StringFlag{Name: "script-path"},
+				cli.StringFlag{Name: "format", Value: export.FormatCSV, Usage: "csv or xlsx"},
+				cli.StringFlag{Name: "from", Usage: "first day, yyyy-mm-dd, defaults to 30 days ago"},
+				cli.StringFlag{Name: "to", Usage: "last day, yyyy-mm-dd, defaults to today"},
+				cli.StringFlag{Name: "department", Usage: "only export notifications of the department"},
+				cli.StringFlag{Name: "modality", Usage: "only export notifications of the modality"},
+				cli.StringFlag{Name: "output", Usage: "file to write to instead of stdout"},
+			},
+		},
+		{
+			Name:  "user",
+			Usage: "manage the users that log in, passwords are read from stdin",
+			Subcommands: []cli.Command{
+				{
+					Name:  "add",
+					Usage: "add a user",
+					Action: func(c *cli.Context) error {
+						return actionUserAdd(initConfig, c)
+					},
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "username", Usage: "name to log in with"},
+						cli.StringFlag{Name: "role", Usage: "mtra, radiologist or admin"},
+						cli.StringFlag{Name: "modality", Usage: "modality of an mtra"},
+						cli.StringFlag{Name: "department", Usage: "department of a radiologist"},
+					},
+				},
+				{
+					Name:      "password",
+					Usage:     "change the password of a user",
+					ArgsUsage: "<username>",
+					Action: func(c *cli.Context) error {
+						return actionUserPassword(initConfig, c)
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "remove a user",
+					ArgsUsage: "<username>",
+					Action: func(c *cli.Context) error {
+						return actionUserRemove(initConfig, c)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "list all users",
+					Action: func(c *cli.Context) error {
+						return actionUserList(initConfig)
+					},
+				},
+			},
+		},
+		{
+			Name:  "device",
+			Usage: "manage the tokens of the lights",
+			Subcommands: []cli.Command{
+				{
+					Name:  "add",
+					Usage: "create the token of a light and print it, with --signed the secret it signs its requests with as well",
+					Action: func(c *cli.Context) error {
+						return actionDeviceAdd(initConfig, c)
+					},
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "device", Usage: "identifier of the light, defaults to the department"},
+						cli.StringFlag{Name: "department", Usage: "department of the light"},
+						cli.BoolFlag{Name: "signed", Usage: "create a secret to sign the requests of the light"},
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "revoke the token of a light",
+					ArgsUsage: "<device>",
+					Action: func(c *cli.Context) error {
+						return actionDeviceRemove(initConfig, c)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "list the lights with a token",
+					Action: func(c *cli.Context) error {
+						return actionDeviceList(initConfig, c)
+					},
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "department", Usage: "only list the lights of the department"},
+					},
+				},
+				{
+					Name:  "check",
+					Usage: "send a signed heartbeat as a light would, the secret is read from stdin",
+					Action: func(c *cli.Context) error {
+						return actionDeviceCheck(c)
+					},
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "url", Value: "http://localhost:8080", Usage: "of the server"},
+						cli.StringFlag{Name: "device", Usage: "identifier of the light, defaults to the department"},
+						cli.StringFlag{Name: "department", Usage: "department of the light"},
+					},
+				},
 			},
 		},
 	}
@@ -61,38 +194,393 @@ func actionWeb(initConfig *configuration.Configuration) error {
 	return nil
 }
 
-func actionDbExec(initConfig *configuration.Configuration, c *cli.Context) error {
-	db, errDb := lmdatabase.GetDB(initConfig)
-	if errDb != nil {
-		return errDb
+func actionMigrateUp(initConfig *configuration.Configuration) error {
+	db, migrations, errInit := initMigrate(initConfig)
+	if errInit != nil {
+		return errInit
+	}
+	defer db.Close()
+
+	applied, errMigrateUp := lmdatabase.MigrateUp(db, migrations, time.Now().Unix())
+	for _, migration := range applied {
+		log.Printf("applied %04d_%s", migration.Version, migration.Name)
 	}
+	if errMigrateUp != nil {
+		return errMigrateUp
+	}
+
+	log.Printf("%d migrations applied", len(applied))
+	return nil
+}
 
-	scriptPath := c.String("script-path")
+func actionMigrateDown(initConfig *configuration.Configuration, c *cli.Context) error {
+	db, migrations, errInit := initMigrate(initConfig)
+	if errInit != nil {
+		return errInit
+	}
+	defer db.Close()
 
-	statements, errReadStatements := lmdatabase.ReadStatementsFromSQL(scriptPath)
-	if errReadStatements != nil {
-		return errReadStatements
+	steps := c.Int("steps")
+	if c.Bool("all") {
+		steps = -1
 	}
 
-	for _, statement := range *statements {
-		log.Printf("%s", statement)
+	reverted, errMigrateDown := lmdatabase.MigrateDown(db, migrations, steps)
+	for _, migration := range reverted {
+		log.Printf("reverted %04d_%s", migration.Version, migration.Name)
+	}
+	if errMigrateDown != nil {
+		return errMigrateDown
+	}
 
-		execStatementResult, errExecStatement := lmdatabase.ExecStatement(db, statement)
-		if errExecStatement != nil {
-			return errExecStatement
+	log.Printf("%d migrations reverted", len(reverted))
+	return nil
+}
+
+func actionMigrateStatus(initConfig *configuration.Configuration) error {
+	db, migrations, errInit := initMigrate(initConfig)
+	if errInit != nil {
+		return errInit
+	}
+	defer db.Close()
+
+	statuses, errMigrateStatus := lmdatabase.MigrateStatus(db, migrations)
+	if errMigrateStatus != nil {
+		return errMigrateStatus
+	}
+
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != -1 {
+			appliedAt = "applied " + time.Unix(status.AppliedAt, 0).Format("2006-01-02 15:04:05")
 		}
+		fmt.Printf("%04d_%-40s %s\n", status.Migration.Version, status.Migration.Name, appliedAt)
+	}
+
+	return nil
+}
+
+func actionExport(initConfig *configuration.Configuration, c *cli.Context) error {
+	format := c.String("format")
+	if _, knownFormat := export.ContentTypes[format]; !knownFormat {
+		return errors.Errorf("unknown export format %s", format)
+	}
+
+	from, to, errParsePeriod := export.ParsePeriod(c.String("from"), c.String("to"), time.Now(), 30)
+	if errParsePeriod != nil {
+		return errParsePeriod
+	}
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	notifications, errNotificationGetByCreatedAt := store.NotificationGetByCreatedAt(from.Unix(), to.Unix())
+	if errNotificationGetByCreatedAt != nil {
+		return errNotificationGetByCreatedAt
+	}
+
+	filtered := export.Filter(*notifications, c.String("department"), c.String("modality"))
+
+	output := os.Stdout
+	if c.String("output") != "" {
+		file, errCreate := os.Create(c.String("output"))
+		if errCreate != nil {
+			return errors.WithStack(errCreate)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	errWrite := export.Write(output, format, filtered, time.Local)
+	if errWrite != nil {
+		return errWrite
+	}
+
+	log.Printf("%d notifications exported", len(filtered))
+	return nil
+}
+
+func actionUserAdd(initConfig *configuration.Configuration, c *cli.Context) error {
+	user := lmdatabase.User{
+		Username:     c.String("username"),
+		Role:         c.String("role"),
+		Modality:     c.String("modality"),
+		DepartmentID: c.String("department"),
+		CreatedAt:    time.Now().Unix(),
+	}
+	if reason := authentication.Validate(user); reason != "" {
+		return errors.New(reason)
+	}
+
+	passwordHash, errPassword := readPasswordHash()
+	if errPassword != nil {
+		return errPassword
+	}
+	user.PasswordHash = passwordHash
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	errInsert := store.UserInsert(user)
+	if errInsert != nil {
+		return errInsert
+	}
+
+	log.Printf("added %s %s", user.Role, user.Username)
+	return nil
+}
+
+func actionUserPassword(initConfig *configuration.Configuration, c *cli.Context) error {
+	username := c.Args().First()
+	if username == "" {
+		return errors.New("the username is empty")
+	}
+
+	passwordHash, errPassword := readPasswordHash()
+	if errPassword != nil {
+		return errPassword
+	}
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	rowsAffected, errUpdate := store.UserUpdatePassword(username, passwordHash)
+	if errUpdate != nil {
+		return errUpdate
+	}
+	if rowsAffected == 0 {
+		return errors.Errorf("unknown user %s", username)
+	}
+
+	log.Printf("changed the password of %s", username)
+	return nil
+}
+
+func actionUserRemove(initConfig *configuration.Configuration, c *cli.Context) error {
+	username := c.Args().First()
+	if username == "" {
+		return errors.New("the username is empty")
+	}
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	rowsAffected, errDelete := store.UserDelete(username)
+	if errDelete != nil {
+		return errDelete
+	}
+	if rowsAffected == 0 {
+		return errors.Errorf("unknown user %s", username)
+	}
+
+	log.Printf("removed %s", username)
+	return nil
+}
+
+func actionUserList(initConfig *configuration.Configuration) error {
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	users, errUsers := store.UserGetAll()
+	if errUsers != nil {
+		return errUsers
+	}
+
+	for _, user := range *users {
+		fmt.Printf("%-24s %-12s %-12s %s\n", user.Username, user.Role, user.Modality, user.DepartmentID)
+	}
+
+	return nil
+}
+
+func actionDeviceAdd(initConfig *configuration.Configuration, c *cli.Context) error {
+	department := c.String("department")
+	if department == "" {
+		return errors.New("the department is empty")
+	}
+
+	deviceID := c.String("device")
+	if deviceID == "" {
+		deviceID = department
+	}
+
+	token, tokenHash, errToken := authentication.NewDeviceToken()
+	if errToken != nil {
+		return errToken
+	}
 
-		if execStatementResult == nil {
-			continue
+	var secret string
+	if c.Bool("signed") {
+		var errSecret error
+		secret, errSecret = authentication.NewDeviceSecret()
+		if errSecret != nil {
+			return errSecret
 		}
+	}
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	errInsert := store.DeviceTokenInsert(lmdatabase.DeviceToken{
+		DeviceID:     deviceID,
+		DepartmentID: department,
+		TokenHash:    tokenHash,
+		Secret:       secret,
+		CreatedAt:    time.Now().Unix(),
+	})
+	if errInsert != nil {
+		return errInsert
+	}
+
+	if secret != "" {
+		log.Printf("added the secret of %s in %s", deviceID, department)
+		fmt.Println(secret)
+		return nil
+	}
+
+	log.Printf("added the token of %s in %s, it is shown only once", deviceID, department)
+	fmt.Println(token)
+	return nil
+}
 
-		rowsAffected, errRowsAffected := execStatementResult.RowsAffected()
-		if errRowsAffected != nil {
-			return errRowsAffected
+func actionDeviceRemove(initConfig *configuration.Configuration, c *cli.Context) error {
+	deviceID := c.Args().First()
+	if deviceID == "" {
+		return errors.New("the device is empty")
+	}
+
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	rowsAffected, errDelete := store.DeviceTokenDelete(deviceID)
+	if errDelete != nil {
+		return errDelete
+	}
+	if rowsAffected == 0 {
+		return errors.Errorf("the device %s has no token", deviceID)
+	}
+
+	log.Printf("removed the token of %s", deviceID)
+	return nil
+}
+
+func actionDeviceList(initConfig *configuration.Configuration, c *cli.Context) error {
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		return errStore
+	}
+	defer store.Close()
+
+	tokens, errTokens := store.DeviceTokenGetByDepartment(c.String("department"))
+	if errTokens != nil {
+		return errTokens
+	}
+
+	for _, token := range *tokens {
+		scheme := "token"
+		if token.Secret != "" {
+			scheme = "signed"
 		}
+		fmt.Printf("%-32s %-12s %-8s created %s\n", token.DeviceID, token.DepartmentID, scheme, time.Unix(token.CreatedAt, 0).Format("2006-01-02 15:04:05"))
+	}
 
-		log.Printf("rowsAffected %d", rowsAffected)
+	return nil
+}
+
+func actionDeviceCheck(c *cli.Context) error {
+	department := c.String("department")
+	if department == "" {
+		return errors.New("the department is empty")
 	}
 
+	deviceID := c.String("device")
+	if deviceID == "" {
+		deviceID = department
+	}
+
+	secret, errSecret := readLine("secret")
+	if errSecret != nil {
+		return errSecret
+	}
+
+	client := deviceclient.Client{URL: strings.TrimRight(c.String("url"), "/"), Department: department, Device: deviceID, Secret: secret}
+
+	if errStatus := client.Status("", ""); errStatus != nil {
+		return errStatus
+	}
+
+	open, errOpen := client.OpenNotifications()
+	if errOpen != nil {
+		return errOpen
+	}
+
+	log.Printf("the server accepted the signed requests of %s in %s", deviceID, department)
+	fmt.Println(open)
 	return nil
 }
+
+// readPasswordHash reads the password from the first line of stdin and hashes it
+func readPasswordHash() (string, error) {
+	password, errRead := readLine("password")
+	if errRead != nil {
+		return "", errRead
+	}
+
+	return authentication.HashPassword(password)
+}
+
+// readLine prompts for the value on stderr and reads it from the first line of stdin
+func readLine(name string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", name)
+
+	line, errRead := bufio.NewReader(os.Stdin).ReadString('\n')
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		if errRead != nil {
+			return "", errors.WithStack(errRead)
+		}
+		return "", errors.Errorf("the %s is empty", name)
+	}
+
+	return value, nil
+}
+
+func initMigrate(initConfig *configuration.Configuration) (*lmdatabase.DB, []lmdatabase.Migration, error) {
+	driver := lmdatabase.GetDriver(initConfig)
+	if driver == lmdatabase.DriverMemory {
+		return nil, nil, errors.New("the memory database driver has no schema to migrate")
+	}
+
+	migrations, errLoad := lmdatabase.MigrationsLoad(driver)
+	if errLoad != nil {
+		return nil, nil, errLoad
+	}
+
+	db, errDb := lmdatabase.GetDB(initConfig)
+	if errDb != nil {
+		return nil, nil, errDb
+	}
+
+	return db, migrations, nil
+}
@@ -1,2 +1,7 @@
-DELETE FROM `ArduinoStatus`;
-DELETE FROM `Notification`;
+DELETE FROM ArduinoStatus;
+DELETE FROM Notification;
+DELETE FROM NotificationEvent;
+DELETE FROM Device;
+DELETE FROM DeviceUptime;
+DELETE FROM UserAccount;
+DELETE FROM DeviceToken;
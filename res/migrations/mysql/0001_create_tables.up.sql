@@ -1,10 +1,10 @@
-CREATE TABLE `ArduinoStatus` (
+CREATE TABLE IF NOT EXISTS `ArduinoStatus` (
   `departmentId` varchar(255) NOT NULL,
   `statusAt` bigint NOT NULL,
   PRIMARY KEY (`departmentId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 
-CREATE TABLE `Notification` (
+CREATE TABLE IF NOT EXISTS `Notification` (
   `notificationId` varchar(255) NOT NULL,
   `modality` varchar(255) NOT NULL,
   `departmentId` varchar(255) NOT NULL,
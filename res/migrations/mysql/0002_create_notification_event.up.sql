@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `NotificationEvent` (
+  `eventId` varchar(255) NOT NULL,
+  `notificationId` varchar(255) NOT NULL,
+  `eventType` varchar(32) NOT NULL,
+  `createdAt` bigint NOT NULL,
+  `previousValue` varchar(255) NOT NULL DEFAULT '',
+  `newValue` varchar(255) NOT NULL DEFAULT '',
+  `clientAddress` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`eventId`),
+  KEY `NotificationEvent_notificationId` (`notificationId`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,3 @@
+ALTER TABLE `Notification` DROP INDEX `Notification_open`;
+
+ALTER TABLE `Notification` DROP COLUMN `isOpen`;
@@ -0,0 +1,15 @@
+-- isOpen is 1 while a notification is neither confirmed nor cancelled and NULL afterwards, the unique key ignores
+-- NULL values and thereby allows at most one open notification per department and modality
+ALTER TABLE `Notification` ADD COLUMN `isOpen` tinyint NULL DEFAULT 1;
+
+-- cancel all but the oldest open notification of a department and modality, earlier versions could create duplicates
+UPDATE `Notification` n
+JOIN `Notification` o ON o.`departmentId` = n.`departmentId` AND o.`modality` = n.`modality`
+  AND o.`confirmedAt` = -1 AND o.`cancelledAt` = -1
+  AND (o.`createdAt` < n.`createdAt` OR (o.`createdAt` = n.`createdAt` AND o.`notificationId` < n.`notificationId`))
+SET n.`cancelledAt` = UNIX_TIMESTAMP()
+WHERE n.`confirmedAt` = -1 AND n.`cancelledAt` = -1;
+
+UPDATE `Notification` SET `isOpen` = NULL WHERE `confirmedAt` <> -1 OR `cancelledAt` <> -1;
+
+ALTER TABLE `Notification` ADD UNIQUE KEY `Notification_open` (`departmentId`, `modality`, `isOpen`);
@@ -0,0 +1,4 @@
+ALTER TABLE `Notification`
+  DROP COLUMN `message`,
+  DROP COLUMN `room`,
+  DROP COLUMN `accessionNumber`;
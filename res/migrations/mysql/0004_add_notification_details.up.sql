@@ -0,0 +1,4 @@
+ALTER TABLE `Notification`
+  ADD COLUMN `message` varchar(1024) NOT NULL DEFAULT '',
+  ADD COLUMN `room` varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN `accessionNumber` varchar(64) NOT NULL DEFAULT '';
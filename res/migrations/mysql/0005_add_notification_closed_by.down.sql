@@ -0,0 +1,3 @@
+ALTER TABLE `Notification`
+  DROP COLUMN `confirmedBy`,
+  DROP COLUMN `cancelledBy`;
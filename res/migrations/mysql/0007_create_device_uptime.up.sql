@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `DeviceUptime` (
+  `deviceId` varchar(255) NOT NULL,
+  `departmentId` varchar(255) NOT NULL,
+  `startedAt` bigint NOT NULL,
+  `endedAt` bigint NOT NULL,
+  PRIMARY KEY (`deviceId`, `startedAt`),
+  KEY `DeviceUptime_departmentId` (`departmentId`, `endedAt`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
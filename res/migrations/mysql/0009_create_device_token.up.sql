@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `DeviceToken` (
+  `deviceId` varchar(255) NOT NULL,
+  `departmentId` varchar(255) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `createdAt` bigint NOT NULL,
+  PRIMARY KEY (`deviceId`),
+  UNIQUE KEY `DeviceToken_tokenHash` (`tokenHash`),
+  KEY `DeviceToken_departmentId` (`departmentId`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+ALTER TABLE `Device`
+  ADD COLUMN `unauthenticated` tinyint(1) NOT NULL DEFAULT 0;
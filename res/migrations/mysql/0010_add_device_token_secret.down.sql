@@ -0,0 +1,2 @@
+ALTER TABLE `DeviceToken`
+  DROP COLUMN `secret`;
@@ -0,0 +1,2 @@
+ALTER TABLE `DeviceToken`
+  ADD COLUMN `secret` varchar(64) NOT NULL DEFAULT '';
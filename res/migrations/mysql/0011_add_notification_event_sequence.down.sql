@@ -0,0 +1,31 @@
+CREATE TABLE `NotificationEvent_previous` (
+  `eventId` varchar(255) NOT NULL,
+  `notificationId` varchar(255) NOT NULL,
+  `eventType` varchar(32) NOT NULL,
+  `createdAt` bigint NOT NULL,
+  `previousValue` varchar(255) NOT NULL DEFAULT '',
+  `newValue` varchar(255) NOT NULL DEFAULT '',
+  `clientAddress` varchar(255) NOT NULL DEFAULT ''
+);
+
+INSERT INTO `NotificationEvent_previous` (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM `NotificationEvent`;
+
+DROP TABLE `NotificationEvent`;
+
+CREATE TABLE `NotificationEvent` (
+  `eventId` varchar(255) NOT NULL,
+  `notificationId` varchar(255) NOT NULL,
+  `eventType` varchar(32) NOT NULL,
+  `createdAt` bigint NOT NULL,
+  `previousValue` varchar(255) NOT NULL DEFAULT '',
+  `newValue` varchar(255) NOT NULL DEFAULT '',
+  `clientAddress` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`eventId`),
+  KEY `NotificationEvent_notificationId` (`notificationId`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+INSERT INTO `NotificationEvent` (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM `NotificationEvent_previous`;
+
+DROP TABLE `NotificationEvent_previous`;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ArduinoStatus;
+DROP TABLE IF EXISTS Notification;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS NotificationEvent (
+  eventId varchar(255) NOT NULL,
+  notificationId varchar(255) NOT NULL,
+  eventType varchar(32) NOT NULL,
+  createdAt bigint NOT NULL,
+  previousValue varchar(255) NOT NULL DEFAULT '',
+  newValue varchar(255) NOT NULL DEFAULT '',
+  clientAddress varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (eventId)
+);
+
+CREATE INDEX IF NOT EXISTS NotificationEvent_notificationId ON NotificationEvent (notificationId);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS Notification_open;
+
+ALTER TABLE Notification DROP COLUMN IF EXISTS isOpen;
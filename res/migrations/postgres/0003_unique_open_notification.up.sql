@@ -0,0 +1,16 @@
+-- isOpen is 1 while a notification is neither confirmed nor cancelled and NULL afterwards, the unique index ignores
+-- NULL values and thereby allows at most one open notification per department and modality
+ALTER TABLE Notification ADD COLUMN IF NOT EXISTS isOpen smallint NULL DEFAULT 1;
+
+-- cancel all but the oldest open notification of a department and modality, earlier versions could create duplicates
+UPDATE Notification SET cancelledAt = CAST(extract(epoch FROM now()) AS bigint)
+WHERE confirmedAt = -1 AND cancelledAt = -1 AND EXISTS (
+  SELECT 1 FROM Notification o
+  WHERE o.departmentId = Notification.departmentId AND o.modality = Notification.modality
+    AND o.confirmedAt = -1 AND o.cancelledAt = -1
+    AND (o.createdAt < Notification.createdAt OR (o.createdAt = Notification.createdAt AND o.notificationId < Notification.notificationId))
+);
+
+UPDATE Notification SET isOpen = NULL WHERE confirmedAt <> -1 OR cancelledAt <> -1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS Notification_open ON Notification (departmentId, modality, isOpen);
@@ -0,0 +1,4 @@
+ALTER TABLE Notification
+  DROP COLUMN IF EXISTS message,
+  DROP COLUMN IF EXISTS room,
+  DROP COLUMN IF EXISTS accessionNumber;
@@ -0,0 +1,4 @@
+ALTER TABLE Notification
+  ADD COLUMN IF NOT EXISTS message varchar(1024) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS room varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS accessionNumber varchar(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE Notification
+  DROP COLUMN IF EXISTS confirmedBy,
+  DROP COLUMN IF EXISTS cancelledBy;
@@ -0,0 +1,3 @@
+ALTER TABLE Notification
+  ADD COLUMN IF NOT EXISTS confirmedBy varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS cancelledBy varchar(255) NOT NULL DEFAULT '';
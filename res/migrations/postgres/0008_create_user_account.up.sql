@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS UserAccount (
+  username varchar(255) NOT NULL,
+  passwordHash varchar(255) NOT NULL,
+  role varchar(32) NOT NULL,
+  modality varchar(255) NOT NULL DEFAULT '',
+  departmentId varchar(255) NOT NULL DEFAULT '',
+  createdAt bigint NOT NULL,
+  PRIMARY KEY (username)
+);
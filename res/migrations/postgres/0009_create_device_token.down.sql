@@ -0,0 +1,4 @@
+ALTER TABLE Device
+  DROP COLUMN IF EXISTS unauthenticated;
+
+DROP TABLE IF EXISTS DeviceToken;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS DeviceToken (
+  deviceId varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  tokenHash char(64) NOT NULL,
+  createdAt bigint NOT NULL,
+  PRIMARY KEY (deviceId)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS DeviceToken_tokenHash ON DeviceToken (tokenHash);
+
+CREATE INDEX IF NOT EXISTS DeviceToken_departmentId ON DeviceToken (departmentId);
+
+ALTER TABLE Device
+  ADD COLUMN IF NOT EXISTS unauthenticated smallint NOT NULL DEFAULT 0;
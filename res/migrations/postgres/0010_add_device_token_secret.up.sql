@@ -0,0 +1,2 @@
+ALTER TABLE DeviceToken
+  ADD COLUMN IF NOT EXISTS secret varchar(64) NOT NULL DEFAULT '';
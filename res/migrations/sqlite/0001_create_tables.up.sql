@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS ArduinoStatus (
+  departmentId varchar(255) NOT NULL,
+  statusAt bigint NOT NULL,
+  PRIMARY KEY (departmentId)
+);
+
+CREATE TABLE IF NOT EXISTS Notification (
+  notificationId varchar(255) NOT NULL,
+  modality varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  priority integer NOT NULL,
+  createdAt bigint NOT NULL,
+  confirmedAt bigint NOT NULL DEFAULT -1,
+  cancelledAt bigint NOT NULL DEFAULT -1,
+  PRIMARY KEY (notificationId)
+);
@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS Notification_open;
+
+-- the bundled sqlite version does not support dropping columns, rebuild the table instead
+CREATE TABLE Notification_down (
+  notificationId varchar(255) NOT NULL,
+  modality varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  priority integer NOT NULL,
+  createdAt bigint NOT NULL,
+  confirmedAt bigint NOT NULL DEFAULT -1,
+  cancelledAt bigint NOT NULL DEFAULT -1,
+  PRIMARY KEY (notificationId)
+);
+
+INSERT INTO Notification_down (notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt)
+SELECT notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt FROM Notification;
+
+DROP TABLE Notification;
+
+ALTER TABLE Notification_down RENAME TO Notification;
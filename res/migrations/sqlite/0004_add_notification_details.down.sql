@@ -0,0 +1,21 @@
+-- the bundled sqlite version does not support dropping columns, rebuild the table instead
+CREATE TABLE Notification_down (
+  notificationId varchar(255) NOT NULL,
+  modality varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  priority integer NOT NULL,
+  createdAt bigint NOT NULL,
+  confirmedAt bigint NOT NULL DEFAULT -1,
+  cancelledAt bigint NOT NULL DEFAULT -1,
+  isOpen integer NULL DEFAULT 1,
+  PRIMARY KEY (notificationId)
+);
+
+INSERT INTO Notification_down (notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, isOpen)
+SELECT notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, isOpen FROM Notification;
+
+DROP TABLE Notification;
+
+ALTER TABLE Notification_down RENAME TO Notification;
+
+CREATE UNIQUE INDEX IF NOT EXISTS Notification_open ON Notification (departmentId, modality, isOpen);
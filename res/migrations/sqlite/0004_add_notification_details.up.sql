@@ -0,0 +1,5 @@
+ALTER TABLE Notification ADD COLUMN message varchar(1024) NOT NULL DEFAULT '';
+
+ALTER TABLE Notification ADD COLUMN room varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE Notification ADD COLUMN accessionNumber varchar(64) NOT NULL DEFAULT '';
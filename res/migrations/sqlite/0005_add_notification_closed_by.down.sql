@@ -0,0 +1,24 @@
+-- the bundled sqlite version does not support dropping columns, rebuild the table instead
+CREATE TABLE Notification_down (
+  notificationId varchar(255) NOT NULL,
+  modality varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  priority integer NOT NULL,
+  createdAt bigint NOT NULL,
+  confirmedAt bigint NOT NULL DEFAULT -1,
+  cancelledAt bigint NOT NULL DEFAULT -1,
+  isOpen integer NULL DEFAULT 1,
+  message varchar(1024) NOT NULL DEFAULT '',
+  room varchar(255) NOT NULL DEFAULT '',
+  accessionNumber varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (notificationId)
+);
+
+INSERT INTO Notification_down (notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, isOpen, message, room, accessionNumber)
+SELECT notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, isOpen, message, room, accessionNumber FROM Notification;
+
+DROP TABLE Notification;
+
+ALTER TABLE Notification_down RENAME TO Notification;
+
+CREATE UNIQUE INDEX IF NOT EXISTS Notification_open ON Notification (departmentId, modality, isOpen);
@@ -0,0 +1,3 @@
+ALTER TABLE Notification ADD COLUMN confirmedBy varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE Notification ADD COLUMN cancelledBy varchar(255) NOT NULL DEFAULT '';
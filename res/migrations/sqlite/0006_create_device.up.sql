@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS Device (
+  deviceId varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  location varchar(255) NOT NULL DEFAULT '',
+  firmwareVersion varchar(64) NOT NULL DEFAULT '',
+  lastSeenAt bigint NOT NULL,
+  remoteAddress varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (deviceId)
+);
+
+CREATE INDEX IF NOT EXISTS Device_departmentId ON Device (departmentId);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS DeviceUptime (
+  deviceId varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  startedAt bigint NOT NULL,
+  endedAt bigint NOT NULL,
+  PRIMARY KEY (deviceId, startedAt)
+);
+
+CREATE INDEX IF NOT EXISTS DeviceUptime_departmentId ON DeviceUptime (departmentId, endedAt);
@@ -0,0 +1,21 @@
+-- the bundled sqlite version does not support dropping columns, rebuild the table instead
+CREATE TABLE Device_down (
+  deviceId varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  location varchar(255) NOT NULL DEFAULT '',
+  firmwareVersion varchar(64) NOT NULL DEFAULT '',
+  lastSeenAt bigint NOT NULL,
+  remoteAddress varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (deviceId)
+);
+
+INSERT INTO Device_down (deviceId, departmentId, location, firmwareVersion, lastSeenAt, remoteAddress)
+SELECT deviceId, departmentId, location, firmwareVersion, lastSeenAt, remoteAddress FROM Device;
+
+DROP TABLE Device;
+
+ALTER TABLE Device_down RENAME TO Device;
+
+CREATE INDEX IF NOT EXISTS Device_departmentId ON Device (departmentId);
+
+DROP TABLE IF EXISTS DeviceToken;
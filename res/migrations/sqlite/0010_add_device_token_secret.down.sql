@@ -0,0 +1,19 @@
+-- the bundled sqlite version does not support dropping columns, rebuild the table instead
+CREATE TABLE DeviceToken_down (
+  deviceId varchar(255) NOT NULL,
+  departmentId varchar(255) NOT NULL,
+  tokenHash char(64) NOT NULL,
+  createdAt bigint NOT NULL,
+  PRIMARY KEY (deviceId)
+);
+
+INSERT INTO DeviceToken_down (deviceId, departmentId, tokenHash, createdAt)
+SELECT deviceId, departmentId, tokenHash, createdAt FROM DeviceToken;
+
+DROP TABLE DeviceToken;
+
+ALTER TABLE DeviceToken_down RENAME TO DeviceToken;
+
+CREATE UNIQUE INDEX IF NOT EXISTS DeviceToken_tokenHash ON DeviceToken (tokenHash);
+
+CREATE INDEX IF NOT EXISTS DeviceToken_departmentId ON DeviceToken (departmentId);
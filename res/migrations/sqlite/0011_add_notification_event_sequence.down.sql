@@ -0,0 +1,32 @@
+CREATE TABLE NotificationEvent_previous (
+  eventId varchar(255) NOT NULL,
+  notificationId varchar(255) NOT NULL,
+  eventType varchar(32) NOT NULL,
+  createdAt bigint NOT NULL,
+  previousValue varchar(255) NOT NULL DEFAULT '',
+  newValue varchar(255) NOT NULL DEFAULT '',
+  clientAddress varchar(255) NOT NULL DEFAULT ''
+);
+
+INSERT INTO NotificationEvent_previous (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM NotificationEvent;
+
+DROP TABLE NotificationEvent;
+
+CREATE TABLE NotificationEvent (
+  eventId varchar(255) NOT NULL,
+  notificationId varchar(255) NOT NULL,
+  eventType varchar(32) NOT NULL,
+  createdAt bigint NOT NULL,
+  previousValue varchar(255) NOT NULL DEFAULT '',
+  newValue varchar(255) NOT NULL DEFAULT '',
+  clientAddress varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (eventId)
+);
+
+INSERT INTO NotificationEvent (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM NotificationEvent_previous;
+
+DROP TABLE NotificationEvent_previous;
+
+CREATE INDEX IF NOT EXISTS NotificationEvent_notificationId ON NotificationEvent (notificationId);
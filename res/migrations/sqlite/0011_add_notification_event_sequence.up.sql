@@ -0,0 +1,35 @@
+-- the sequence orders the events of a notification, also within the same second. The table is rebuilt, recorded
+-- events are numbered in the order they were shown so far.
+CREATE TABLE NotificationEvent_previous (
+  eventId varchar(255) NOT NULL,
+  notificationId varchar(255) NOT NULL,
+  eventType varchar(32) NOT NULL,
+  createdAt bigint NOT NULL,
+  previousValue varchar(255) NOT NULL DEFAULT '',
+  newValue varchar(255) NOT NULL DEFAULT '',
+  clientAddress varchar(255) NOT NULL DEFAULT ''
+);
+
+INSERT INTO NotificationEvent_previous (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM NotificationEvent;
+
+DROP TABLE NotificationEvent;
+
+CREATE TABLE NotificationEvent (
+  sequenceNumber INTEGER PRIMARY KEY AUTOINCREMENT,
+  eventId varchar(255) NOT NULL UNIQUE,
+  notificationId varchar(255) NOT NULL,
+  eventType varchar(32) NOT NULL,
+  createdAt bigint NOT NULL,
+  previousValue varchar(255) NOT NULL DEFAULT '',
+  newValue varchar(255) NOT NULL DEFAULT '',
+  clientAddress varchar(255) NOT NULL DEFAULT ''
+);
+
+INSERT INTO NotificationEvent (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+SELECT eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress FROM NotificationEvent_previous
+ORDER BY createdAt, CASE eventType WHEN 'created' THEN 0 WHEN 'priority' THEN 1 WHEN 'forwarded' THEN 1 ELSE 2 END, eventId;
+
+DROP TABLE NotificationEvent_previous;
+
+CREATE INDEX IF NOT EXISTS NotificationEvent_notificationId ON NotificationEvent (notificationId);
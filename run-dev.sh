@@ -1,2 +1,2 @@
 #!/bin/sh
-ag --go --json --html -l --ignore-dir=ui --ignore=src/server/rice-box.go | entr -r -s "make run"
+ag --go --json --html -l --ignore-dir=ui --ignore=src/server/rice-box.go --ignore=src/lmdatabase/rice-box.go | entr -r -s "make run"
@@ -0,0 +1,311 @@
+// Package authentication logs users in with their password, stored hashed or verified by an LDAP directory, keeps
+// them logged in with a session cookie, trusts the users a reverse proxy authenticated and decides what their role
+// permits
+package authentication
+
+import (
+	"crypto/rand"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionName          = "light-messenger"
+	sessionUsername      = "username"
+	defaultSessionMaxAge = 12 * 60 * 60
+)
+
+// ErrInvalidCredentials is returned for unknown usernames and wrong passwords alike
+var ErrInvalidCredentials = errors.New("unknown username or wrong password")
+
+// dummyHash is compared for unknown usernames, so they take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("light-messenger"), bcrypt.DefaultCost)
+
+// Authenticator logs in the users of the store and, if configured, of an LDAP directory or a reverse proxy
+type Authenticator struct {
+	enabled        bool
+	store          lmdatabase.Store
+	sessions       *sessions.CookieStore
+	directory      *directory
+	proxy          *proxy
+	failedAttempts *failedAttempts
+	verified       *verifiedCredentials
+}
+
+// New returns the authenticator of the configuration
+func New(initConfig *configuration.Configuration, store lmdatabase.Store) (*Authenticator, error) {
+	directory, errDirectory := newDirectory(initConfig)
+	if errDirectory != nil {
+		return nil, errDirectory
+	}
+
+	proxy, errProxy := newProxy(initConfig)
+	if errProxy != nil {
+		return nil, errProxy
+	}
+
+	key := []byte(initConfig.Authentication.SessionKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, errRead := rand.Read(key); errRead != nil {
+			return nil, errors.WithStack(errRead)
+		}
+		if initConfig.Authentication.Enabled {
+			log.Println("Authentication.SessionKey is not configured, users are logged out on restart")
+		}
+	}
+
+	maxAge := initConfig.Authentication.SessionMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSessionMaxAge
+	}
+
+	cookieStore := sessions.NewCookieStore(key)
+	cookieStore.MaxAge(maxAge)
+	cookieStore.Options.HttpOnly = true
+	cookieStore.Options.Secure = initConfig.Authentication.SecureCookie
+	cookieStore.Options.SameSite = http.SameSiteLaxMode
+
+	return &Authenticator{
+		enabled:        initConfig.Authentication.Enabled,
+		store:          store,
+		sessions:       cookieStore,
+		directory:      directory,
+		proxy:          proxy,
+		failedAttempts: newFailedAttempts(),
+		verified:       newVerifiedCredentials(),
+	}, nil
+}
+
+// Enabled reports whether users must log in
+func (authenticator *Authenticator) Enabled() bool {
+	return authenticator.enabled
+}
+
+// HashPassword returns the hash of the password to store with the user
+func HashPassword(password string) (string, error) {
+	hash, errHash := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errHash != nil {
+		return "", errors.WithStack(errHash)
+	}
+	return string(hash), nil
+}
+
+// Verify returns the user if the password is theirs, ErrInvalidCredentials otherwise. Users with a password in the
+// store are verified locally, all others by the directory if there is one.
+func (authenticator *Authenticator) Verify(username string, password string) (*lmdatabase.User, error) {
+	user, errUser := authenticator.store.UserGetByUsername(username)
+	if errUser != nil {
+		return nil, errUser
+	}
+
+	if user != nil && user.PasswordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+		return user, nil
+	}
+
+	if authenticator.directory == nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	directoryUser, errAuthenticate := authenticator.directory.authenticate(username, password)
+	if errAuthenticate != nil {
+		return nil, errAuthenticate
+	}
+	if directoryUser == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return authenticator.provision(*directoryUser)
+}
+
+// verifyRequest is Verify for the credentials sent with the request, it returns ErrTooManyAttempts without verifying
+// them once the password of the user was wrong maxFailedAttempts times from the address of the request
+func (authenticator *Authenticator) verifyRequest(r *http.Request, username string, password string) (*lmdatabase.User, error) {
+	key := attemptsKey(username, r)
+	if authenticator.failedAttempts.blocked(key, time.Now()) {
+		return nil, ErrTooManyAttempts
+	}
+
+	user, errVerify := authenticator.Verify(username, password)
+	if errors.Cause(errVerify) == ErrInvalidCredentials {
+		authenticator.failedAttempts.fail(key, time.Now())
+		return nil, errVerify
+	}
+	if errVerify != nil {
+		return nil, errVerify
+	}
+
+	authenticator.failedAttempts.succeed(key)
+	return user, nil
+}
+
+// provision stores the user of the directory or proxy without password, so their sessions find them, and updates
+// their role to the one of their groups on every login
+func (authenticator *Authenticator) provision(directoryUser lmdatabase.User) (*lmdatabase.User, error) {
+	user, errUser := authenticator.store.UserGetByUsername(directoryUser.Username)
+	if errUser != nil {
+		return nil, errUser
+	}
+
+	if user == nil {
+		directoryUser.CreatedAt = time.Now().Unix()
+		if errInsert := authenticator.store.UserInsert(directoryUser); errInsert != nil {
+			return nil, errInsert
+		}
+		return &directoryUser, nil
+	}
+
+	if user.Role != directoryUser.Role || user.Modality != directoryUser.Modality || user.DepartmentID != directoryUser.DepartmentID {
+		_, errUpdate := authenticator.store.UserUpdateRole(user.Username, directoryUser.Role, directoryUser.Modality, directoryUser.DepartmentID)
+		if errUpdate != nil {
+			return nil, errUpdate
+		}
+		user.Role, user.Modality, user.DepartmentID = directoryUser.Role, directoryUser.Modality, directoryUser.DepartmentID
+	}
+
+	return user, nil
+}
+
+// Login verifies the password and starts the session of the user, it returns ErrTooManyAttempts after too many wrong
+// passwords
+func (authenticator *Authenticator) Login(w http.ResponseWriter, r *http.Request, username string, password string) (*lmdatabase.User, error) {
+	user, errVerify := authenticator.verifyRequest(r, username, password)
+	if errVerify != nil {
+		return nil, errVerify
+	}
+
+	// an invalid cookie, e.g. signed with a previous key, is replaced
+	session, _ := authenticator.sessions.New(r, sessionName)
+	session.Values[sessionUsername] = user.Username
+
+	if errSave := authenticator.sessions.Save(r, w, session); errSave != nil {
+		return nil, errors.WithStack(errSave)
+	}
+
+	return user, nil
+}
+
+// Logout ends the session
+func (authenticator *Authenticator) Logout(w http.ResponseWriter, r *http.Request) error {
+	session, _ := authenticator.sessions.New(r, sessionName)
+	session.Options.MaxAge = -1
+
+	return errors.WithStack(authenticator.sessions.Save(r, w, session))
+}
+
+// User returns the user a trusted proxy forwarded, of the session or of the basic authentication credentials of the
+// request, nil if there is none. Users are read from the store on every request, so deleted users are logged out
+// immediately. Basic authentication credentials are verified once per verifiedCacheMaxAge and rejected after too many
+// wrong passwords.
+func (authenticator *Authenticator) User(r *http.Request) (*lmdatabase.User, error) {
+	if authenticator.proxy != nil && authenticator.proxy.trusts(r) {
+		if username := authenticator.proxy.username(r); username != "" {
+			return authenticator.proxyUser(r, username)
+		}
+	}
+
+	if username, password, hasBasicAuth := r.BasicAuth(); hasBasicAuth {
+		return authenticator.basicAuthUser(r, username, password)
+	}
+
+	session, errSession := authenticator.sessions.New(r, sessionName)
+	if errSession != nil || session.IsNew {
+		return nil, nil
+	}
+
+	username, _ := session.Values[sessionUsername].(string)
+	if username == "" {
+		return nil, nil
+	}
+
+	return authenticator.store.UserGetByUsername(username)
+}
+
+// basicAuthUser returns the user of the basic authentication credentials, nil if they are wrong or were wrong too often
+func (authenticator *Authenticator) basicAuthUser(r *http.Request, username string, password string) (*lmdatabase.User, error) {
+	hash := credentialsHash(username, password)
+	if authenticator.verified.username(hash, time.Now()) == username {
+		user, errUser := authenticator.store.UserGetByUsername(username)
+		if errUser != nil || user != nil {
+			return user, errUser
+		}
+	}
+
+	user, errVerify := authenticator.verifyRequest(r, username, password)
+	if cause := errors.Cause(errVerify); cause == ErrInvalidCredentials || cause == ErrTooManyAttempts {
+		return nil, nil
+	}
+	if errVerify != nil {
+		return nil, errVerify
+	}
+
+	authenticator.verified.add(hash, username, time.Now())
+	return user, nil
+}
+
+// proxyUser returns the user with the role of their first configured group, or else the user of the store with the
+// username, nil if there is neither
+func (authenticator *Authenticator) proxyUser(r *http.Request, username string) (*lmdatabase.User, error) {
+	group := authenticator.proxy.group(r)
+	if group == nil {
+		return authenticator.store.UserGetByUsername(username)
+	}
+
+	proxyUser := *group
+	proxyUser.Username = username
+	return authenticator.provision(proxyUser)
+}
+
+// MayCreateAndCancel reports whether the user creates, escalates and cancels the notifications of the modality, an
+// empty modality checks the role only
+func MayCreateAndCancel(user *lmdatabase.User, modality string) bool {
+	switch user.Role {
+	case lmdatabase.RoleAdmin:
+		return true
+	case lmdatabase.RoleMTRA:
+		return modality == "" || user.Modality == modality
+	}
+	return false
+}
+
+// MayConfirm reports whether the user confirms and forwards the notifications of the department, an empty
+// department checks the role only
+func MayConfirm(user *lmdatabase.User, department string) bool {
+	switch user.Role {
+	case lmdatabase.RoleAdmin:
+		return true
+	case lmdatabase.RoleRadiologist:
+		return department == "" || user.DepartmentID == department
+	}
+	return false
+}
+
+// Validate returns why the user is incomplete, e.g. an MTRA without modality, empty if it is complete
+func Validate(user lmdatabase.User) string {
+	switch {
+	case user.Username == "":
+		return "the username is empty"
+	case user.Role == lmdatabase.RoleMTRA && user.Modality == "":
+		return "MTRAs need a modality"
+	case user.Role == lmdatabase.RoleRadiologist && user.DepartmentID == "":
+		return "radiologists need a department"
+	}
+
+	for _, role := range lmdatabase.Roles {
+		if role == user.Role {
+			return ""
+		}
+	}
+	return "unknown role " + user.Role + ", use mtra, radiologist or admin"
+}
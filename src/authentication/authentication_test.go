@@ -0,0 +1,201 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func getTestAuthenticator(t *testing.T) *Authenticator {
+	store := lmdatabase.NewMemoryStore()
+
+	passwordHash, errHash := HashPassword("secret")
+	if errHash != nil {
+		t.Fatalf("%+v", errHash)
+	}
+	if errInsert := store.UserInsert(lmdatabase.User{Username: "mtra-ct", PasswordHash: passwordHash, Role: lmdatabase.RoleMTRA, Modality: "ct"}); errInsert != nil {
+		t.Fatalf("%+v", errInsert)
+	}
+
+	initConfig := &configuration.Configuration{}
+	initConfig.Authentication.Enabled = true
+	initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+
+	authenticator, errNew := New(initConfig, store)
+	if errNew != nil {
+		t.Fatalf("%+v", errNew)
+	}
+	return authenticator
+}
+
+func TestUnitVerifyShouldRejectWrongPasswordsAndUnknownUsers(t *testing.T) {
+
+	// given
+	authenticator := getTestAuthenticator(t)
+
+	// when
+	user, errVerify := authenticator.Verify("mtra-ct", "secret")
+	_, errWrongPassword := authenticator.Verify("mtra-ct", "wrong")
+	_, errUnknownUser := authenticator.Verify("nobody", "secret")
+
+	// then
+	assert.NoError(t, errVerify)
+	assert.Equal(t, "ct", user.Modality)
+	assert.Equal(t, ErrInvalidCredentials, errWrongPassword)
+	assert.Equal(t, ErrInvalidCredentials, errUnknownUser)
+}
+
+func TestUnitUserShouldBeReadFromTheSessionAndBasicAuthentication(t *testing.T) {
+
+	// given
+	authenticator := getTestAuthenticator(t)
+
+	loginRecorder := httptest.NewRecorder()
+	_, errLogin := authenticator.Login(loginRecorder, httptest.NewRequest("POST", "/login", nil), "mtra-ct", "secret")
+	if errLogin != nil {
+		t.Fatalf("%+v", errLogin)
+	}
+	sessionCookie := loginRecorder.Result().Cookies()[0]
+
+	logoutRecorder := httptest.NewRecorder()
+	if errLogout := authenticator.Logout(logoutRecorder, httptest.NewRequest("POST", "/logout", nil)); errLogout != nil {
+		t.Fatalf("%+v", errLogout)
+	}
+
+	withSession := httptest.NewRequest("GET", "/", nil)
+	withSession.AddCookie(sessionCookie)
+
+	withBasicAuth := httptest.NewRequest("GET", "/", nil)
+	withBasicAuth.SetBasicAuth("mtra-ct", "secret")
+
+	withWrongBasicAuth := httptest.NewRequest("GET", "/", nil)
+	withWrongBasicAuth.SetBasicAuth("mtra-ct", "wrong")
+
+	withForgedCookie := httptest.NewRequest("GET", "/", nil)
+	withForgedCookie.AddCookie(&http.Cookie{Name: sessionName, Value: "forged"})
+
+	// when
+	sessionUser, errSessionUser := authenticator.User(withSession)
+	basicAuthUser, errBasicAuthUser := authenticator.User(withBasicAuth)
+	wrongBasicAuthUser, errWrongBasicAuthUser := authenticator.User(withWrongBasicAuth)
+	forgedUser, errForgedUser := authenticator.User(withForgedCookie)
+	anonymousUser, errAnonymousUser := authenticator.User(httptest.NewRequest("GET", "/", nil))
+
+	// then
+	assert.NoError(t, errSessionUser)
+	assert.Equal(t, "mtra-ct", sessionUser.Username)
+	assert.NoError(t, errBasicAuthUser)
+	assert.Equal(t, "mtra-ct", basicAuthUser.Username)
+	assert.NoError(t, errWrongBasicAuthUser)
+	assert.Nil(t, wrongBasicAuthUser)
+	assert.NoError(t, errForgedUser)
+	assert.Nil(t, forgedUser)
+	assert.NoError(t, errAnonymousUser)
+	assert.Nil(t, anonymousUser)
+
+	assert.Equal(t, sessionName, logoutRecorder.Result().Cookies()[0].Name)
+	assert.True(t, logoutRecorder.Result().Cookies()[0].MaxAge < 0)
+}
+
+func TestUnitUserShouldRejectBasicAuthenticationAfterTooManyWrongPasswords(t *testing.T) {
+
+	// given
+	authenticator := getTestAuthenticator(t)
+
+	basicAuth := func(password string, remoteAddr string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.SetBasicAuth("mtra-ct", password)
+		return r
+	}
+
+	// when
+	for i := 0; i < maxFailedAttempts; i++ {
+		if _, errUser := authenticator.User(basicAuth("wrong", "10.0.0.1:1234")); errUser != nil {
+			t.Fatalf("%+v", errUser)
+		}
+	}
+
+	blockedUser, errBlockedUser := authenticator.User(basicAuth("secret", "10.0.0.1:1234"))
+	_, errBlockedLogin := authenticator.Login(httptest.NewRecorder(), basicAuth("secret", "10.0.0.1:5678"), "mtra-ct", "secret")
+	otherAddressUser, errOtherAddressUser := authenticator.User(basicAuth("secret", "10.0.0.2:1234"))
+
+	// then
+	assert.NoError(t, errBlockedUser)
+	assert.Nil(t, blockedUser)
+	assert.Equal(t, ErrTooManyAttempts, errBlockedLogin)
+	assert.NoError(t, errOtherAddressUser)
+	assert.Equal(t, "mtra-ct", otherAddressUser.Username)
+}
+
+func TestUnitUserShouldRememberVerifiedBasicAuthenticationBriefly(t *testing.T) {
+
+	// given
+	authenticator := getTestAuthenticator(t)
+
+	basicAuth := httptest.NewRequest("GET", "/", nil)
+	basicAuth.SetBasicAuth("mtra-ct", "secret")
+
+	if _, errUser := authenticator.User(basicAuth); errUser != nil {
+		t.Fatalf("%+v", errUser)
+	}
+
+	otherHash, errHash := HashPassword("other")
+	if errHash != nil {
+		t.Fatalf("%+v", errHash)
+	}
+
+	// when
+	if _, errUpdate := authenticator.store.UserUpdatePassword("mtra-ct", otherHash); errUpdate != nil {
+		t.Fatalf("%+v", errUpdate)
+	}
+	remembered, errRemembered := authenticator.User(basicAuth)
+
+	if _, errDelete := authenticator.store.UserDelete("mtra-ct"); errDelete != nil {
+		t.Fatalf("%+v", errDelete)
+	}
+	deleted, errDeleted := authenticator.User(basicAuth)
+
+	// then
+	assert.NoError(t, errRemembered)
+	assert.Equal(t, "mtra-ct", remembered.Username)
+	assert.NoError(t, errDeleted)
+	assert.Nil(t, deleted)
+}
+
+func TestUnitRolesShouldPermitTheirModalityOrDepartment(t *testing.T) {
+	mtra := &lmdatabase.User{Role: lmdatabase.RoleMTRA, Modality: "ct"}
+	radiologist := &lmdatabase.User{Role: lmdatabase.RoleRadiologist, DepartmentID: "msk"}
+	admin := &lmdatabase.User{Role: lmdatabase.RoleAdmin}
+
+	assert.True(t, MayCreateAndCancel(mtra, "ct"))
+	assert.True(t, MayCreateAndCancel(mtra, ""))
+	assert.False(t, MayCreateAndCancel(mtra, "mr"))
+	assert.False(t, MayConfirm(mtra, "msk"))
+
+	assert.True(t, MayConfirm(radiologist, "msk"))
+	assert.True(t, MayConfirm(radiologist, ""))
+	assert.False(t, MayConfirm(radiologist, "nr"))
+	assert.False(t, MayCreateAndCancel(radiologist, "ct"))
+
+	assert.True(t, MayCreateAndCancel(admin, "mr"))
+	assert.True(t, MayConfirm(admin, "nr"))
+}
+
+func TestUnitValidateShouldRequireTheScopeOfTheRole(t *testing.T) {
+	tests := map[string]lmdatabase.User{
+		"":                               {Username: "a", Role: lmdatabase.RoleMTRA, Modality: "ct"},
+		"the username is empty":          {Role: lmdatabase.RoleAdmin},
+		"MTRAs need a modality":          {Username: "a", Role: lmdatabase.RoleMTRA},
+		"radiologists need a department": {Username: "a", Role: lmdatabase.RoleRadiologist},
+		"unknown role guest, use mtra, radiologist or admin": {Username: "a", Role: "guest"},
+	}
+
+	for expected, user := range tests {
+		assert.Equal(t, expected, Validate(user))
+	}
+}
@@ -0,0 +1,149 @@
+package authentication
+
+import (
+	"container/heap"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewDeviceToken returns a random token for a light and its hash to store
+func NewDeviceToken() (string, string, error) {
+	token, errRandom := randomHex()
+	if errRandom != nil {
+		return "", "", errRandom
+	}
+
+	return token, HashDeviceToken(token), nil
+}
+
+// HashDeviceToken returns the hash of the token as stored, a fast hash suffices as the tokens are random
+func HashDeviceToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// NewDeviceSecret returns a random secret a light signs its requests with, unlike tokens it is stored as is since the
+// server needs it to verify the signatures
+func NewDeviceSecret() (string, error) {
+	return randomHex()
+}
+
+func randomHex() (string, error) {
+	random := make([]byte, 32)
+	if _, errRead := rand.Read(random); errRead != nil {
+		return "", errors.WithStack(errRead)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// SignDeviceRequest returns the hex encoded HMAC-SHA256 of the method, the path and the canonical query of a request,
+// each followed by a newline, keyed by the secret of the device. The signature thereby covers the endpoint and all
+// query parameters, i.e. the device, timestamp and nonce as well as e.g. the location and firmware version.
+func SignDeviceRequest(secret string, method string, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, value := range []string{method, path, CanonicalDeviceQuery(query)} {
+		mac.Write([]byte(value + "\n"))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDeviceSignature compares the signature in constant time
+func VerifyDeviceSignature(secret string, method string, path string, query url.Values, signature string) bool {
+	expected := SignDeviceRequest(secret, method, path, query)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// CanonicalDeviceQuery returns the query parameters except the signature percent-encoded as name=value, sorted and
+// joined by &
+func CanonicalDeviceQuery(query url.Values) string {
+	parameters := make([]string, 0, len(query))
+	for name, values := range query {
+		if name == "signature" {
+			continue
+		}
+		for _, value := range values {
+			parameters = append(parameters, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// Nonces rejects signed requests that are not fresh or were sent before, it remembers the nonces only as long as their
+// timestamp is fresh. The nonces are not persisted, so timestamps before the start of the server are rejected as well:
+// requests recorded before a restart can't be replayed after it.
+type Nonces struct {
+	mutex     sync.Mutex
+	maxAge    int64
+	startedAt int64
+	seen      map[string]struct{}
+	expiries  nonceExpiries // the keys of seen by the time they are no longer fresh, the earliest first
+}
+
+type nonceExpiry struct {
+	key       string
+	expiresAt int64
+}
+
+// nonceExpiries is a min-heap of container/heap ordered by expiresAt
+type nonceExpiries []nonceExpiry
+
+func (expiries nonceExpiries) Len() int {
+	return len(expiries)
+}
+
+func (expiries nonceExpiries) Less(i, j int) bool {
+	return expiries[i].expiresAt < expiries[j].expiresAt
+}
+
+func (expiries nonceExpiries) Swap(i, j int) {
+	expiries[i], expiries[j] = expiries[j], expiries[i]
+}
+
+func (expiries *nonceExpiries) Push(x interface{}) {
+	*expiries = append(*expiries, x.(nonceExpiry))
+}
+
+func (expiries *nonceExpiries) Pop() interface{} {
+	old := *expiries
+	expiry := old[len(old)-1]
+	*expiries = old[:len(old)-1]
+	return expiry
+}
+
+// NewNonces accepts timestamps that differ from the clock of the server by up to maxAge and are not before startedAt
+func NewNonces(maxAge time.Duration, startedAt time.Time) *Nonces {
+	return &Nonces{maxAge: int64(maxAge / time.Second), startedAt: startedAt.Unix(), seen: make(map[string]struct{})}
+}
+
+// Use reports false if the timestamp is not fresh at now or the device used the nonce before
+func (nonces *Nonces) Use(device string, nonce string, timestamp int64, now int64) bool {
+	if timestamp < now-nonces.maxAge || timestamp > now+nonces.maxAge || timestamp < nonces.startedAt {
+		return false
+	}
+
+	nonces.mutex.Lock()
+	defer nonces.mutex.Unlock()
+
+	for len(nonces.expiries) > 0 && nonces.expiries[0].expiresAt < now {
+		delete(nonces.seen, heap.Pop(&nonces.expiries).(nonceExpiry).key)
+	}
+
+	key := device + "\n" + nonce
+	if _, seen := nonces.seen[key]; seen {
+		return false
+	}
+
+	nonces.seen[key] = struct{}{}
+	heap.Push(&nonces.expiries, nonceExpiry{key: key, expiresAt: timestamp + nonces.maxAge})
+	return true
+}
@@ -0,0 +1,99 @@
+package authentication
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitNewDeviceTokenShouldReturnRandomTokensAndTheirHash(t *testing.T) {
+
+	// when
+	token, tokenHash, errToken := NewDeviceToken()
+	otherToken, _, _ := NewDeviceToken()
+
+	// then
+	assert.NoError(t, errToken)
+	assert.Len(t, token, 64)
+	assert.NotEqual(t, token, otherToken)
+	assert.Equal(t, HashDeviceToken(token), tokenHash)
+	assert.NotEqual(t, HashDeviceToken(otherToken), tokenHash)
+}
+
+func TestUnitVerifyDeviceSignatureShouldRejectOtherValuesAndSecrets(t *testing.T) {
+
+	// given
+	path := "/nce-rest/arduino-status/msk-status"
+	query := url.Values{"device": {"msk-1"}, "timestamp": {"1000"}, "nonce": {"nonce"}, "location": {"Raum 1"}}
+	signature := SignDeviceRequest("secret", "GET", path, query)
+
+	changed := func(name string, value string) url.Values {
+		values := url.Values{}
+		for key, existing := range query {
+			values[key] = existing
+		}
+		values.Set(name, value)
+		return values
+	}
+
+	// then
+	assert.Len(t, signature, 64)
+	assert.True(t, VerifyDeviceSignature("secret", "GET", path, query, signature))
+	assert.True(t, VerifyDeviceSignature("secret", "GET", path, changed("signature", signature), signature))
+	assert.False(t, VerifyDeviceSignature("other", "GET", path, query, signature))
+	assert.False(t, VerifyDeviceSignature("secret", "POST", path, query, signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", "/nce-rest/arduino-status/nr-status", query, signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", "/nce-rest/arduino-status/msk-open-notifications", query, signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, changed("device", "msk-2"), signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, changed("timestamp", "1001"), signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, changed("nonce", "other"), signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, changed("location", "Raum 2"), signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, changed("firmware", "1.0"), signature))
+	assert.False(t, VerifyDeviceSignature("secret", "GET", path, query, ""))
+}
+
+func TestUnitCanonicalDeviceQueryShouldSortAndEncodeTheParametersWithoutSignature(t *testing.T) {
+
+	// given
+	query := url.Values{"nonce": {"n"}, "location": {"Raum 1", "A&B"}, "device": {"msk-1"}, "signature": {"abc"}}
+
+	// when
+	canonical := CanonicalDeviceQuery(query)
+
+	// then
+	assert.Equal(t, "device=msk-1&location=A%26B&location=Raum+1&nonce=n", canonical)
+}
+
+func TestUnitNoncesShouldRejectStaleTimestampsAndReplays(t *testing.T) {
+
+	// given
+	nonces := NewNonces(5*time.Minute, time.Unix(900, 0))
+
+	// then
+	assert.True(t, nonces.Use("msk-1", "a", 1000, 1000))
+	assert.False(t, nonces.Use("msk-1", "a", 1000, 1001))
+	assert.True(t, nonces.Use("msk-2", "a", 1000, 1001))
+	assert.True(t, nonces.Use("msk-1", "b", 1300, 1000))
+	assert.False(t, nonces.Use("msk-1", "c", 1301, 1000))
+	assert.False(t, nonces.Use("msk-1", "d", 699, 1000))
+	assert.False(t, nonces.Use("msk-1", "a", 1000, 1300))
+	assert.Len(t, nonces.seen, 3)
+
+	assert.False(t, nonces.Use("msk-1", "e", 1000, 1301))
+	assert.True(t, nonces.Use("msk-1", "f", 1301, 1301))
+	assert.Len(t, nonces.seen, 2)
+	assert.Len(t, nonces.expiries, 2)
+}
+
+func TestUnitNoncesShouldRejectTimestampsBeforeTheStart(t *testing.T) {
+
+	// given
+	nonces := NewNonces(5*time.Minute, time.Unix(1000, 0))
+
+	// then
+	assert.False(t, nonces.Use("msk-1", "a", 999, 1000))
+	assert.True(t, nonces.Use("msk-1", "b", 1000, 1000))
+	assert.True(t, nonces.Use("msk-1", "c", 1001, 1000))
+}
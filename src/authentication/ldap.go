@@ -0,0 +1,198 @@
+package authentication
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+const (
+	ldapTimeout               = 10 * time.Second
+	ldapDefaultUserFilter     = "(objectClass=person)"
+	ldapDefaultUserAttribute  = "sAMAccountName"
+	ldapDefaultGroupAttribute = "memberOf"
+)
+
+// directory verifies passwords with a bind to an LDAP directory, e.g. Active Directory, and grants the role of the
+// groups of the user
+type directory struct {
+	url            string
+	startTLS       bool
+	bindDN         string
+	bindPassword   string
+	baseDN         string
+	userFilter     string
+	userAttribute  string
+	groupAttribute string
+	groups         []ldapGroup
+}
+
+type ldapGroup struct {
+	dn   *ldap.DN
+	user lmdatabase.User // role, modality and department of the members
+}
+
+// newDirectory returns nil if no LDAP URL is configured
+func newDirectory(initConfig *configuration.Configuration) (*directory, error) {
+	config := initConfig.Authentication.LDAP
+	if config.URL == "" {
+		return nil, nil
+	}
+
+	if config.BaseDN == "" {
+		return nil, errors.New("Authentication.LDAP.BaseDN is not configured")
+	}
+
+	directory := &directory{
+		url:            config.URL,
+		startTLS:       config.StartTLS,
+		bindDN:         config.BindDN,
+		bindPassword:   config.BindPassword,
+		baseDN:         config.BaseDN,
+		userFilter:     withDefault(config.UserFilter, ldapDefaultUserFilter),
+		userAttribute:  withDefault(config.UserAttribute, ldapDefaultUserAttribute),
+		groupAttribute: withDefault(config.GroupAttribute, ldapDefaultGroupAttribute),
+	}
+
+	for _, group := range config.Groups {
+		dn, errParseDN := ldap.ParseDN(group.DN)
+		if errParseDN != nil {
+			return nil, errors.Wrapf(errParseDN, "invalid DN of the LDAP group %s", group.DN)
+		}
+
+		user := lmdatabase.User{Username: group.DN, Role: group.Role, Modality: group.Modality, DepartmentID: group.Department}
+		if reason := Validate(user); reason != "" {
+			return nil, errors.Errorf("LDAP group %s: %s", group.DN, reason)
+		}
+
+		directory.groups = append(directory.groups, ldapGroup{dn: dn, user: user})
+	}
+
+	if len(directory.groups) == 0 {
+		log.Println("Authentication.LDAP.Groups is empty, no user of the directory may log in")
+	}
+
+	return directory, nil
+}
+
+// authenticate returns the user with the role of their first configured group, nil if the username or the password
+// is wrong or the user is in none of the groups
+func (directory *directory) authenticate(username string, password string) (*lmdatabase.User, error) {
+	// directories accept binds without password as anonymous
+	if username == "" || password == "" {
+		return nil, nil
+	}
+
+	connection, errDial := directory.dial()
+	if errDial != nil {
+		return nil, errDial
+	}
+	defer connection.Close()
+
+	entry, errSearch := directory.search(connection, username)
+	if errSearch != nil || entry == nil {
+		return nil, errSearch
+	}
+
+	errBind := connection.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(errBind, ldap.LDAPResultInvalidCredentials) {
+		return nil, nil
+	}
+	if errBind != nil {
+		return nil, errors.WithStack(errBind)
+	}
+
+	group := directory.group(entry.GetEqualFoldAttributeValues(directory.groupAttribute))
+	if group == nil {
+		log.Printf("%s is in none of the LDAP groups of the configuration", entry.DN)
+		return nil, nil
+	}
+
+	user := group.user
+	user.Username = entry.GetEqualFoldAttributeValue(directory.userAttribute)
+	if user.Username == "" {
+		user.Username = username
+	}
+
+	return &user, nil
+}
+
+func (directory *directory) dial() (*ldap.Conn, error) {
+	connection, errDial := ldap.DialURL(directory.url, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if errDial != nil {
+		return nil, errors.WithStack(errDial)
+	}
+	connection.SetTimeout(ldapTimeout)
+
+	if directory.startTLS {
+		address, errParse := url.Parse(directory.url)
+		if errParse != nil {
+			connection.Close()
+			return nil, errors.WithStack(errParse)
+		}
+
+		if errStartTLS := connection.StartTLS(&tls.Config{ServerName: address.Hostname()}); errStartTLS != nil {
+			connection.Close()
+			return nil, errors.WithStack(errStartTLS)
+		}
+	}
+
+	errBind := connection.UnauthenticatedBind("")
+	if directory.bindDN != "" {
+		errBind = connection.Bind(directory.bindDN, directory.bindPassword)
+	}
+	if errBind != nil {
+		connection.Close()
+		return nil, errors.WithStack(errBind)
+	}
+
+	return connection, nil
+}
+
+// search returns the entry of the username, nil if there is none or several
+func (directory *directory) search(connection *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := "(&" + directory.userFilter + "(" + directory.userAttribute + "=" + ldap.EscapeFilter(username) + "))"
+
+	result, errSearch := connection.Search(ldap.NewSearchRequest(directory.baseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false, filter,
+		[]string{directory.userAttribute, directory.groupAttribute}, nil))
+	if ldap.IsErrorWithCode(errSearch, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, nil
+	}
+	if errSearch != nil {
+		return nil, errors.WithStack(errSearch)
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, nil
+	}
+
+	return result.Entries[0], nil
+}
+
+// group returns the first configured group of the DNs
+func (directory *directory) group(dns []string) *ldapGroup {
+	for i, group := range directory.groups {
+		for _, dn := range dns {
+			parsed, errParse := ldap.ParseDN(dn)
+			if errParse == nil && group.dn.EqualFold(parsed) {
+				return &directory.groups[i]
+			}
+		}
+	}
+	return nil
+}
+
+func withDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
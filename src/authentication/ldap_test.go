@@ -0,0 +1,168 @@
+package authentication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/authentication/ldaptest"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+const (
+	testGroupMTRACT      = "CN=LM MTRA CT,OU=Groups,DC=example,DC=org"
+	testGroupRadiologist = "CN=LM Radiologie MSK,OU=Groups,DC=example,DC=org"
+	testGroupAdmin       = "CN=LM Admin,OU=Groups,DC=example,DC=org"
+)
+
+// getTestDirectory returns a directory with a service account, an mtra, a radiologist who is an admin as well and a
+// user without group
+func getTestDirectory() *ldaptest.Server {
+	return ldaptest.NewServer(
+		ldaptest.Entry{
+			DN:       "CN=Light Messenger,OU=Service,DC=example,DC=org",
+			Password: "service",
+		},
+		ldaptest.Entry{
+			DN:       "CN=Anna Muster,OU=Staff,DC=example,DC=org",
+			Password: "anna-secret",
+			Attributes: map[string][]string{
+				"objectClass":    {"top", "person", "user"},
+				"sAMAccountName": {"amuster"},
+				"memberOf":       {"CN=Staff,OU=Groups,DC=example,DC=org", testGroupMTRACT},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "CN=Ben Beispiel,OU=Staff,DC=example,DC=org",
+			Password: "ben-secret",
+			Attributes: map[string][]string{
+				"objectClass":    {"top", "person", "user"},
+				"sAMAccountName": {"bbeispiel"},
+				"memberOf":       {"cn=lm radiologie msk,ou=groups,dc=example,dc=org", testGroupAdmin},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "CN=Carla Gast,OU=Staff,DC=example,DC=org",
+			Password: "carla-secret",
+			Attributes: map[string][]string{
+				"objectClass":    {"top", "person", "user"},
+				"sAMAccountName": {"cgast"},
+				"memberOf":       {"CN=Staff,OU=Groups,DC=example,DC=org"},
+			},
+		},
+	)
+}
+
+func getTestDirectoryAuthenticator(t *testing.T, server *ldaptest.Server, store lmdatabase.Store) *Authenticator {
+	initConfig := &configuration.Configuration{}
+	initConfig.Authentication.Enabled = true
+	initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+	initConfig.Authentication.LDAP.URL = server.URL
+	initConfig.Authentication.LDAP.BindDN = "CN=Light Messenger,OU=Service,DC=example,DC=org"
+	initConfig.Authentication.LDAP.BindPassword = "service"
+	initConfig.Authentication.LDAP.BaseDN = "OU=Staff,DC=example,DC=org"
+	initConfig.Authentication.LDAP.Groups = []configuration.LDAPGroup{
+		{DN: testGroupAdmin, Role: lmdatabase.RoleAdmin},
+		{DN: testGroupMTRACT, Role: lmdatabase.RoleMTRA, Modality: "ct"},
+		{DN: testGroupRadiologist, Role: lmdatabase.RoleRadiologist, Department: "msk"},
+	}
+
+	authenticator, errNew := New(initConfig, store)
+	if errNew != nil {
+		t.Fatalf("%+v", errNew)
+	}
+	return authenticator
+}
+
+func TestUnitVerifyShouldBindToTheDirectoryAndGrantTheRoleOfTheFirstGroup(t *testing.T) {
+
+	// given
+	server := getTestDirectory()
+	defer server.Close()
+
+	store := lmdatabase.NewMemoryStore()
+	authenticator := getTestDirectoryAuthenticator(t, server, store)
+
+	// when
+	mtra, errMTRA := authenticator.Verify("amuster", "anna-secret")
+	admin, errAdmin := authenticator.Verify("BBeispiel", "ben-secret")
+	_, errWrongPassword := authenticator.Verify("amuster", "ben-secret")
+	_, errEmptyPassword := authenticator.Verify("amuster", "")
+	_, errWithoutGroup := authenticator.Verify("cgast", "carla-secret")
+	_, errUnknown := authenticator.Verify("nobody", "anna-secret")
+	_, errInjection := authenticator.Verify("*", "anna-secret")
+
+	users, _ := store.UserGetAll()
+
+	// then
+	assert.NoError(t, errMTRA)
+	assert.Equal(t, "amuster", mtra.Username)
+	assert.Equal(t, lmdatabase.RoleMTRA, mtra.Role)
+	assert.Equal(t, "ct", mtra.Modality)
+
+	assert.NoError(t, errAdmin)
+	assert.Equal(t, "bbeispiel", admin.Username)
+	assert.Equal(t, lmdatabase.RoleAdmin, admin.Role)
+
+	assert.Equal(t, ErrInvalidCredentials, errWrongPassword)
+	assert.Equal(t, ErrInvalidCredentials, errEmptyPassword)
+	assert.Equal(t, ErrInvalidCredentials, errWithoutGroup)
+	assert.Equal(t, ErrInvalidCredentials, errUnknown)
+	assert.Equal(t, ErrInvalidCredentials, errInjection)
+
+	assert.Len(t, *users, 2)
+	assert.Equal(t, "", (*users)[0].PasswordHash)
+	assert.Contains(t, server.Binds(), "CN=Light Messenger,OU=Service,DC=example,DC=org")
+	assert.Contains(t, server.Binds(), "CN=Anna Muster,OU=Staff,DC=example,DC=org")
+}
+
+func TestUnitVerifyShouldUpdateTheRoleOfDirectoryUsersAndPreferLocalPasswords(t *testing.T) {
+
+	// given
+	server := getTestDirectory()
+	defer server.Close()
+
+	store := lmdatabase.NewMemoryStore()
+	store.UserInsert(lmdatabase.User{Username: "amuster", Role: lmdatabase.RoleRadiologist, DepartmentID: "nr"})
+
+	passwordHash, _ := HashPassword("local-secret")
+	store.UserInsert(lmdatabase.User{Username: "bbeispiel", PasswordHash: passwordHash, Role: lmdatabase.RoleMTRA, Modality: "mr"})
+
+	authenticator := getTestDirectoryAuthenticator(t, server, store)
+
+	// when
+	mtra, errMTRA := authenticator.Verify("amuster", "anna-secret")
+	stored, _ := store.UserGetByUsername("amuster")
+	local, errLocal := authenticator.Verify("bbeispiel", "local-secret")
+	_, errDirectoryPassword := authenticator.Verify("bbeispiel", "ben-secret")
+
+	// then
+	assert.NoError(t, errMTRA)
+	assert.Equal(t, lmdatabase.RoleMTRA, mtra.Role)
+	assert.Equal(t, lmdatabase.User{Username: "amuster", Role: lmdatabase.RoleMTRA, Modality: "ct"}, *stored)
+
+	assert.NoError(t, errLocal)
+	assert.Equal(t, "mr", local.Modality)
+	assert.Equal(t, ErrInvalidCredentials, errDirectoryPassword)
+}
+
+func TestUnitNewShouldRejectInvalidGroups(t *testing.T) {
+	tests := map[string]configuration.LDAPGroup{
+		"invalid DN":            {DN: "not a dn", Role: lmdatabase.RoleAdmin},
+		"MTRAs need a modality": {DN: testGroupMTRACT, Role: lmdatabase.RoleMTRA},
+		"unknown role":          {DN: testGroupAdmin, Role: "root"},
+	}
+
+	for expected, group := range tests {
+		initConfig := &configuration.Configuration{}
+		initConfig.Authentication.LDAP.URL = "ldap://127.0.0.1:389"
+		initConfig.Authentication.LDAP.BaseDN = "DC=example,DC=org"
+		initConfig.Authentication.LDAP.Groups = []configuration.LDAPGroup{group}
+
+		_, errNew := New(initConfig, lmdatabase.NewMemoryStore())
+
+		if assert.Error(t, errNew, expected) {
+			assert.Contains(t, errNew.Error(), expected)
+		}
+	}
+}
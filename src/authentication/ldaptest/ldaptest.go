@@ -0,0 +1,289 @@
+// Package ldaptest is a stand-in for an LDAP directory in tests, in the spirit of net/http/httptest. It answers simple
+// binds and searches with equality, presence, and, or and not filters, nothing else.
+package ldaptest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is an object of the directory, it may bind with its password if that is set
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a directory listening on a local port
+type Server struct {
+	URL      string // e.g. ldap://127.0.0.1:38389
+	entries  []Entry
+	listener net.Listener
+
+	mutex       sync.Mutex
+	connections []net.Conn
+	binds       []string
+}
+
+// NewServer starts a directory with the entries, close it at the end of the test
+func NewServer(entries ...Entry) *Server {
+	listener, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		panic("ldaptest: failed to listen on a port: " + errListen.Error())
+	}
+
+	server := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		entries:  entries,
+		listener: listener,
+	}
+
+	go server.accept()
+
+	return server
+}
+
+// Close stops the directory and closes its connections
+func (server *Server) Close() {
+	server.listener.Close()
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for _, connection := range server.connections {
+		connection.Close()
+	}
+}
+
+// Binds returns the DNs of the successful binds, the most recent last
+func (server *Server) Binds() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]string(nil), server.binds...)
+}
+
+func (server *Server) accept() {
+	for {
+		connection, errAccept := server.listener.Accept()
+		if errAccept != nil {
+			return
+		}
+
+		server.mutex.Lock()
+		server.connections = append(server.connections, connection)
+		server.mutex.Unlock()
+
+		go server.serve(connection)
+	}
+}
+
+func (server *Server) serve(connection net.Conn) {
+	defer connection.Close()
+
+	for {
+		request, errRead := ber.ReadPacket(connection)
+		if errRead != nil || len(request.Children) < 2 {
+			return
+		}
+
+		messageID := request.Children[0].Value
+		operation := request.Children[1]
+
+		var responses []*ber.Packet
+		switch operation.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{server.bind(operation)}
+		case ldap.ApplicationSearchRequest:
+			responses = server.search(operation)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			responses = []*ber.Packet{result(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "not supported by ldaptest")}
+		}
+
+		for _, response := range responses {
+			message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+			message.AppendChild(response)
+
+			if _, errWrite := connection.Write(message.Bytes()); errWrite != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind succeeds for the DN and password of an entry and, like real directories, for every DN without password
+func (server *Server) bind(operation *ber.Packet) *ber.Packet {
+	if len(operation.Children) < 3 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultProtocolError, "malformed bind request")
+	}
+
+	dn := stringValue(operation.Children[1])
+	password := operation.Children[2].Data.String()
+
+	if password != "" {
+		entry := server.entry(dn)
+		if entry == nil || entry.Password == "" || entry.Password != password {
+			return result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials")
+		}
+	}
+
+	server.mutex.Lock()
+	server.binds = append(server.binds, dn)
+	server.mutex.Unlock()
+
+	return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+}
+
+func (server *Server) search(operation *ber.Packet) []*ber.Packet {
+	if len(operation.Children) < 8 {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search request")}
+	}
+
+	base, errBase := ldap.ParseDN(stringValue(operation.Children[0]))
+	if errBase != nil {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax, errBase.Error())}
+	}
+	scope, _ := operation.Children[1].Value.(int64)
+	filter := operation.Children[6]
+
+	var attributes []string
+	for _, attribute := range operation.Children[7].Children {
+		attributes = append(attributes, stringValue(attribute))
+	}
+
+	var responses []*ber.Packet
+	for _, entry := range server.entries {
+		dn, errDN := ldap.ParseDN(entry.DN)
+		if errDN != nil {
+			continue
+		}
+
+		inScope := base.EqualFold(dn) || base.AncestorOfFold(dn)
+		if scope == ldap.ScopeBaseObject {
+			inScope = base.EqualFold(dn)
+		}
+
+		if inScope && matches(entry, filter) {
+			responses = append(responses, searchResultEntry(entry, attributes))
+		}
+	}
+
+	return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (server *Server) entry(dn string) *Entry {
+	parsed, errParse := ldap.ParseDN(dn)
+	if errParse != nil {
+		return nil
+	}
+
+	for i, entry := range server.entries {
+		if entryDN, errEntryDN := ldap.ParseDN(entry.DN); errEntryDN == nil && entryDN.EqualFold(parsed) {
+			return &server.entries[i]
+		}
+	}
+	return nil
+}
+
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range attributeValues(entry, stringValue(filter.Children[0])) {
+			if strings.EqualFold(value, stringValue(filter.Children[1])) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+// attributeValues returns the values of the attribute, whose name is case insensitive as in LDAP
+func attributeValues(entry Entry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func searchResultEntry(entry Entry, attributes []string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if !requested(name, attributes) {
+			continue
+		}
+
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	response.AppendChild(list)
+
+	return response
+}
+
+// requested reports whether the search asked for the attribute, no attributes ask for all of them
+func requested(name string, attributes []string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute, name) || attribute == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func result(application ber.Tag, resultCode int64, message string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, resultCode, "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return response
+}
+
+func stringValue(packet *ber.Packet) string {
+	if value, isString := packet.Value.(string); isString {
+		return value
+	}
+	return packet.Data.String()
+}
@@ -0,0 +1,123 @@
+package authentication
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+const (
+	proxyDefaultUserHeader     = "X-Remote-User"
+	proxyDefaultGroupsHeader   = "X-Remote-Groups"
+	proxyDefaultGroupSeparator = ","
+)
+
+// proxy trusts the identity headers of requests from reverse proxies that authenticate the users
+type proxy struct {
+	networks       []*net.IPNet
+	userHeader     string
+	groupsHeader   string
+	groupSeparator string
+	groups         []proxyGroup
+}
+
+type proxyGroup struct {
+	name string
+	user lmdatabase.User // role, modality and department of the members
+}
+
+// newProxy returns nil if no trusted proxies are configured
+func newProxy(initConfig *configuration.Configuration) (*proxy, error) {
+	config := initConfig.Authentication.Proxy
+	if len(config.TrustedProxies) == 0 {
+		return nil, nil
+	}
+
+	proxy := &proxy{
+		userHeader:     withDefault(config.UserHeader, proxyDefaultUserHeader),
+		groupsHeader:   withDefault(config.GroupsHeader, proxyDefaultGroupsHeader),
+		groupSeparator: withDefault(config.GroupSeparator, proxyDefaultGroupSeparator),
+	}
+
+	for _, address := range config.TrustedProxies {
+		network, errNetwork := parseNetwork(address)
+		if errNetwork != nil {
+			return nil, errNetwork
+		}
+		proxy.networks = append(proxy.networks, network)
+	}
+
+	for _, group := range config.Groups {
+		user := lmdatabase.User{Username: group.Name, Role: group.Role, Modality: group.Modality, DepartmentID: group.Department}
+		if reason := Validate(user); reason != "" {
+			return nil, errors.Errorf("proxy group %s: %s", group.Name, reason)
+		}
+
+		proxy.groups = append(proxy.groups, proxyGroup{name: group.Name, user: user})
+	}
+
+	return proxy, nil
+}
+
+// parseNetwork accepts a network like 10.0.0.0/24 or a single address
+func parseNetwork(address string) (*net.IPNet, error) {
+	if !strings.Contains(address, "/") {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("invalid address of a trusted proxy %s", address)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, errParse := net.ParseCIDR(address)
+	if errParse != nil {
+		return nil, errors.Wrapf(errParse, "invalid network of trusted proxies %s", address)
+	}
+	return network, nil
+}
+
+// trusts reports whether the request comes from a trusted proxy, the headers of all other requests are ignored
+func (proxy *proxy) trusts(r *http.Request) bool {
+	ip := net.ParseIP(remoteHost(r))
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range proxy.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// username returns the user the proxy authenticated, empty if it sent none
+func (proxy *proxy) username(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(proxy.userHeader))
+}
+
+// group returns the first configured group of the groups header, nil if there is none
+func (proxy *proxy) group(r *http.Request) *lmdatabase.User {
+	var names []string
+	for _, value := range r.Header[http.CanonicalHeaderKey(proxy.groupsHeader)] {
+		names = append(names, strings.Split(value, proxy.groupSeparator)...)
+	}
+
+	for i, group := range proxy.groups {
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSpace(name), group.name) {
+				return &proxy.groups[i].user
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package authentication
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func getTestProxyAuthenticator(t *testing.T, store lmdatabase.Store) *Authenticator {
+	initConfig := &configuration.Configuration{}
+	initConfig.Authentication.Enabled = true
+	initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+	initConfig.Authentication.Proxy.TrustedProxies = []string{"10.0.0.0/24", "2001:db8::1"}
+	initConfig.Authentication.Proxy.Groups = []configuration.ProxyGroup{
+		{Name: "lm-admin", Role: lmdatabase.RoleAdmin},
+		{Name: "lm-mtra-ct", Role: lmdatabase.RoleMTRA, Modality: "ct"},
+	}
+
+	authenticator, errNew := New(initConfig, store)
+	if errNew != nil {
+		t.Fatalf("%+v", errNew)
+	}
+	return authenticator
+}
+
+func TestUnitUserShouldTrustTheHeadersOfTrustedProxiesOnly(t *testing.T) {
+
+	// given
+	store := lmdatabase.NewMemoryStore()
+	store.UserInsert(lmdatabase.User{Username: "radiologist-msk", Role: lmdatabase.RoleRadiologist, DepartmentID: "msk"})
+	authenticator := getTestProxyAuthenticator(t, store)
+
+	request := func(remoteAddr string, username string, groups ...string) *lmdatabase.User {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Remote-User", username)
+		for _, group := range groups {
+			r.Header.Add("X-Remote-Groups", group)
+		}
+
+		user, errUser := authenticator.User(r)
+		if errUser != nil {
+			t.Fatalf("%+v", errUser)
+		}
+		return user
+	}
+
+	// when
+	mtra := request("10.0.0.7:51234", "anna", "staff, LM-MTRA-CT")
+	admin := request("[2001:db8::1]:443", "ben", "lm-mtra-ct", "lm-admin")
+	stored := request("10.0.0.8:51234", "radiologist-msk", "staff")
+	unknown := request("10.0.0.9:51234", "carla", "staff")
+	untrusted := request("10.0.1.7:51234", "anna", "lm-admin")
+
+	provisioned, _ := store.UserGetByUsername("anna")
+
+	// then
+	assert.Equal(t, lmdatabase.RoleMTRA, mtra.Role)
+	assert.Equal(t, "ct", mtra.Modality)
+	assert.Equal(t, lmdatabase.RoleAdmin, admin.Role)
+	assert.Equal(t, "msk", stored.DepartmentID)
+	assert.Nil(t, unknown)
+	assert.Nil(t, untrusted)
+	assert.Equal(t, lmdatabase.RoleMTRA, provisioned.Role)
+}
+
+func TestUnitNewShouldRejectInvalidTrustedProxies(t *testing.T) {
+	for _, address := range []string{"proxy.example.org", "10.0.0.0/33"} {
+		initConfig := &configuration.Configuration{}
+		initConfig.Authentication.Proxy.TrustedProxies = []string{address}
+
+		_, errNew := New(initConfig, lmdatabase.NewMemoryStore())
+
+		assert.Error(t, errNew, address)
+	}
+}
@@ -0,0 +1,145 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxFailedAttempts   = 5
+	failedAttemptsReset = 5 * time.Minute
+	verifiedCacheMaxAge = time.Minute
+)
+
+// ErrTooManyAttempts is returned when the password of a user was wrong too often from the same address, further
+// attempts are rejected until failedAttemptsReset passed
+var ErrTooManyAttempts = errors.New("too many failed attempts, try again later")
+
+// failedAttempts counts the failed password verifications per username and client address
+type failedAttempts struct {
+	mutex     sync.Mutex
+	failures  map[string]*failure
+	lastSweep time.Time
+}
+
+type failure struct {
+	count int
+	first time.Time
+}
+
+func newFailedAttempts() *failedAttempts {
+	return &failedAttempts{failures: make(map[string]*failure)}
+}
+
+// blocked reports whether the key failed maxFailedAttempts times within failedAttemptsReset
+func (attempts *failedAttempts) blocked(key string, now time.Time) bool {
+	attempts.mutex.Lock()
+	defer attempts.mutex.Unlock()
+
+	failure := attempts.failures[key]
+	return failure != nil && failure.count >= maxFailedAttempts && now.Sub(failure.first) < failedAttemptsReset
+}
+
+// fail counts a failed attempt of the key, the count restarts after failedAttemptsReset
+func (attempts *failedAttempts) fail(key string, now time.Time) {
+	attempts.mutex.Lock()
+	defer attempts.mutex.Unlock()
+
+	// expired keys are removed at most once per period, so guessing many usernames does not grow the map forever
+	if now.Sub(attempts.lastSweep) >= failedAttemptsReset {
+		for other, failure := range attempts.failures {
+			if now.Sub(failure.first) >= failedAttemptsReset {
+				delete(attempts.failures, other)
+			}
+		}
+		attempts.lastSweep = now
+	}
+
+	entry := attempts.failures[key]
+	if entry == nil || now.Sub(entry.first) >= failedAttemptsReset {
+		entry = &failure{first: now}
+		attempts.failures[key] = entry
+	}
+	entry.count++
+}
+
+// attemptsKey returns the key of the attempts of the username from the address of the request, so guessing from one
+// address does not lock the user out everywhere
+func attemptsKey(username string, r *http.Request) string {
+	return username + "\x00" + remoteHost(r)
+}
+
+// remoteHost returns the address of the client of the request without port
+func remoteHost(r *http.Request) string {
+	host, _, errSplit := net.SplitHostPort(r.RemoteAddr)
+	if errSplit != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// succeed forgets the failed attempts of the key
+func (attempts *failedAttempts) succeed(key string) {
+	attempts.mutex.Lock()
+	defer attempts.mutex.Unlock()
+
+	delete(attempts.failures, key)
+}
+
+// verifiedCredentials remembers the credentials verified within verifiedCacheMaxAge by their hash, so clients that
+// send them with every request, e.g. to the api, do not need a bcrypt comparison or directory bind each time
+type verifiedCredentials struct {
+	mutex     sync.Mutex
+	usernames map[string]verifiedUsername
+	lastSweep time.Time
+}
+
+type verifiedUsername struct {
+	username string
+	expires  time.Time
+}
+
+func newVerifiedCredentials() *verifiedCredentials {
+	return &verifiedCredentials{usernames: make(map[string]verifiedUsername)}
+}
+
+// credentialsHash returns the key of the credentials, the password itself is not kept
+func credentialsHash(username string, password string) string {
+	hash := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(hash[:])
+}
+
+// username returns the username of the credentials if they were verified recently, empty otherwise
+func (verified *verifiedCredentials) username(hash string, now time.Time) string {
+	verified.mutex.Lock()
+	defer verified.mutex.Unlock()
+
+	entry, found := verified.usernames[hash]
+	if !found || !now.Before(entry.expires) {
+		return ""
+	}
+	return entry.username
+}
+
+// add remembers the verified credentials for verifiedCacheMaxAge
+func (verified *verifiedCredentials) add(hash string, username string, now time.Time) {
+	verified.mutex.Lock()
+	defer verified.mutex.Unlock()
+
+	if now.Sub(verified.lastSweep) >= verifiedCacheMaxAge {
+		for other, entry := range verified.usernames {
+			if !now.Before(entry.expires) {
+				delete(verified.usernames, other)
+			}
+		}
+		verified.lastSweep = now
+	}
+
+	verified.usernames[hash] = verifiedUsername{username: username, expires: now.Add(verifiedCacheMaxAge)}
+}
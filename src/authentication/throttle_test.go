@@ -0,0 +1,55 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitFailedAttemptsShouldBlockUntilTheyAreReset(t *testing.T) {
+
+	// given
+	attempts := newFailedAttempts()
+	start := time.Unix(1000, 0)
+
+	// when
+	for i := 0; i < maxFailedAttempts-1; i++ {
+		attempts.fail("mtra-ct", start)
+	}
+	blockedBefore := attempts.blocked("mtra-ct", start)
+
+	attempts.fail("mtra-ct", start)
+	blocked := attempts.blocked("mtra-ct", start.Add(failedAttemptsReset-time.Second))
+	reset := attempts.blocked("mtra-ct", start.Add(failedAttemptsReset))
+
+	attempts.fail("other", start)
+	attempts.succeed("other")
+
+	attempts.fail("mtra-ct", start.Add(failedAttemptsReset))
+
+	// then
+	assert.False(t, blockedBefore)
+	assert.True(t, blocked)
+	assert.False(t, reset)
+	assert.NotContains(t, attempts.failures, "other")
+	assert.Equal(t, 1, attempts.failures["mtra-ct"].count)
+}
+
+func TestUnitVerifiedCredentialsShouldExpire(t *testing.T) {
+
+	// given
+	verified := newVerifiedCredentials()
+	start := time.Unix(1000, 0)
+	hash := credentialsHash("mtra-ct", "secret")
+
+	// when
+	verified.add(hash, "mtra-ct", start)
+	verified.add(credentialsHash("other", "secret"), "other", start.Add(-verifiedCacheMaxAge))
+
+	// then
+	assert.NotEqual(t, hash, credentialsHash("mtra-ct", "wrong"))
+	assert.Equal(t, "mtra-ct", verified.username(hash, start.Add(verifiedCacheMaxAge-time.Second)))
+	assert.Empty(t, verified.username(hash, start.Add(verifiedCacheMaxAge)))
+	assert.Empty(t, verified.username(credentialsHash("other", "secret"), start))
+}
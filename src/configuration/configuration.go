@@ -15,12 +15,60 @@ type Configuration struct {
 		HTTPPort int
 	}
 	Database struct {
+		Driver   string // mysql (default), postgres, sqlite or memory
 		Username string
-    	Password string
-    	Host string
-    	Port int
-        DBName string
+		Password string
+		Host     string
+		Port     int
+		DBName   string
+		SSLMode  string // sslmode of the postgres driver, e.g. disable or verify-full
+		Path     string // database file of the sqlite driver
 	}
+	Devices struct {
+		RequireToken     bool // rejects lights without token, otherwise their heartbeats are flagged once their department has tokens
+		RequireSignature bool // rejects lights that do not sign their requests, plain tokens included
+		SignatureMaxAge  int  // seconds the timestamp of a signed request may differ from the clock, defaults to 5 minutes
+	}
+	Authentication struct {
+		Enabled       bool   // requires users to log in, the lights and the login page stay public
+		SessionKey    string // signs the session cookies, at least 32 characters; a random key logs everybody out on restart
+		SessionMaxAge int    // seconds a login lasts, defaults to 12 hours
+		SecureCookie  bool   // sends the session cookie over https only
+		LDAP          struct {
+			URL            string      // e.g. ldaps://ad.example.org, users log in with their directory password if set
+			StartTLS       bool        // upgrades an ldap:// connection to tls
+			BindDN         string      // account that searches the users, anonymous if empty
+			BindPassword   string      // password of the BindDN
+			BaseDN         string      // users are searched below it
+			UserFilter     string      // restricts the searched users, defaults to (objectClass=person)
+			UserAttribute  string      // holds the username, defaults to sAMAccountName
+			GroupAttribute string      // lists the groups of a user, defaults to memberOf
+			Groups         []LDAPGroup // the first group the user is a member of grants the role
+		}
+		Proxy struct {
+			TrustedProxies []string     // addresses or networks, e.g. 10.0.0.0/24, of reverse proxies that authenticate users
+			UserHeader     string       // holds the username, defaults to X-Remote-User
+			GroupsHeader   string       // holds the groups of the user, defaults to X-Remote-Groups
+			GroupSeparator string       // separates the groups in the GroupsHeader, defaults to a comma
+			Groups         []ProxyGroup // the first group the user is a member of grants the role
+		}
+	}
+}
+
+// LDAPGroup maps the members of a directory group to a role
+type LDAPGroup struct {
+	DN         string // e.g. CN=Light-Messenger MTRA CT,OU=Groups,DC=example,DC=org
+	Role       string // mtra, radiologist or admin
+	Modality   string // of mtras
+	Department string // of radiologists
+}
+
+// ProxyGroup maps the members of a group forwarded by a reverse proxy to a role
+type ProxyGroup struct {
+	Name       string // as in the GroupsHeader
+	Role       string // mtra, radiologist or admin
+	Modality   string // of mtras
+	Department string // of radiologists
 }
 
 // LoadAndSetConfiguration ...
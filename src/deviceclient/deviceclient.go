@@ -0,0 +1,90 @@
+// Package deviceclient is a reference client of the endpoints of the lights that signs its requests, it shows
+// firmware authors the signing scheme and lets tests and installations act as a light
+package deviceclient
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+)
+
+// Client signs the requests of one light with its secret
+type Client struct {
+	URL        string // of the server, e.g. http://light-messenger.example.org:8080
+	Department string
+	Device     string
+	Secret     string       // printed by device add --signed
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// Status sends a heartbeat with the location and firmware version of the light
+func (client *Client) Status(location string, firmware string) error {
+	query := url.Values{}
+	query.Set("location", location)
+	query.Set("firmware", firmware)
+
+	_, errGet := client.get("status", query)
+	return errGet
+}
+
+// OpenNotifications returns the answer for the light, ;0; without open notifications or e.g. ;1;HIGH; with the
+// priority of the first
+func (client *Client) OpenNotifications() (string, error) {
+	return client.get("open-notifications", url.Values{})
+}
+
+// SignedURL returns the url of the endpoint, status or open-notifications, with the query and the signature of a fresh
+// timestamp and a random nonce
+func (client *Client) SignedURL(endpoint string, query url.Values) (string, error) {
+	random := make([]byte, 16)
+	if _, errRead := rand.Read(random); errRead != nil {
+		return "", errors.WithStack(errRead)
+	}
+	nonce := hex.EncodeToString(random)
+	timestamp := time.Now().Unix()
+
+	path := "/nce-rest/arduino-status/" + client.Department + "-" + endpoint
+
+	query.Set("device", client.Device)
+	query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+	query.Set("nonce", nonce)
+	query.Set("signature", authentication.SignDeviceRequest(client.Secret, http.MethodGet, path, query))
+
+	return client.URL + (&url.URL{Path: path}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (client *Client) get(endpoint string, query url.Values) (string, error) {
+	signedURL, errURL := client.SignedURL(endpoint, query)
+	if errURL != nil {
+		return "", errURL
+	}
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, errGet := httpClient.Get(signedURL)
+	if errGet != nil {
+		return "", errors.WithStack(errGet)
+	}
+	defer response.Body.Close()
+
+	body, errRead := ioutil.ReadAll(response.Body)
+	if errRead != nil {
+		return "", errors.WithStack(errRead)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s %s: %s", endpoint, response.Status, body)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,65 @@
+package deviceclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+)
+
+func TestUnitClientShouldSignItsRequestsWithAFreshNonce(t *testing.T) {
+
+	// given
+	var queries []url.Values
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		queries = append(queries, r.URL.Query())
+		w.Write([]byte(";0;"))
+	}))
+	defer server.Close()
+
+	client := Client{URL: server.URL, Department: "msk", Device: "msk-1", Secret: "secret"}
+
+	// when
+	errStatus := client.Status("Raum 1", "1.2")
+	open, errOpen := client.OpenNotifications()
+
+	// then
+	assert.NoError(t, errStatus)
+	assert.NoError(t, errOpen)
+	assert.Equal(t, ";0;", open)
+	assert.Equal(t, []string{"/nce-rest/arduino-status/msk-status", "/nce-rest/arduino-status/msk-open-notifications"}, paths)
+	assert.Equal(t, "Raum 1", queries[0].Get("location"))
+	assert.NotEqual(t, queries[0].Get("nonce"), queries[1].Get("nonce"))
+
+	for i, query := range queries {
+		_, errTimestamp := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+		assert.NoError(t, errTimestamp)
+		assert.Equal(t, "msk-1", query.Get("device"))
+		assert.True(t, authentication.VerifyDeviceSignature("secret", http.MethodGet, paths[i], query, query.Get("signature")))
+	}
+}
+
+func TestUnitClientShouldReturnTheStatusOfRejectedRequests(t *testing.T) {
+
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := Client{URL: server.URL, Department: "msk", Device: "msk-1", Secret: "wrong"}
+
+	// when
+	errStatus := client.Status("", "")
+
+	// then
+	if assert.Error(t, errStatus) {
+		assert.Contains(t, errStatus.Error(), "401 Unauthorized")
+	}
+}
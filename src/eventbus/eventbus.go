@@ -0,0 +1,79 @@
+// Package eventbus distributes changes of notifications in-process, e.g. to the pages that show them
+package eventbus
+
+import (
+	"sync"
+)
+
+// values of Event.Type
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated" // the priority changed or the notification was forwarded
+	EventConfirmed = "confirmed"
+	EventCancelled = "cancelled"
+)
+
+// subscriptionBuffer is the number of events a subscriber may fall behind before it is dropped
+const subscriptionBuffer = 64
+
+// Event is a change of a notification
+type Event struct {
+	Type               string
+	NotificationID     string
+	Department         string
+	Modality           string
+	PreviousDepartment string // the department a forwarded notification was moved from, empty otherwise
+}
+
+// Concerns reports whether the event changes the notifications of the department
+func (event Event) Concerns(department string) bool {
+	return event.Department == department || event.PreviousDepartment == department
+}
+
+// Bus delivers every published event to all subscribers
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// New returns a bus without subscribers
+func New() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel that receives all events published from now on. The channel is closed when the
+// subscriber falls too far behind, it has to catch up from the store then.
+func (bus *Bus) Subscribe() chan Event {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	subscription := make(chan Event, subscriptionBuffer)
+	bus.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe stops delivering events to the channel and closes it
+func (bus *Bus) Unsubscribe(subscription chan Event) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	if _, subscribed := bus.subscribers[subscription]; subscribed {
+		delete(bus.subscribers, subscription)
+		close(subscription)
+	}
+}
+
+// Publish delivers the event to all subscribers without blocking
+func (bus *Bus) Publish(event Event) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for subscription := range bus.subscribers {
+		select {
+		case subscription <- event:
+		default:
+			delete(bus.subscribers, subscription)
+			close(subscription)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func TestUnitBusShouldDeliverEventsToAllSubscribers(t *testing.T) {
+
+	// given
+	bus := New()
+	first := bus.Subscribe()
+	second := bus.Subscribe()
+	bus.Unsubscribe(second)
+
+	event := Event{Type: EventCreated, NotificationID: "1", Department: "msk", Modality: "ct"}
+
+	// when
+	bus.Publish(event)
+
+	// then
+	assert.Equal(t, event, <-first)
+	_, open := <-second
+	assert.False(t, open)
+}
+
+func TestUnitBusShouldDropSubscriberThatFallsBehind(t *testing.T) {
+
+	// given
+	bus := New()
+	subscription := bus.Subscribe()
+
+	// when
+	for i := 0; i <= subscriptionBuffer; i++ {
+		bus.Publish(Event{Type: EventUpdated})
+	}
+
+	// then
+	received := 0
+	for range subscription {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received)
+
+	bus.Unsubscribe(subscription) // unsubscribing a dropped subscriber is harmless
+}
+
+func TestUnitStoreShouldPublishChangesOfNotifications(t *testing.T) {
+
+	// given
+	bus := New()
+	store := NewStore(lmdatabase.NewMemoryStore(), bus)
+	subscription := bus.Subscribe()
+
+	// when
+	created, errCreate := store.NotificationCreateOrEscalate("msk", 3, "ct", lmdatabase.NotificationDetails{}, 100, "ws-1")
+	if errCreate != nil {
+		t.Fatalf("%+v", errCreate)
+	}
+	_, errEscalate := store.NotificationCreateOrEscalate("msk", 1, "ct", lmdatabase.NotificationDetails{}, 110, "ws-1")
+	if errEscalate != nil {
+		t.Fatalf("%+v", errEscalate)
+	}
+	_, errForward := store.NotificationForward(created.NotificationID, "nr", 120, "ws-1")
+	if errForward != nil {
+		t.Fatalf("%+v", errForward)
+	}
+	_, errConfirm := store.NotificationConfirm(created.NotificationID, 130, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errConfirm)
+	}
+	_, errCancel := store.NotificationCancel("ct", "nr", 140, "ws-1", "") // nothing open anymore
+	if errCancel != nil {
+		t.Fatalf("%+v", errCancel)
+	}
+
+	// then
+	id := created.NotificationID
+	assert.Equal(t, Event{Type: EventCreated, NotificationID: id, Department: "msk", Modality: "ct"}, <-subscription)
+	assert.Equal(t, Event{Type: EventUpdated, NotificationID: id, Department: "msk", Modality: "ct"}, <-subscription)
+	forwarded := <-subscription
+	assert.Equal(t, Event{Type: EventUpdated, NotificationID: id, Department: "nr", Modality: "ct", PreviousDepartment: "msk"}, forwarded)
+	assert.True(t, forwarded.Concerns("msk"))
+	assert.Equal(t, Event{Type: EventConfirmed, NotificationID: id, Department: "nr", Modality: "ct"}, <-subscription)
+	assert.Equal(t, 0, len(subscription))
+}
+
+// unreadableStore fails to read notifications after changing them
+type unreadableStore struct {
+	lmdatabase.Store
+}
+
+func (store unreadableStore) NotificationGetByID(notificationID string) (*lmdatabase.Notification, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestUnitStoreShouldNotFailCommittedChangesWhenPublishingFails(t *testing.T) {
+
+	// given
+	bus := New()
+	store := NewStore(unreadableStore{lmdatabase.NewMemoryStore()}, bus)
+	subscription := bus.Subscribe()
+
+	first, errCreate := store.NotificationCreateOrEscalate("msk", 3, "ct", lmdatabase.NotificationDetails{}, 100, "ws-1")
+	if errCreate != nil {
+		t.Fatalf("%+v", errCreate)
+	}
+	second, errCreate := store.NotificationCreateOrEscalate("msk", 3, "mr", lmdatabase.NotificationDetails{}, 100, "ws-1")
+	if errCreate != nil {
+		t.Fatalf("%+v", errCreate)
+	}
+	<-subscription
+	<-subscription
+
+	// when
+	forwarded, errForward := store.NotificationForward(first.NotificationID, "nr", 110, "ws-1")
+	rowsAffected, errConfirm := store.NotificationConfirm(second.NotificationID, 120, "ws-1", "")
+
+	// then
+	assert.NoError(t, errForward)
+	assert.Equal(t, "nr", forwarded.NewValue)
+	assert.NoError(t, errConfirm)
+	assert.Equal(t, int64(1), rowsAffected)
+	assert.Equal(t, 0, len(subscription))
+}
@@ -0,0 +1,105 @@
+package eventbus
+
+import (
+	"log"
+
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// publishingStore publishes the changes of notifications made through the store
+type publishingStore struct {
+	lmdatabase.Store
+	bus *Bus
+}
+
+// NewStore returns the store that publishes an event on the bus after every change of a notification
+func NewStore(store lmdatabase.Store, bus *Bus) lmdatabase.Store {
+	return &publishingStore{Store: store, bus: bus}
+}
+
+func (store *publishingStore) NotificationInsert(department string, priority int, modality string, createdAt int64) (string, error) {
+	notificationID, errInsert := store.Store.NotificationInsert(department, priority, modality, createdAt)
+	if errInsert != nil {
+		return "", errInsert
+	}
+
+	store.bus.Publish(Event{Type: EventCreated, NotificationID: notificationID, Department: department, Modality: modality})
+	return notificationID, nil
+}
+
+func (store *publishingStore) NotificationCreateOrEscalate(department string, priority int, modality string, details lmdatabase.NotificationDetails, now int64, clientAddress string) (*lmdatabase.NotificationEvent, error) {
+	event, errCreateOrEscalate := store.Store.NotificationCreateOrEscalate(department, priority, modality, details, now, clientAddress)
+	if errCreateOrEscalate != nil {
+		return nil, errCreateOrEscalate
+	}
+
+	eventType := EventUpdated
+	if event.EventType == lmdatabase.NotificationEventCreated {
+		eventType = EventCreated
+	}
+
+	store.bus.Publish(Event{Type: eventType, NotificationID: event.NotificationID, Department: department, Modality: modality})
+	return event, nil
+}
+
+func (store *publishingStore) NotificationCancel(modality string, department string, cancelledAt int64, cancelledBy string, clientAddress string) (*lmdatabase.Notification, error) {
+	notification, errCancel := store.Store.NotificationCancel(modality, department, cancelledAt, cancelledBy, clientAddress)
+	if errCancel != nil || notification == nil {
+		return notification, errCancel
+	}
+
+	store.bus.Publish(Event{Type: EventCancelled, NotificationID: notification.NotificationID, Department: department, Modality: modality})
+	return notification, nil
+}
+
+func (store *publishingStore) NotificationChangePriority(notificationID string, priority int, now int64, clientAddress string) (*lmdatabase.Notification, error) {
+	notification, errChangePriority := store.Store.NotificationChangePriority(notificationID, priority, now, clientAddress)
+	if errChangePriority != nil || notification == nil {
+		return notification, errChangePriority
+	}
+
+	store.bus.Publish(Event{Type: EventUpdated, NotificationID: notificationID, Department: notification.DepartmentID, Modality: notification.Modality})
+	return notification, nil
+}
+
+func (store *publishingStore) NotificationConfirm(notificationID string, now int64, confirmedBy string, clientAddress string) (int64, error) {
+	rowsAffected, errConfirm := store.Store.NotificationConfirm(notificationID, now, confirmedBy, clientAddress)
+	if errConfirm != nil || rowsAffected == 0 {
+		return rowsAffected, errConfirm
+	}
+
+	store.publish(EventConfirmed, notificationID, "")
+	return rowsAffected, nil
+}
+
+func (store *publishingStore) NotificationForward(notificationID string, department string, now int64, clientAddress string) (*lmdatabase.NotificationEvent, error) {
+	event, errForward := store.Store.NotificationForward(notificationID, department, now, clientAddress)
+	if errForward != nil || event == nil {
+		return event, errForward
+	}
+
+	store.publish(EventUpdated, notificationID, event.PreviousValue)
+	return event, nil
+}
+
+// publish publishes the event of the notification after reading its department and modality; the change is committed
+// already, so an error of the read is logged and does not fail the change
+func (store *publishingStore) publish(eventType string, notificationID string, previousDepartment string) {
+	notification, errGetByID := store.Store.NotificationGetByID(notificationID)
+	if errGetByID != nil {
+		log.Printf("%+v", errGetByID)
+		return
+	}
+
+	if notification == nil {
+		return
+	}
+
+	store.bus.Publish(Event{
+		Type:               eventType,
+		NotificationID:     notificationID,
+		Department:         notification.DepartmentID,
+		Modality:           notification.Modality,
+		PreviousDepartment: previousDepartment,
+	})
+}
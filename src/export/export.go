@@ -0,0 +1,225 @@
+// Package export writes the notification history as CSV or XLSX for analysis in a spreadsheet
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tealeg/xlsx"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// supported export formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ContentTypes are the content types of the export formats
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+var (
+	header = []string{
+		"ID", "Abteilung", "Modalität", "Priorität", "Status",
+		"Erstellt", "Bestätigt", "Bestätigt durch", "Zurückgenommen", "Zurückgenommen durch",
+		"Sekunden bis Bestätigung", "Sekunden bis Zurücknahme",
+		"Nachricht", "Raum", "Accession-Nr.",
+	}
+	priorityNames = map[int]string{
+		1: "Hoch",
+		2: "Mittel",
+		3: "Tief",
+	}
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Filter keeps the notifications of the department and modality, an empty department or modality keeps all
+func Filter(notifications []lmdatabase.Notification, department string, modality string) []lmdatabase.Notification {
+	filtered := make([]lmdatabase.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		if department != "" && notification.DepartmentID != department {
+			continue
+		}
+		if modality != "" && notification.Modality != modality {
+			continue
+		}
+		filtered = append(filtered, notification)
+	}
+	return filtered
+}
+
+// ParsePeriod parses the from and to dates, both days are included and the period ends at now at the latest. Empty
+// dates default to the given number of days up to today.
+func ParsePeriod(fromValue string, toValue string, now time.Time, days int) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	from := today.AddDate(0, 0, 1-days)
+	if fromValue != "" {
+		date, errParse := time.ParseInLocation("2006-01-02", fromValue, now.Location())
+		if errParse != nil {
+			return from, now, errors.WithStack(errParse)
+		}
+		from = date
+	}
+
+	to := today.AddDate(0, 0, 1)
+	if toValue != "" {
+		date, errParse := time.ParseInLocation("2006-01-02", toValue, now.Location())
+		if errParse != nil {
+			return from, now, errors.WithStack(errParse)
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+
+	if to.After(now) {
+		to = now
+	}
+
+	if !from.Before(to) {
+		return from, to, errors.Errorf("the period from %s to %s is empty", fromValue, toValue)
+	}
+
+	return from, to, nil
+}
+
+// Write writes the notifications in the format, times are in the location
+func Write(w io.Writer, format string, notifications []lmdatabase.Notification, location *time.Location) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, notifications, location)
+	case FormatXLSX:
+		return writeXLSX(w, notifications, location)
+	}
+	return errors.Errorf("unknown export format %s", format)
+}
+
+func status(notification lmdatabase.Notification) string {
+	switch {
+	case notification.ConfirmedAt != -1:
+		return "Bestätigt"
+	case notification.CancelledAt != -1:
+		return "Zurückgenommen"
+	}
+	return "Offen"
+}
+
+// escapeFormula prefixes values that a spreadsheet application would evaluate as formula with an apostrophe, so text
+// entered by users can't run formulas when the export is opened
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func writeCSV(w io.Writer, notifications []lmdatabase.Notification, location *time.Location) error {
+	// the byte order mark makes spreadsheet applications read the file as utf-8
+	if _, errWrite := w.Write([]byte("\xef\xbb\xbf")); errWrite != nil {
+		return errors.WithStack(errWrite)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+
+	if errWrite := writer.Write(header); errWrite != nil {
+		return errors.WithStack(errWrite)
+	}
+
+	formatTime := func(at int64) string {
+		if at == -1 {
+			return ""
+		}
+		return time.Unix(at, 0).In(location).Format(timeLayout)
+	}
+	formatDuration := func(at int64, createdAt int64) string {
+		if at == -1 {
+			return ""
+		}
+		return strconv.FormatInt(at-createdAt, 10)
+	}
+
+	for _, notification := range notifications {
+		record := []string{
+			escapeFormula(notification.NotificationID),
+			escapeFormula(notification.DepartmentID),
+			escapeFormula(notification.Modality),
+			priorityNames[notification.Priority],
+			status(notification),
+			formatTime(notification.CreatedAt),
+			formatTime(notification.ConfirmedAt),
+			escapeFormula(notification.ConfirmedBy),
+			formatTime(notification.CancelledAt),
+			escapeFormula(notification.CancelledBy),
+			formatDuration(notification.ConfirmedAt, notification.CreatedAt),
+			formatDuration(notification.CancelledAt, notification.CreatedAt),
+			escapeFormula(notification.Message),
+			escapeFormula(notification.Room),
+			escapeFormula(notification.AccessionNumber),
+		}
+		if errWrite := writer.Write(record); errWrite != nil {
+			return errors.WithStack(errWrite)
+		}
+	}
+
+	writer.Flush()
+	return errors.WithStack(writer.Error())
+}
+
+func writeXLSX(w io.Writer, notifications []lmdatabase.Notification, location *time.Location) error {
+	file := xlsx.NewFile()
+
+	sheet, errAddSheet := file.AddSheet("Visierungen")
+	if errAddSheet != nil {
+		return errors.WithStack(errAddSheet)
+	}
+
+	headerRow := sheet.AddRow()
+	for _, title := range header {
+		headerRow.AddCell().SetString(title)
+	}
+
+	// spreadsheet times have no time zone, they are written as the wall clock time of the location
+	timeOptions := xlsx.DateTimeOptions{Location: location, ExcelTimeFormat: "yyyy-mm-dd hh:mm:ss"}
+
+	addTime := func(row *xlsx.Row, at int64) {
+		cell := row.AddCell()
+		if at != -1 {
+			cell.SetDateWithOptions(time.Unix(at, 0), timeOptions)
+		}
+	}
+	addDuration := func(row *xlsx.Row, at int64, createdAt int64) {
+		cell := row.AddCell()
+		if at != -1 {
+			cell.SetInt64(at - createdAt)
+		}
+	}
+
+	for _, notification := range notifications {
+		row := sheet.AddRow()
+		row.AddCell().SetString(notification.NotificationID)
+		row.AddCell().SetString(notification.DepartmentID)
+		row.AddCell().SetString(notification.Modality)
+		row.AddCell().SetString(priorityNames[notification.Priority])
+		row.AddCell().SetString(status(notification))
+		addTime(row, notification.CreatedAt)
+		addTime(row, notification.ConfirmedAt)
+		row.AddCell().SetString(notification.ConfirmedBy)
+		addTime(row, notification.CancelledAt)
+		row.AddCell().SetString(notification.CancelledBy)
+		addDuration(row, notification.ConfirmedAt, notification.CreatedAt)
+		addDuration(row, notification.CancelledAt, notification.CreatedAt)
+		row.AddCell().SetString(notification.Message)
+		row.AddCell().SetString(notification.Room)
+		row.AddCell().SetString(notification.AccessionNumber)
+	}
+
+	return errors.WithStack(file.Write(w))
+}
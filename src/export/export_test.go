@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tealeg/xlsx"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+var location = time.FixedZone("UTC+1", 3600)
+
+var notifications = []lmdatabase.Notification{
+	{NotificationID: "1", DepartmentID: "msk", Modality: "ct", Priority: 1, CreatedAt: 1577833200, ConfirmedAt: 1577833290, CancelledAt: -1, ConfirmedBy: "ws-1",
+		NotificationDetails: lmdatabase.NotificationDetails{Message: "Kontrastmittel; bitte prüfen", Room: "CT 1", AccessionNumber: "A1"}},
+	{NotificationID: "2", DepartmentID: "nr", Modality: "mr", Priority: 3, CreatedAt: 1577833300, ConfirmedAt: -1, CancelledAt: 1577833330, CancelledBy: "ws-2"},
+	{NotificationID: "3", DepartmentID: "nr", Modality: "ct", Priority: 2, CreatedAt: 1577833400, ConfirmedAt: -1, CancelledAt: -1},
+}
+
+func TestUnitShouldWriteCSV(t *testing.T) {
+
+	// given
+	var buffer bytes.Buffer
+
+	// when
+	errWrite := Write(&buffer, FormatCSV, notifications, location)
+
+	// then
+	assert.Nil(t, errWrite)
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(buffer.Bytes(), []byte("\xef\xbb\xbf"))))
+	reader.Comma = ';'
+	records, errRead := reader.ReadAll()
+	assert.Nil(t, errRead)
+
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, header, records[0])
+	assert.Equal(t, []string{"1", "msk", "ct", "Hoch", "Bestätigt", "2020-01-01 00:00:00", "2020-01-01 00:01:30", "ws-1", "", "",
+		"90", "", "Kontrastmittel; bitte prüfen", "CT 1", "A1"}, records[1])
+	assert.Equal(t, []string{"2", "nr", "mr", "Tief", "Zurückgenommen", "2020-01-01 00:01:40", "", "", "2020-01-01 00:02:10", "ws-2",
+		"", "30", "", "", ""}, records[2])
+	assert.Equal(t, "Offen", records[3][4])
+}
+
+func TestUnitShouldEscapeFormulasInCSV(t *testing.T) {
+
+	// given
+	var buffer bytes.Buffer
+
+	malicious := []lmdatabase.Notification{
+		{NotificationID: "1", DepartmentID: "msk", Modality: "ct", Priority: 1, CreatedAt: 1577833200, ConfirmedAt: 1577833290, CancelledAt: -1, ConfirmedBy: "@SUM(1+1)",
+			NotificationDetails: lmdatabase.NotificationDetails{Message: "=HYPERLINK(\"http://example.com\")", Room: "+1", AccessionNumber: "-1"}},
+		{NotificationID: "2", DepartmentID: "nr", Modality: "mr", Priority: 3, CreatedAt: 1577833300, ConfirmedAt: -1, CancelledAt: 1577833330, CancelledBy: "\t=1",
+			NotificationDetails: lmdatabase.NotificationDetails{Message: "\r=1", Room: "CT = 1"}},
+	}
+
+	// when
+	errWrite := Write(&buffer, FormatCSV, malicious, location)
+
+	// then
+	assert.Nil(t, errWrite)
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(buffer.Bytes(), []byte("\xef\xbb\xbf"))))
+	reader.Comma = ';'
+	records, errRead := reader.ReadAll()
+	assert.Nil(t, errRead)
+
+	assert.Equal(t, "'@SUM(1+1)", records[1][7])
+	assert.Equal(t, "'=HYPERLINK(\"http://example.com\")", records[1][12])
+	assert.Equal(t, "'+1", records[1][13])
+	assert.Equal(t, "'-1", records[1][14])
+	assert.Equal(t, "'\t=1", records[2][9])
+	assert.Equal(t, "'\r=1", records[2][12])
+	assert.Equal(t, "CT = 1", records[2][13])
+}
+
+func TestUnitShouldWriteXLSX(t *testing.T) {
+
+	// given
+	var buffer bytes.Buffer
+
+	// when
+	errWrite := Write(&buffer, FormatXLSX, notifications, location)
+
+	// then
+	assert.Nil(t, errWrite)
+
+	file, errOpen := xlsx.OpenBinary(buffer.Bytes())
+	assert.Nil(t, errOpen)
+
+	rows := file.Sheets[0].Rows
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, "Abteilung", rows[0].Cells[1].String())
+	assert.Equal(t, "msk", rows[1].Cells[1].String())
+
+	createdAt, errTime := rows[1].Cells[5].GetTime(false)
+	assert.Nil(t, errTime)
+	assert.Equal(t, "2020-01-01 00:00:00", createdAt.Format("2006-01-02 15:04:05"))
+
+	seconds, errInt := rows[1].Cells[10].Int64()
+	assert.Nil(t, errInt)
+	assert.Equal(t, int64(90), seconds)
+	assert.Equal(t, "", rows[1].Cells[11].Value)
+}
+
+func TestUnitShouldFailForUnknownFormat(t *testing.T) {
+
+	// when
+	errWrite := Write(&bytes.Buffer{}, "pdf", notifications, location)
+
+	// then
+	assert.NotNil(t, errWrite)
+}
+
+func TestUnitShouldFilterByDepartmentAndModality(t *testing.T) {
+
+	// then
+	assert.Equal(t, 3, len(Filter(notifications, "", "")))
+	assert.Equal(t, 2, len(Filter(notifications, "nr", "")))
+	assert.Equal(t, []lmdatabase.Notification{notifications[2]}, Filter(notifications, "nr", "ct"))
+}
+
+func TestUnitShouldParsePeriod(t *testing.T) {
+
+	// given
+	now := time.Date(2020, 1, 31, 12, 0, 0, 0, location)
+
+	// when
+	from, to, errParse := ParsePeriod("2020-01-01", "2020-01-10", now, 30)
+	defaultFrom, defaultTo, errParseDefault := ParsePeriod("", "", now, 30)
+	_, _, errParseInvalid := ParsePeriod("01.01.2020", "", now, 30)
+	_, _, errParseEmpty := ParsePeriod("2020-01-10", "2020-01-09", now, 30)
+
+	// then
+	assert.Nil(t, errParse)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, location), from)
+	assert.Equal(t, time.Date(2020, 1, 11, 0, 0, 0, 0, location), to)
+
+	assert.Nil(t, errParseDefault)
+	assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, location), defaultFrom)
+	assert.Equal(t, now, defaultTo)
+
+	assert.NotNil(t, errParseInvalid)
+	assert.NotNil(t, errParseEmpty)
+}
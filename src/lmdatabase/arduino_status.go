@@ -13,14 +13,25 @@ type ArduinoStatus struct {
 }
 
 // ArduinoStatusInsert ..
-func ArduinoStatusInsert(db *sql.DB, status ArduinoStatus) error {
+func ArduinoStatusInsert(db *DB, status ArduinoStatus) error {
 
-	insertStmt, err := db.Prepare(`
+	upsert := `
 	INSERT INTO
 		ArduinoStatus
 	VALUES( ?, ? )
 		ON DUPLICATE KEY UPDATE
-	statusAt =?`)
+	statusAt =?`
+
+	if db.Driver != DriverMySQL {
+		upsert = `
+		INSERT INTO
+			ArduinoStatus
+		VALUES( ?, ? )
+			ON CONFLICT (departmentId) DO UPDATE SET
+		statusAt =?`
+	}
+
+	insertStmt, err := db.Prepare(upsert)
 
 	if err != nil {
 		return errors.WithStack(err)
@@ -37,7 +48,7 @@ func ArduinoStatusInsert(db *sql.DB, status ArduinoStatus) error {
 }
 
 // ArduinoStatusQueryWithin5MinutesFromNow ..
-func ArduinoStatusQueryWithin5MinutesFromNow(db *sql.DB, department string, now int64) (*ArduinoStatus, error) {
+func ArduinoStatusQueryWithin5MinutesFromNow(db *DB, department string, now int64) (*ArduinoStatus, error) {
 
 	queryStmt := `
 	SELECT
@@ -0,0 +1,114 @@
+package lmdatabase
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Device is a light registered by its heartbeats
+type Device struct {
+	DeviceID        string
+	DepartmentID    string
+	Location        string
+	FirmwareVersion string
+	LastSeenAt      int64
+	RemoteAddress   string
+	Unauthenticated bool // the last heartbeat had no valid token although the department has device tokens
+}
+
+// SeenWithin5MinutesFrom reports whether the device sent a heartbeat in the 5 minutes before now
+func (device Device) SeenWithin5MinutesFrom(now int64) bool {
+	return device.LastSeenAt > now-DeviceHeartbeatTolerance
+}
+
+// DeviceHeartbeat registers the device or updates its registration and records its uptime if the heartbeat is
+// authenticated, an empty location or firmware version keeps the registered one
+func DeviceHeartbeat(db *DB, device Device) error {
+
+	upsert := `
+	INSERT INTO
+		Device (deviceId, departmentId, location, firmwareVersion, lastSeenAt, remoteAddress, unauthenticated)
+	VALUES( ?, ?, ?, ?, ?, ?, ? )
+		ON DUPLICATE KEY UPDATE
+	departmentId = VALUES(departmentId),
+	location = CASE WHEN VALUES(location) = '' THEN location ELSE VALUES(location) END,
+	firmwareVersion = CASE WHEN VALUES(firmwareVersion) = '' THEN firmwareVersion ELSE VALUES(firmwareVersion) END,
+	lastSeenAt = VALUES(lastSeenAt),
+	remoteAddress = VALUES(remoteAddress),
+	unauthenticated = VALUES(unauthenticated)`
+
+	if db.Driver != DriverMySQL {
+		upsert = `
+		INSERT INTO
+			Device (deviceId, departmentId, location, firmwareVersion, lastSeenAt, remoteAddress, unauthenticated)
+		VALUES( ?, ?, ?, ?, ?, ?, ? )
+			ON CONFLICT (deviceId) DO UPDATE SET
+		departmentId = excluded.departmentId,
+		location = CASE WHEN excluded.location = '' THEN Device.location ELSE excluded.location END,
+		firmwareVersion = CASE WHEN excluded.firmwareVersion = '' THEN Device.firmwareVersion ELSE excluded.firmwareVersion END,
+		lastSeenAt = excluded.lastSeenAt,
+		remoteAddress = excluded.remoteAddress,
+		unauthenticated = excluded.unauthenticated`
+	}
+
+	upsertStmt, err := db.Prepare(upsert)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer upsertStmt.Close()
+
+	unauthenticated := 0
+	if device.Unauthenticated {
+		unauthenticated = 1
+	}
+
+	_, errExec := upsertStmt.Exec(device.DeviceID, device.DepartmentID, device.Location, device.FirmwareVersion, device.LastSeenAt, device.RemoteAddress, unauthenticated)
+	if errExec != nil {
+		return errors.WithStack(errExec)
+	}
+
+	// heartbeats without valid token may be forged, the light is only considered up for authenticated ones
+	if device.Unauthenticated {
+		return nil
+	}
+
+	return deviceUptimeExtend(db, device)
+}
+
+// DeviceGetByDepartment ..
+func DeviceGetByDepartment(db *DB, department string) (*[]Device, error) {
+
+	queryStmt := `
+	SELECT
+		deviceId, departmentId, location, firmwareVersion, lastSeenAt, remoteAddress, unauthenticated
+	FROM
+		Device
+	WHERE
+		departmentId = ?
+	ORDER BY
+		deviceId`
+
+	rows, errQuery := db.Query(queryStmt, department)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	defer rows.Close()
+
+	devices := make([]Device, 0)
+
+	for rows.Next() {
+		var device Device
+		if errRowScan := rows.Scan(&device.DeviceID, &device.DepartmentID, &device.Location, &device.FirmwareVersion,
+			&device.LastSeenAt, &device.RemoteAddress, &device.Unauthenticated); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		devices = append(devices, device)
+	}
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, errors.WithStack(errRows)
+	}
+
+	return &devices, nil
+}
@@ -0,0 +1,145 @@
+package lmdatabase
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceToken is the credential of a light, only the hash of the token is stored
+type DeviceToken struct {
+	DeviceID     string
+	DepartmentID string
+	TokenHash    string
+	Secret       string // signs the requests of the light, empty if it sends its token instead
+	CreatedAt    int64
+}
+
+// DeviceTokenInsert ..
+func DeviceTokenInsert(db *DB, token DeviceToken) error {
+	insertStmt, err := db.Prepare(`
+	INSERT INTO
+		DeviceToken (deviceId, departmentId, tokenHash, secret, createdAt)
+	VALUES( ?, ?, ?, ?, ? )`)
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer insertStmt.Close()
+
+	_, errExec := insertStmt.Exec(token.DeviceID, token.DepartmentID, token.TokenHash, token.Secret, token.CreatedAt)
+	if errExec != nil {
+		return errors.WithStack(errExec)
+	}
+
+	return nil
+}
+
+// DeviceTokenGetByHash returns nil if no device has the token
+func DeviceTokenGetByHash(db *DB, tokenHash string) (*DeviceToken, error) {
+	var token DeviceToken
+
+	errQuery := db.QueryRow(`
+	SELECT
+		deviceId, departmentId, tokenHash, secret, createdAt
+	FROM
+		DeviceToken
+	WHERE
+		tokenHash = ?`, tokenHash).Scan(&token.DeviceID, &token.DepartmentID, &token.TokenHash, &token.Secret, &token.CreatedAt)
+
+	if errQuery == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	return &token, nil
+}
+
+// DeviceTokenGetByDevice returns nil if the device has no token
+func DeviceTokenGetByDevice(db *DB, deviceID string) (*DeviceToken, error) {
+	var token DeviceToken
+
+	errQuery := db.QueryRow(`
+	SELECT
+		deviceId, departmentId, tokenHash, secret, createdAt
+	FROM
+		DeviceToken
+	WHERE
+		deviceId = ?`, deviceID).Scan(&token.DeviceID, &token.DepartmentID, &token.TokenHash, &token.Secret, &token.CreatedAt)
+
+	if errQuery == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	return &token, nil
+}
+
+// DeviceTokenGetByDepartment returns the tokens of the department, of all departments if it is empty, ordered by
+// department and device
+func DeviceTokenGetByDepartment(db *DB, department string) (*[]DeviceToken, error) {
+	queryStmt := `
+	SELECT
+		deviceId, departmentId, tokenHash, secret, createdAt
+	FROM
+		DeviceToken`
+
+	var args []interface{}
+	if department != "" {
+		queryStmt += `
+	WHERE
+		departmentId = ?`
+		args = append(args, department)
+	}
+
+	rows, errQuery := db.Query(queryStmt+`
+	ORDER BY
+		departmentId, deviceId`, args...)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	defer rows.Close()
+
+	tokens := make([]DeviceToken, 0)
+
+	for rows.Next() {
+		var token DeviceToken
+		if errRowScan := rows.Scan(&token.DeviceID, &token.DepartmentID, &token.TokenHash, &token.Secret, &token.CreatedAt); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, errors.WithStack(errRows)
+	}
+
+	return &tokens, nil
+}
+
+// DeviceTokenDelete returns the number of deleted tokens, 0 if the device has none
+func DeviceTokenDelete(db *DB, deviceID string) (int64, error) {
+	result, errExec := db.Exec(`
+	DELETE FROM
+		DeviceToken
+	WHERE
+		deviceId = ?`, deviceID)
+	if errExec != nil {
+		return 0, errors.WithStack(errExec)
+	}
+
+	rowsAffected, errRowsAffected := result.RowsAffected()
+	if errRowsAffected != nil {
+		return 0, errors.WithStack(errRowsAffected)
+	}
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,183 @@
+package lmdatabase
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceHeartbeatTolerance is the number of seconds between two heartbeats of a device up to which it is considered
+// up in between
+const DeviceHeartbeatTolerance = 300
+
+// DeviceUptimeInterval is a period in which a device sent heartbeats at most DeviceHeartbeatTolerance seconds apart
+type DeviceUptimeInterval struct {
+	DeviceID     string
+	DepartmentID string
+	StartedAt    int64
+	EndedAt      int64
+}
+
+// DeviceOutage is a period without heartbeats, from the last heartbeat before it or the start of the reported period
+type DeviceOutage struct {
+	StartedAt int64
+	EndedAt   int64
+}
+
+// DeviceUptime is the availability of a device, or of a department with any of its devices, over a period
+type DeviceUptime struct {
+	From             int64
+	To               int64
+	UptimePercentage float64
+	Outages          []DeviceOutage
+}
+
+// deviceUptimeExtend extends the current uptime interval of the device to its heartbeat or starts a new one
+func deviceUptimeExtend(db *DB, device Device) error {
+
+	queryStmt := `
+	SELECT
+		startedAt, endedAt
+	FROM
+		DeviceUptime
+	WHERE
+		deviceId = ?
+	ORDER BY
+		startedAt DESC
+	LIMIT 1`
+
+	var startedAt, endedAt int64
+	errRowScan := db.QueryRow(queryStmt, device.DeviceID).Scan(&startedAt, &endedAt)
+	if errRowScan != nil && errRowScan != sql.ErrNoRows {
+		return errors.WithStack(errRowScan)
+	}
+
+	if errRowScan == nil && endedAt >= device.LastSeenAt {
+		return nil
+	}
+
+	if errRowScan == nil && endedAt >= device.LastSeenAt-DeviceHeartbeatTolerance {
+		_, errExec := db.Exec(`
+		UPDATE
+			DeviceUptime
+		SET
+			endedAt = ?
+		WHERE
+			deviceId = ?
+		AND
+			startedAt = ?`, device.LastSeenAt, device.DeviceID, startedAt)
+		return errors.WithStack(errExec)
+	}
+
+	_, errExec := db.Exec(`
+	INSERT INTO
+		DeviceUptime (deviceId, departmentId, startedAt, endedAt)
+	VALUES( ?, ?, ?, ? )`, device.DeviceID, device.DepartmentID, device.LastSeenAt, device.LastSeenAt)
+	if errExec != nil && !isUniqueViolation(errExec) { // a concurrent heartbeat started the interval already
+		return errors.WithStack(errExec)
+	}
+
+	return nil
+}
+
+// DeviceUptimeGetByDepartment returns the uptime intervals of the devices of a department that overlap with the period
+// from .. to, ordered by device and start
+func DeviceUptimeGetByDepartment(db *DB, department string, from int64, to int64) (*[]DeviceUptimeInterval, error) {
+
+	queryStmt := `
+	SELECT
+		deviceId, departmentId, startedAt, endedAt
+	FROM
+		DeviceUptime
+	WHERE
+		departmentId = ?
+	AND
+		endedAt >= ?
+	AND
+		startedAt <= ?
+	ORDER BY
+		deviceId, startedAt`
+
+	rows, errQuery := db.Query(queryStmt, department, from, to)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	defer rows.Close()
+
+	intervals := make([]DeviceUptimeInterval, 0)
+
+	for rows.Next() {
+		var interval DeviceUptimeInterval
+		if errRowScan := rows.Scan(&interval.DeviceID, &interval.DepartmentID, &interval.StartedAt, &interval.EndedAt); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		intervals = append(intervals, interval)
+	}
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, errors.WithStack(errRows)
+	}
+
+	return &intervals, nil
+}
+
+// DeviceUptimeFromIntervals computes the uptime over the period from .. to, the intervals may overlap, e.g. when they
+// belong to several devices of a department, gaps of up to DeviceHeartbeatTolerance seconds are no outages
+func DeviceUptimeFromIntervals(intervals []DeviceUptimeInterval, from int64, to int64) DeviceUptime {
+	uptime := DeviceUptime{
+		From:    from,
+		To:      to,
+		Outages: make([]DeviceOutage, 0),
+	}
+
+	if to <= from {
+		return uptime
+	}
+
+	sorted := make([]DeviceUptimeInterval, len(intervals))
+	copy(sorted, intervals)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartedAt < sorted[j].StartedAt
+	})
+
+	var downtime int64
+	addOutage := func(startedAt int64, endedAt int64) {
+		if endedAt-startedAt <= DeviceHeartbeatTolerance {
+			return
+		}
+		uptime.Outages = append(uptime.Outages, DeviceOutage{StartedAt: startedAt, EndedAt: endedAt})
+		downtime += endedAt - startedAt
+	}
+
+	lastSeenAt := from
+	for _, interval := range sorted {
+		if interval.EndedAt < from || interval.StartedAt > to {
+			continue
+		}
+		if interval.StartedAt > lastSeenAt {
+			addOutage(lastSeenAt, interval.StartedAt)
+		}
+		lastSeenAt = max64(lastSeenAt, interval.EndedAt)
+	}
+	addOutage(min64(lastSeenAt, to), to)
+
+	uptime.UptimePercentage = float64(to-from-downtime) * 100 / float64(to-from)
+
+	return uptime
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package lmdatabase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitShouldComputeUptimeWithOutages(t *testing.T) {
+
+	// given
+	intervals := []DeviceUptimeInterval{
+		{DeviceID: "light-1", StartedAt: 2000, EndedAt: 3000},
+		{DeviceID: "light-1", StartedAt: 1000, EndedAt: 1500},
+		{DeviceID: "light-1", StartedAt: 3200, EndedAt: 3500}, // gap within the tolerance
+	}
+
+	// when
+	uptime := DeviceUptimeFromIntervals(intervals, 0, 5000)
+
+	// then
+	assert.Equal(t, []DeviceOutage{{StartedAt: 0, EndedAt: 1000}, {StartedAt: 1500, EndedAt: 2000}, {StartedAt: 3500, EndedAt: 5000}}, uptime.Outages)
+	assert.Equal(t, float64(40), uptime.UptimePercentage)
+}
+
+func TestUnitShouldComputeUptimeOfOverlappingIntervalsClippedToPeriod(t *testing.T) {
+
+	// given
+	intervals := []DeviceUptimeInterval{
+		{DeviceID: "light-1", StartedAt: 500, EndedAt: 2000},
+		{DeviceID: "light-2", StartedAt: 1500, EndedAt: 2500},
+		{DeviceID: "light-2", StartedAt: 3000, EndedAt: 6000},
+	}
+
+	// when
+	uptime := DeviceUptimeFromIntervals(intervals, 1000, 4000)
+
+	// then
+	assert.Equal(t, []DeviceOutage{{StartedAt: 2500, EndedAt: 3000}}, uptime.Outages)
+	assert.InDelta(t, 83.33, uptime.UptimePercentage, 0.01)
+}
+
+func TestUnitShouldReportWholePeriodAsOutageWithoutIntervals(t *testing.T) {
+
+	// when
+	uptime := DeviceUptimeFromIntervals([]DeviceUptimeInterval{}, 1000, 2000)
+
+	// then
+	assert.Equal(t, []DeviceOutage{{StartedAt: 1000, EndedAt: 2000}}, uptime.Outages)
+	assert.Equal(t, float64(0), uptime.UptimePercentage)
+}
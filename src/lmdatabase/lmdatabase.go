@@ -4,22 +4,222 @@ import (
 	"database/sql"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"strconv"
 	"strings"
 
-	_ "github.com/go-sql-driver/mysql" // mysql driver ..
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 	"github.com/usb-radiology/light-messenger/src/configuration"
 )
 
+// DB is a database connection together with the driver it was opened with, so that queries can account for
+// differences between the sql dialects
+type DB struct {
+	*sql.DB
+	Driver string
+}
+
 // GetDB ..
-func GetDB(initConfig *configuration.Configuration) (*sql.DB, error) {
-	conn := initConfig.Database.Username + ":" + initConfig.Database.Password + "@tcp(" + initConfig.Database.Host + ":" + strconv.Itoa(initConfig.Database.Port) + ")/" + initConfig.Database.DBName
-	db, err := sql.Open("mysql", conn)
+func GetDB(initConfig *configuration.Configuration) (*DB, error) {
+	driver := GetDriver(initConfig)
+
+	switch driver {
+	case DriverMySQL:
+		conn := initConfig.Database.Username + ":" + initConfig.Database.Password + "@tcp(" + initConfig.Database.Host + ":" + strconv.Itoa(initConfig.Database.Port) + ")/" + initConfig.Database.DBName
+		db, err := sql.Open("mysql", conn)
+		if err != nil {
+			log.Fatalf("%+v", errors.WithStack(err))
+		}
+		return &DB{DB: db, Driver: driver}, nil
+
+	case DriverPostgres:
+		query := url.Values{}
+		if initConfig.Database.SSLMode != "" {
+			query.Set("sslmode", initConfig.Database.SSLMode)
+		}
+		conn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(initConfig.Database.Username, initConfig.Database.Password),
+			Host:     initConfig.Database.Host + ":" + strconv.Itoa(initConfig.Database.Port),
+			Path:     "/" + initConfig.Database.DBName,
+			RawQuery: query.Encode(),
+		}
+		db, err := sql.Open("postgres", conn.String())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &DB{DB: db, Driver: driver}, nil
+
+	case DriverSQLite:
+		if initConfig.Database.Path == "" {
+			return nil, errors.New("the sqlite database driver requires Database.Path")
+		}
+		db, err := sql.Open("sqlite3", sqliteDSN(initConfig.Database.Path))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// sqlite only supports a single writer, serialize all access instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+		return &DB{DB: db, Driver: driver}, nil
+	}
+
+	return nil, errors.Errorf("database driver %s does not support sql", driver)
+}
+
+// sqliteDSN returns the file uri of the database at the path, a ? or # in the path is escaped so it does not start the
+// options and sqlite decodes it back
+func sqliteDSN(path string) string {
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   strings.NewReplacer("%", "%25", "?", "%3F", "#", "%23").Replace(path),
+		RawQuery: url.Values{"_busy_timeout": {"5000"}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// Tx is a transaction of a DB, it rebinds the query placeholders like the DB does
+type Tx struct {
+	*sql.Tx
+	Driver string
+}
+
+// preparer is implemented by both DB and Tx, so that statements can be shared between plain and transactional use
+type preparer interface {
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// rebind replaces the ? placeholders used throughout this package with the positional $n placeholders of postgres.
+// A ? within a string literal, quoted identifier or comment is no placeholder and kept as is.
+func rebind(driver string, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+
+	// segmentEnd returns the index after the terminator of the segment, the end of the query if it is unterminated
+	segmentEnd := func(from int, terminator string) int {
+		index := strings.Index(query[from:], terminator)
+		if index < 0 {
+			return len(query)
+		}
+		return from + index + len(terminator)
+	}
+
+	var rebound strings.Builder
+	position := 0
+	for i := 0; i < len(query); {
+		end := i + 1
+		switch {
+		case query[i] == '\'' || query[i] == '"':
+			// a doubled quote within the literal ends it and starts the next one, which keeps the same result
+			end = segmentEnd(i+1, query[i:i+1])
+		case strings.HasPrefix(query[i:], "--"):
+			end = segmentEnd(i+2, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			end = segmentEnd(i+2, "*/")
+		case query[i] == '?':
+			position++
+			rebound.WriteString("$" + strconv.Itoa(position))
+			i = end
+			continue
+		}
+
+		rebound.WriteString(query[i:end])
+		i = end
+	}
+
+	return rebound.String()
+}
+
+// forUpdate returns the clause that locks the selected rows until the end of the transaction, sqlite has no row locks
+// and serializes transactions instead
+func forUpdate(driver string) string {
+	if driver == DriverSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// isRetryable reports whether err is caused by a conflict with a concurrent transaction, i.e. a unique key violation,
+// a deadlock or a serialization failure, after which the transaction can be retried
+func isRetryable(err error) bool {
+	if isUniqueViolation(err) {
+		return true
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *mysql.MySQLError:
+		return cause.Number == 1213
+	case *pq.Error:
+		return cause.Code == "40001" || cause.Code == "40P01"
+	case sqlite3.Error:
+		return cause.Code == sqlite3.ErrBusy
+	}
+	return false
+}
+
+// isUniqueViolation reports whether err is caused by a violated unique key
+func isUniqueViolation(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *mysql.MySQLError:
+		return cause.Number == 1062
+	case *pq.Error:
+		return cause.Code == "23505"
+	case sqlite3.Error:
+		return cause.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// Prepare ..
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	return db.DB.Prepare(rebind(db.Driver, query))
+}
+
+// Exec ..
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(rebind(db.Driver, query), args...)
+}
+
+// Query ..
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(rebind(db.Driver, query), args...)
+}
+
+// QueryRow ..
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(rebind(db.Driver, query), args...)
+}
+
+// Begin ..
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
 	if err != nil {
-		log.Fatalf("%+v", errors.WithStack(err))
+		return nil, err
 	}
-	return db, nil
+	return &Tx{Tx: tx, Driver: db.Driver}, nil
+}
+
+// Prepare ..
+func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(rebind(tx.Driver, query))
+}
+
+// Exec ..
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(rebind(tx.Driver, query), args...)
+}
+
+// Query ..
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(rebind(tx.Driver, query), args...)
+}
+
+// QueryRow ..
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(rebind(tx.Driver, query), args...)
 }
 
 // ReadStatementsFromSQL ..
@@ -31,12 +231,16 @@ func ReadStatementsFromSQL(sqlFilePath string) (*[]string, error) {
 		return nil, errors.WithStack(errFileRead)
 	}
 
-	strStatements := strings.Split(string(fileContents), ";\n")
+	strStatements := splitStatements(string(fileContents))
 	return &strStatements, nil
 }
 
+func splitStatements(script string) []string {
+	return strings.Split(script, ";\n")
+}
+
 // ExecStatements ..
-func ExecStatements(db *sql.DB, sqlStatements []string) (*[]sql.Result, error) {
+func ExecStatements(db *DB, sqlStatements []string) (*[]sql.Result, error) {
 
 	results := make([]sql.Result, 0)
 
@@ -61,7 +265,7 @@ func ExecStatements(db *sql.DB, sqlStatements []string) (*[]sql.Result, error) {
 }
 
 // ExecStatement ..
-func ExecStatement(db *sql.DB, statement string) (sql.Result, error) {
+func ExecStatement(db *DB, statement string) (sql.Result, error) {
 
 	trimedStatement := strings.Trim(statement, " \n")
 
@@ -1,7 +1,8 @@
 package lmdatabase
 
 import (
-	"database/sql"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -11,7 +12,36 @@ import (
 
 var statements []string
 
-func GetTestDB(t *testing.T, initConfig *configuration.Configuration) *sql.DB {
+func TestUnitShouldRebindPlaceholdersForPostgres(t *testing.T) {
+	query := "SELECT a FROM b WHERE c = ? AND d = ?"
+
+	if rebind(DriverMySQL, query) != query {
+		t.Errorf("should not rebind mysql placeholders")
+	}
+
+	if rebound := rebind(DriverPostgres, query); rebound != "SELECT a FROM b WHERE c = $1 AND d = $2" {
+		t.Errorf("should rebind postgres placeholders, got %s", rebound)
+	}
+}
+
+func TestUnitShouldNotRebindQuestionMarksInLiteralsAndComments(t *testing.T) {
+	tests := map[string]string{
+		"SELECT '?', 'it''s ?' FROM b WHERE c = ?":       "SELECT '?', 'it''s ?' FROM b WHERE c = $1",
+		`SELECT "a?" FROM b WHERE c = ? AND d = ?`:       `SELECT "a?" FROM b WHERE c = $1 AND d = $2`,
+		"SELECT a -- why?\nFROM b WHERE c = ?":           "SELECT a -- why?\nFROM b WHERE c = $1",
+		"SELECT a /* why? */ FROM b WHERE c = ? /* ? */": "SELECT a /* why? */ FROM b WHERE c = $1 /* ? */",
+		"SELECT a FROM b WHERE c = ? AND d = 'open ?":    "SELECT a FROM b WHERE c = $1 AND d = 'open ?",
+		"SELECT a FROM b WHERE c = ? -- ?":               "SELECT a FROM b WHERE c = $1 -- ?",
+	}
+
+	for query, expected := range tests {
+		if rebound := rebind(DriverPostgres, query); rebound != expected {
+			t.Errorf("should rebind %s to %s, got %s", query, expected, rebound)
+		}
+	}
+}
+
+func GetTestDB(t *testing.T, initConfig *configuration.Configuration) *DB {
 	db, errDb := GetDB(initConfig)
 	if errDb != nil {
 		t.Fatal(errDb)
@@ -43,7 +73,11 @@ func GetTestDB(t *testing.T, initConfig *configuration.Configuration) *sql.DB {
 	return db
 }
 
-func setupTest(t *testing.T) *sql.DB {
+func setupTest(t *testing.T) *DB {
+	if testing.Short() {
+		t.Skip("skipping database integration test in short mode")
+	}
+
 	initConfig, err := configuration.LoadAndSetConfiguration(filepath.Join("..", "..", "config-sample.json"))
 	if err != nil {
 		t.Fatalf("%+v", errors.WithStack(err))
@@ -52,6 +86,106 @@ func setupTest(t *testing.T) *sql.DB {
 	return GetTestDB(t, initConfig)
 }
 
-func tearDownTest(t *testing.T, db *sql.DB) {
+func tearDownTest(t *testing.T, db *DB) {
+	db.Close()
+}
+
+// setupPostgresTest migrates and cleans the postgres database from config-sample-postgres.json
+func setupPostgresTest(t *testing.T) *DB {
+	if testing.Short() {
+		t.Skip("skipping database integration test in short mode")
+	}
+
+	initConfig, err := configuration.LoadAndSetConfiguration(filepath.Join("..", "..", "config-sample-postgres.json"))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	db, errDb := GetDB(initConfig)
+	if errDb != nil {
+		t.Fatal(errDb)
+	}
+
+	// postgres is an optional backend, `docker-compose up` starts it alongside mysql
+	if errPing := db.Ping(); errPing != nil {
+		db.Close()
+		t.Skipf("skipping postgres integration test, database not reachable: %v", errPing)
+	}
+
+	migrations, errLoad := MigrationsLoad(DriverPostgres)
+	if errLoad != nil {
+		t.Fatalf("%+v", errLoad)
+	}
+
+	_, errMigrateUp := MigrateUp(db, migrations, 1000)
+	if errMigrateUp != nil {
+		t.Fatalf("%+v", errMigrateUp)
+	}
+	db.Close()
+
+	return GetTestDB(t, initConfig)
+}
+
+// setupSQLiteTest creates a migrated sqlite database in a temporary directory, no database server is required
+func setupSQLiteTest(t *testing.T) (*DB, string) {
+	dir, errTempDir := ioutil.TempDir("", "light-messenger")
+	if errTempDir != nil {
+		t.Fatalf("%+v", errors.WithStack(errTempDir))
+	}
+
+	var initConfig configuration.Configuration
+	initConfig.Database.Driver = DriverSQLite
+	initConfig.Database.Path = filepath.Join(dir, "light-messenger.db")
+
+	db, errDb := GetDB(&initConfig)
+	if errDb != nil {
+		t.Fatalf("%+v", errDb)
+	}
+
+	migrations, errLoad := MigrationsLoad(DriverSQLite)
+	if errLoad != nil {
+		t.Fatalf("%+v", errLoad)
+	}
+
+	_, errMigrateUp := MigrateUp(db, migrations, 1000)
+	if errMigrateUp != nil {
+		t.Fatalf("%+v", errMigrateUp)
+	}
+
+	return db, dir
+}
+
+func TestIntegrationShouldOpenSQLiteDatabaseAtPathWithURICharacters(t *testing.T) {
+	dir, errTempDir := ioutil.TempDir("", "light-messenger")
+	if errTempDir != nil {
+		t.Fatalf("%+v", errors.WithStack(errTempDir))
+	}
+	defer os.RemoveAll(dir)
+
+	var initConfig configuration.Configuration
+	initConfig.Database.Driver = DriverSQLite
+	initConfig.Database.Path = filepath.Join(dir, "light?messenger#1%41.db")
+
+	db, errDb := GetDB(&initConfig)
+	if errDb != nil {
+		t.Fatalf("%+v", errDb)
+	}
+	defer db.Close()
+
+	if _, errExec := db.Exec("CREATE TABLE Test (id int)"); errExec != nil {
+		t.Fatalf("%+v", errors.WithStack(errExec))
+	}
+
+	if _, errStat := os.Stat(initConfig.Database.Path); errStat != nil {
+		t.Errorf("should create the database at the configured path: %v", errStat)
+	}
+
+	if dsn := sqliteDSN("data/light?messenger#1%41.db"); dsn != "file:data/light%3Fmessenger%231%2541.db?_busy_timeout=5000" {
+		t.Errorf("should escape the path of the dsn, got %s", dsn)
+	}
+}
+
+func tearDownSQLiteTest(t *testing.T, db *DB, dir string) {
 	db.Close()
+	os.RemoveAll(dir)
 }
@@ -0,0 +1,283 @@
+package lmdatabase
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	rice "github.com/GeertJohan/go.rice"
+	"github.com/pkg/errors"
+)
+
+const (
+	migrationSuffixUp   = ".up.sql"
+	migrationSuffixDown = ".down.sql"
+)
+
+var migrationsBox = rice.MustFindBox("../../res/migrations")
+
+// Migration is a versioned schema change read from res/migrations/<dialect>/<version>_<name>.(up|down).sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus ..
+type MigrationStatus struct {
+	Migration Migration
+	AppliedAt int64 // -1 when pending
+}
+
+// MigrationsLoad returns the embedded migrations of the given dialect ordered by version
+func MigrationsLoad(dialect string) ([]Migration, error) {
+	migrationsByVersion := make(map[int]*Migration)
+
+	errWalk := migrationsBox.Walk(dialect, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		fileName := filepath.Base(path)
+
+		version, name, up, errParse := parseMigrationFileName(fileName)
+		if errParse != nil {
+			return errParse
+		}
+
+		contents, errRead := migrationsBox.String(dialect + "/" + fileName)
+		if errRead != nil {
+			return errRead
+		}
+
+		migration, exists := migrationsByVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			migrationsByVersion[version] = migration
+		}
+
+		if migration.Name != name {
+			return errors.Errorf("migration %04d has conflicting names %s and %s", version, migration.Name, name)
+		}
+
+		if up {
+			migration.Up = contents
+		} else {
+			migration.Down = contents
+		}
+
+		return nil
+	})
+	if errWalk != nil {
+		return nil, errors.WithStack(errWalk)
+	}
+
+	migrations := make([]Migration, 0, len(migrationsByVersion))
+	for _, migration := range migrationsByVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, errors.Errorf("migration %04d_%s requires both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies all pending migrations in ascending version order and returns the ones applied
+func MigrateUp(db *DB, migrations []Migration, now int64) ([]Migration, error) {
+	appliedAt, errApplied := schemaVersionQueryApplied(db)
+	if errApplied != nil {
+		return nil, errApplied
+	}
+
+	applied := make([]Migration, 0)
+
+	for _, migration := range migrations {
+		if _, exists := appliedAt[migration.Version]; exists {
+			continue
+		}
+
+		errApply := applyMigration(db, migration.Up, func(tx *Tx) error {
+			_, errInsert := tx.Exec(`
+			INSERT INTO
+				SchemaVersion (version, name, appliedAt)
+			VALUES( ?, ?, ? )`, migration.Version, migration.Name, now)
+			return errInsert
+		})
+		if errApply != nil {
+			return applied, errors.Wrapf(errApply, "could not apply migration %04d_%s", migration.Version, migration.Name)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the given number of applied migrations in descending version order, a negative number reverts all of them
+func MigrateDown(db *DB, migrations []Migration, steps int) ([]Migration, error) {
+	appliedAt, errApplied := schemaVersionQueryApplied(db)
+	if errApplied != nil {
+		return nil, errApplied
+	}
+
+	migrationsByVersion := make(map[int]Migration)
+	for _, migration := range migrations {
+		migrationsByVersion[migration.Version] = migration
+	}
+
+	versions := make([]int, 0, len(appliedAt))
+	for version := range appliedAt {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	reverted := make([]Migration, 0)
+
+	for _, version := range versions {
+		if steps >= 0 && len(reverted) >= steps {
+			break
+		}
+
+		migration, exists := migrationsByVersion[version]
+		if !exists {
+			return reverted, errors.Errorf("applied migration %04d is unknown to this version of light-messenger", version)
+		}
+
+		errApply := applyMigration(db, migration.Down, func(tx *Tx) error {
+			_, errDelete := tx.Exec(`
+			DELETE FROM
+				SchemaVersion
+			WHERE
+				version = ?`, migration.Version)
+			return errDelete
+		})
+		if errApply != nil {
+			return reverted, errors.Wrapf(errApply, "could not revert migration %04d_%s", migration.Version, migration.Name)
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// MigrateStatus ..
+func MigrateStatus(db *DB, migrations []Migration) ([]MigrationStatus, error) {
+	appliedAt, errApplied := schemaVersionQueryApplied(db)
+	if errApplied != nil {
+		return nil, errApplied
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration, AppliedAt: -1}
+		if at, exists := appliedAt[migration.Version]; exists {
+			status.AppliedAt = at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func parseMigrationFileName(fileName string) (int, string, bool, error) {
+	var up bool
+	var base string
+
+	switch {
+	case strings.HasSuffix(fileName, migrationSuffixUp):
+		up = true
+		base = strings.TrimSuffix(fileName, migrationSuffixUp)
+	case strings.HasSuffix(fileName, migrationSuffixDown):
+		base = strings.TrimSuffix(fileName, migrationSuffixDown)
+	default:
+		return 0, "", false, errors.Errorf("migration file %s must end in %s or %s", fileName, migrationSuffixUp, migrationSuffixDown)
+	}
+
+	parts := strings.SplitN(base, "_", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false, errors.Errorf("migration file %s must be named <version>_<name>", fileName)
+	}
+
+	version, errVersion := strconv.Atoi(parts[0])
+	if errVersion != nil || version <= 0 {
+		return 0, "", false, errors.Errorf("migration file %s has an invalid version", fileName)
+	}
+
+	return version, parts[1], up, nil
+}
+
+func schemaVersionQueryApplied(db *DB) (map[int]int64, error) {
+	_, errCreate := db.Exec(`
+	CREATE TABLE IF NOT EXISTS SchemaVersion (
+		version int NOT NULL,
+		name varchar(255) NOT NULL,
+		appliedAt bigint NOT NULL,
+		PRIMARY KEY (version)
+	)`)
+	if errCreate != nil {
+		return nil, errors.WithStack(errCreate)
+	}
+
+	rows, errQuery := db.Query(`
+	SELECT
+		version, appliedAt
+	FROM
+		SchemaVersion`)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var at int64
+		if errRowScan := rows.Scan(&version, &at); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		appliedAt[version] = at
+	}
+
+	return appliedAt, errors.WithStack(rows.Err())
+}
+
+// applyMigration executes the statements of a migration script followed by the bookkeeping of the SchemaVersion table.
+// Note that MySQL commits DDL statements implicitly, the transaction therefore only guarantees the bookkeeping on MySQL.
+func applyMigration(db *DB, script string, bookkeeping func(tx *Tx) error) error {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return errors.WithStack(errBegin)
+	}
+
+	for _, statement := range splitStatements(script) {
+		trimedStatement := strings.Trim(statement, " \n")
+		if len(trimedStatement) == 0 {
+			continue
+		}
+
+		if _, errExec := tx.Exec(trimedStatement); errExec != nil {
+			tx.Rollback()
+			return errors.WithStack(errExec)
+		}
+	}
+
+	if errBookkeeping := bookkeeping(tx); errBookkeeping != nil {
+		tx.Rollback()
+		return errors.WithStack(errBookkeeping)
+	}
+
+	return errors.WithStack(tx.Commit())
+}
@@ -0,0 +1,125 @@
+package lmdatabase
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitShouldParseMigrationFileNames(t *testing.T) {
+
+	version, name, up, errParse := parseMigrationFileName("0002_add_index.up.sql")
+	if errParse != nil {
+		t.Fatalf("%+v", errParse)
+	}
+	assert.Equal(t, 2, version)
+	assert.Equal(t, "add_index", name)
+	assert.True(t, up)
+
+	version, name, up, errParse = parseMigrationFileName("0010_add_index.down.sql")
+	if errParse != nil {
+		t.Fatalf("%+v", errParse)
+	}
+	assert.Equal(t, 10, version)
+	assert.Equal(t, "add_index", name)
+	assert.False(t, up)
+
+	for _, invalid := range []string{"0001_add_index.sql", "add_index.up.sql", "0001.up.sql", "0000_zero.up.sql", "abcd_name.down.sql"} {
+		_, _, _, errInvalid := parseMigrationFileName(invalid)
+		assert.Error(t, errInvalid, invalid)
+	}
+}
+
+func TestUnitShouldLoadMigrationsInVersionOrder(t *testing.T) {
+
+	migrations, errLoad := MigrationsLoad("mysql")
+	if errLoad != nil {
+		t.Fatalf("%+v", errors.WithStack(errLoad))
+	}
+
+	assert.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+		if i > 0 {
+			assert.Less(t, migrations[i-1].Version, migration.Version)
+		}
+	}
+}
+
+func TestIntegrationMigrateUpShouldLeaveAllMigrationsApplied(t *testing.T) {
+
+	// given
+	db := setupTest(t)
+
+	migrations, errLoad := MigrationsLoad("mysql")
+	if errLoad != nil {
+		t.Fatalf("%+v", errors.WithStack(errLoad))
+	}
+
+	// when
+	{
+		_, errMigrateUp := MigrateUp(db, migrations, 1000)
+		if errMigrateUp != nil {
+			t.Fatalf("%+v", errors.WithStack(errMigrateUp))
+		}
+	}
+
+	// then
+	applied, errMigrateUpAgain := MigrateUp(db, migrations, 2000)
+	if errMigrateUpAgain != nil {
+		t.Fatalf("%+v", errors.WithStack(errMigrateUpAgain))
+	}
+	assert.Empty(t, applied)
+
+	statuses, errStatus := MigrateStatus(db, migrations)
+	if errStatus != nil {
+		t.Fatalf("%+v", errors.WithStack(errStatus))
+	}
+
+	assert.Equal(t, len(migrations), len(statuses))
+	for _, status := range statuses {
+		assert.NotEqual(t, int64(-1), status.AppliedAt)
+	}
+
+	tearDownTest(t, db)
+}
+
+func TestIntegrationMigrateShouldRevertAndReapplySQLiteMigrations(t *testing.T) {
+
+	// given
+	db, dir := setupSQLiteTest(t)
+
+	migrations, errLoad := MigrationsLoad(DriverSQLite)
+	if errLoad != nil {
+		t.Fatalf("%+v", errors.WithStack(errLoad))
+	}
+
+	// when
+	reverted, errMigrateDown := MigrateDown(db, migrations, -1)
+	if errMigrateDown != nil {
+		t.Fatalf("%+v", errors.WithStack(errMigrateDown))
+	}
+
+	// then
+	assert.Equal(t, len(migrations), len(reverted))
+	assert.Equal(t, migrations[len(migrations)-1].Version, reverted[0].Version)
+
+	statuses, errStatus := MigrateStatus(db, migrations)
+	if errStatus != nil {
+		t.Fatalf("%+v", errors.WithStack(errStatus))
+	}
+	for _, status := range statuses {
+		assert.Equal(t, int64(-1), status.AppliedAt)
+	}
+
+	applied, errMigrateUp := MigrateUp(db, migrations, 2000)
+	if errMigrateUp != nil {
+		t.Fatalf("%+v", errors.WithStack(errMigrateUp))
+	}
+	assert.Equal(t, len(migrations), len(applied))
+
+	tearDownSQLiteTest(t, db, dir)
+}
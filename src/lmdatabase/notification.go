@@ -2,7 +2,7 @@ package lmdatabase
 
 import (
 	"database/sql"
-	"log"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -17,33 +17,247 @@ type Notification struct {
 	CreatedAt      int64
 	ConfirmedAt    int64 // default 0, i.e. NULL
 	CancelledAt    int64 // default 0, i.e. NULL
+	ConfirmedBy    string
+	CancelledBy    string
+	NotificationDetails
 }
 
-// NotificationInsert ..
-func NotificationInsert(db *sql.DB, department string, priority int, modality string, createdAt int64) error {
+// NotificationDetails is the optional context an MTRA can give with a notification, empty if not given
+type NotificationDetails struct {
+	Message         string
+	Room            string // room or scanner
+	AccessionNumber string
+}
+
+// merge returns the details with the empty fields taken from previous
+func (details NotificationDetails) merge(previous NotificationDetails) NotificationDetails {
+	if details.Message == "" {
+		details.Message = previous.Message
+	}
+	if details.Room == "" {
+		details.Room = previous.Room
+	}
+	if details.AccessionNumber == "" {
+		details.AccessionNumber = previous.AccessionNumber
+	}
+	return details
+}
+
+// NotificationInsert inserts an open notification and returns its id
+func NotificationInsert(db *DB, department string, priority int, modality string, createdAt int64) (string, error) {
 	insertStmt, err := db.Prepare(`
 	INSERT INTO
 		Notification (notificationId, departmentId, priority, modality, createdAt)
 	VALUES( ?, ?, ?, ?, ?)`)
 
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 
 	defer insertStmt.Close()
 
-	_, errExec := insertStmt.Exec(uuid.New().String(), department, priority, modality, createdAt)
+	notificationID := uuid.New().String()
+
+	_, errExec := insertStmt.Exec(notificationID, department, priority, modality, createdAt)
 	if errExec != nil {
-		return errors.WithStack(errExec)
+		return "", errors.WithStack(errExec)
+	}
+	return notificationID, nil
+}
+
+// notificationCreateOrEscalateAttempts bounds the retries of NotificationCreateOrEscalate when concurrent transactions
+// collide on the unique index of open notifications or deadlock
+const notificationCreateOrEscalateAttempts = 5
+
+// NotificationCreateOrEscalate creates an open notification for the department and modality or, if there is one
+// already, changes its priority and replaces the details that are given. The change and its event are written in one transaction, the unique index on open
+// notifications guarantees that concurrent calls never leave more than one open notification behind. The returned
+// event tells whether the notification was created or escalated.
+func NotificationCreateOrEscalate(db *DB, department string, priority int, modality string, details NotificationDetails, now int64, clientAddress string) (*NotificationEvent, error) {
+	var errAttempt error
+	for attempt := 0; attempt < notificationCreateOrEscalateAttempts; attempt++ {
+		var event *NotificationEvent
+		event, errAttempt = notificationCreateOrEscalateTx(db, department, priority, modality, details, now, clientAddress)
+		if errAttempt == nil {
+			return event, nil
+		}
+		if !isRetryable(errAttempt) {
+			return nil, errAttempt
+		}
 	}
-	return nil
+
+	return nil, errors.Wrapf(errAttempt, "could not create or escalate notification after %d attempts", notificationCreateOrEscalateAttempts)
+}
+
+func notificationCreateOrEscalateTx(db *DB, department string, priority int, modality string, details NotificationDetails, now int64, clientAddress string) (*NotificationEvent, error) {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return nil, errors.WithStack(errBegin)
+	}
+	defer tx.Rollback()
+
+	queryStmt :=
+		`SELECT
+			notificationId, priority, message, room, accessionNumber
+		FROM
+			Notification
+		WHERE
+			departmentId = ?
+		AND
+			modality = ?
+		AND
+			cancelledAt = -1
+		AND
+			confirmedAt = -1` + forUpdate(db.Driver)
+
+	event := NotificationEvent{
+		CreatedAt:     now,
+		NewValue:      strconv.Itoa(priority),
+		ClientAddress: clientAddress,
+	}
+
+	var previousPriority int
+	var previousDetails NotificationDetails
+	errRowScan := tx.QueryRow(queryStmt, department, modality).Scan(&event.NotificationID, &previousPriority,
+		&previousDetails.Message, &previousDetails.Room, &previousDetails.AccessionNumber)
+
+	switch {
+	case errRowScan == sql.ErrNoRows:
+		event.NotificationID = uuid.New().String()
+		event.EventType = NotificationEventCreated
+
+		_, errExec := tx.Exec(`
+		INSERT INTO
+			Notification (notificationId, departmentId, priority, modality, createdAt, message, room, accessionNumber)
+		VALUES( ?, ?, ?, ?, ?, ?, ?, ?)`, event.NotificationID, department, priority, modality, now,
+			details.Message, details.Room, details.AccessionNumber)
+		if errExec != nil {
+			return nil, errors.WithStack(errExec)
+		}
+
+	case errRowScan != nil:
+		return nil, errors.WithStack(errRowScan)
+
+	default:
+		event.EventType = NotificationEventPriority
+		event.PreviousValue = strconv.Itoa(previousPriority)
+
+		details = details.merge(previousDetails)
+
+		_, errExec := tx.Exec(`
+		UPDATE
+			Notification
+		SET
+			priority = ?,
+			message = ?,
+			room = ?,
+			accessionNumber = ?
+		WHERE
+			notificationId = ?`, priority, details.Message, details.Room, details.AccessionNumber, event.NotificationID)
+		if errExec != nil {
+			return nil, errors.WithStack(errExec)
+		}
+	}
+
+	errEventInsert := notificationEventInsert(tx, &event)
+	if errEventInsert != nil {
+		return nil, errEventInsert
+	}
+
+	errCommit := tx.Commit()
+	if errCommit != nil {
+		return nil, errors.WithStack(errCommit)
+	}
+
+	return &event, nil
+}
+
+// ErrNotificationNotOpen is returned when a notification that was confirmed or cancelled already is forwarded
+var ErrNotificationNotOpen = errors.New("the notification is not open")
+
+// ErrNotificationOpenInDepartment is returned when a notification is forwarded to a department that has an open
+// notification of the same modality already
+var ErrNotificationOpenInDepartment = errors.New("the department has an open notification of the modality already")
+
+// ErrNotificationInDepartment is returned when a notification is forwarded to the department it is in
+var ErrNotificationInDepartment = errors.New("the notification is in the department already")
+
+// NotificationForward moves an open notification to another department, it keeps its creation time and priority and
+// records the transfer as event. It returns nil if the notification does not exist.
+func NotificationForward(db *DB, notificationID string, department string, now int64, clientAddress string) (*NotificationEvent, error) {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return nil, errors.WithStack(errBegin)
+	}
+	defer tx.Rollback()
+
+	queryStmt :=
+		`SELECT
+			departmentId, confirmedAt, cancelledAt
+		FROM
+			Notification
+		WHERE
+			notificationId = ?` + forUpdate(db.Driver)
+
+	var previousDepartment string
+	var confirmedAt, cancelledAt int64
+	errRowScan := tx.QueryRow(queryStmt, notificationID).Scan(&previousDepartment, &confirmedAt, &cancelledAt)
+	if errRowScan != nil {
+		if errRowScan == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.WithStack(errRowScan)
+	}
+
+	if confirmedAt != -1 || cancelledAt != -1 {
+		return nil, ErrNotificationNotOpen
+	}
+
+	if previousDepartment == department {
+		return nil, ErrNotificationInDepartment
+	}
+
+	_, errExec := tx.Exec(`
+	UPDATE
+		Notification
+	SET
+		departmentId = ?
+	WHERE
+		notificationId = ?`, department, notificationID)
+	if errExec != nil {
+		if isUniqueViolation(errExec) {
+			return nil, ErrNotificationOpenInDepartment
+		}
+		return nil, errors.WithStack(errExec)
+	}
+
+	event := NotificationEvent{
+		NotificationID: notificationID,
+		EventType:      NotificationEventForwarded,
+		CreatedAt:      now,
+		PreviousValue:  previousDepartment,
+		NewValue:       department,
+		ClientAddress:  clientAddress,
+	}
+
+	errEventInsert := notificationEventInsert(tx, &event)
+	if errEventInsert != nil {
+		return nil, errEventInsert
+	}
+
+	errCommit := tx.Commit()
+	if errCommit != nil {
+		return nil, errors.WithStack(errCommit)
+	}
+
+	return &event, nil
 }
 
 // NotificationGetOpenNotificationByDepartmentAndModality ..
-func NotificationGetOpenNotificationByDepartmentAndModality(db *sql.DB, department string, modality string) (*Notification, error) {
+func NotificationGetOpenNotificationByDepartmentAndModality(db *DB, department string, modality string) (*Notification, error) {
 	queryStmt :=
 		`SELECT
-			notificationId, departmentId, modality, priority, createdAt
+			notificationId, departmentId, modality, priority, createdAt, message, room, accessionNumber
 		FROM
 			Notification
 		WHERE
@@ -58,7 +272,8 @@ func NotificationGetOpenNotificationByDepartmentAndModality(db *sql.DB, departme
 	row := db.QueryRow(queryStmt, department, modality)
 	//defer db.Close()
 	var result Notification
-	errRowScan := row.Scan(&result.NotificationID, &result.DepartmentID, &result.Modality, &result.Priority, &result.CreatedAt)
+	errRowScan := row.Scan(&result.NotificationID, &result.DepartmentID, &result.Modality, &result.Priority, &result.CreatedAt,
+		&result.Message, &result.Room, &result.AccessionNumber)
 	if errRowScan != nil {
 		if errRowScan == sql.ErrNoRows {
 			result.Modality = modality
@@ -73,10 +288,11 @@ func NotificationGetOpenNotificationByDepartmentAndModality(db *sql.DB, departme
 }
 
 // NotificationGetByID ..
-func NotificationGetByID(db *sql.DB, notificationID string) (*Notification, error) {
+func NotificationGetByID(db *DB, notificationID string) (*Notification, error) {
 	queryStmt :=
 		`SELECT
-			notificationId, departmentId, modality, priority, createdAt, confirmedAt, cancelledAt
+			notificationId, departmentId, modality, priority, createdAt, confirmedAt, cancelledAt, confirmedBy, cancelledBy,
+			message, room, accessionNumber
 		FROM
 			Notification
 		WHERE
@@ -86,7 +302,8 @@ func NotificationGetByID(db *sql.DB, notificationID string) (*Notification, erro
 	row := db.QueryRow(queryStmt, notificationID)
 
 	var result Notification
-	errRowScan := row.Scan(&result.NotificationID, &result.DepartmentID, &result.Modality, &result.Priority, &result.CreatedAt, &result.ConfirmedAt, &result.CancelledAt)
+	errRowScan := row.Scan(&result.NotificationID, &result.DepartmentID, &result.Modality, &result.Priority, &result.CreatedAt, &result.ConfirmedAt, &result.CancelledAt,
+		&result.ConfirmedBy, &result.CancelledBy, &result.Message, &result.Room, &result.AccessionNumber)
 
 	if errRowScan != nil {
 		if errRowScan == sql.ErrNoRows {
@@ -98,10 +315,10 @@ func NotificationGetByID(db *sql.DB, notificationID string) (*Notification, erro
 }
 
 // NotificationGetOpenNotificationsByDepartment ..
-func NotificationGetOpenNotificationsByDepartment(db *sql.DB, department string) (*[]Notification, error) {
+func NotificationGetOpenNotificationsByDepartment(db *DB, department string) (*[]Notification, error) {
 	queryStmt :=
 		`SELECT
-			notificationId, modality, departmentId, priority, createdAt
+			notificationId, modality, departmentId, priority, createdAt, message, room, accessionNumber
 		FROM
 			Notification
 		WHERE
@@ -124,7 +341,8 @@ func NotificationGetOpenNotificationsByDepartment(db *sql.DB, department string)
 
 	for rows.Next() {
 		var notification Notification
-		if errRowScan := rows.Scan(&notification.NotificationID, &notification.Modality, &notification.DepartmentID, &notification.Priority, &notification.CreatedAt); errRowScan != nil {
+		if errRowScan := rows.Scan(&notification.NotificationID, &notification.Modality, &notification.DepartmentID, &notification.Priority, &notification.CreatedAt,
+			&notification.Message, &notification.Room, &notification.AccessionNumber); errRowScan != nil {
 			return nil, errors.WithStack(errRowScan)
 		}
 		openNotifications = append(openNotifications, notification)
@@ -134,112 +352,228 @@ func NotificationGetOpenNotificationsByDepartment(db *sql.DB, department string)
 }
 
 // NotificationGetProcessedNotificationsByModality ..
-func NotificationGetProcessedNotificationsByModality(db *sql.DB, modality string) (*[]Notification, error) {
+func NotificationGetProcessedNotificationsByModality(db *DB, modality string) (*[]Notification, error) {
+	processedNotifications, _, errHistory := NotificationGetHistory(db, NotificationHistoryQuery{Modality: modality, Limit: 20})
+	return processedNotifications, errHistory
+}
+
+// NotificationGetByCreatedAt returns the notifications created in the period from .. to, excluding to, ordered by
+// creation, open notifications have confirmedAt and cancelledAt -1
+func NotificationGetByCreatedAt(db *DB, from int64, to int64) (*[]Notification, error) {
 	queryStmt :=
 		`SELECT
-			notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt
+			notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, confirmedBy, cancelledBy,
+			message, room, accessionNumber
 		FROM
 			Notification
 		WHERE
-			modality = ?
+			createdAt >= ?
 		AND
-			(confirmedAt <> -1 OR cancelledAt <> -1)
-		ORDER BY 
-			createdAt DESC
-		LIMIT 20`
+			createdAt < ?
+		ORDER BY
+			createdAt, notificationId`
 
-	rows, errQuery := db.Query(queryStmt, modality)
+	rows, errQuery := db.Query(queryStmt, from, to)
 	if errQuery != nil {
 		return nil, errors.WithStack(errQuery)
 	}
 	defer rows.Close()
 
-	processedNotifications := make([]Notification, 0)
+	notifications := make([]Notification, 0)
 
 	for rows.Next() {
 		var notification Notification
 		if errRowScan := rows.Scan(&notification.NotificationID, &notification.Modality,
 			&notification.DepartmentID, &notification.Priority, &notification.CreatedAt,
-			&notification.ConfirmedAt, &notification.CancelledAt); errRowScan != nil {
-			log.Printf("%+v, %+v", notification, processedNotifications)
+			&notification.ConfirmedAt, &notification.CancelledAt, &notification.ConfirmedBy, &notification.CancelledBy,
+			&notification.Message, &notification.Room, &notification.AccessionNumber); errRowScan != nil {
 			return nil, errors.WithStack(errRowScan)
 		}
-		processedNotifications = append(processedNotifications, notification)
+		notifications = append(notifications, notification)
 	}
-	//defer rows.Close()
-	return &processedNotifications, nil
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, errors.WithStack(errRows)
+	}
+
+	return &notifications, nil
 }
 
-// NotificationCancel ..
-func NotificationCancel(db *sql.DB, modality string, department string, cancelledAt int64) error {
-	updateStmt, err := db.Prepare(`
+// NotificationCancel cancels the open notification of the modality and department and records the event in the same
+// transaction, cancelledBy records the user or workstation. The notification is locked while it is cancelled, so a
+// concurrent confirmation or forward either happens before and leaves nothing to cancel or waits. It returns the
+// cancelled notification, nil if there was no open notification.
+func NotificationCancel(db *DB, modality string, department string, cancelledAt int64, cancelledBy string, clientAddress string) (*Notification, error) {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return nil, errors.WithStack(errBegin)
+	}
+	defer tx.Rollback()
+
+	queryStmt :=
+		`SELECT
+			notificationId, departmentId, modality, priority, createdAt, confirmedBy, message, room, accessionNumber
+		FROM
+			Notification
+		WHERE
+			departmentId = ?
+		AND
+			modality = ?
+		AND
+			cancelledAt = -1
+		AND
+			confirmedAt = -1` + forUpdate(db.Driver)
+
+	notification := Notification{ConfirmedAt: -1, CancelledAt: cancelledAt, CancelledBy: cancelledBy}
+	errRowScan := tx.QueryRow(queryStmt, department, modality).Scan(&notification.NotificationID, &notification.DepartmentID,
+		&notification.Modality, &notification.Priority, &notification.CreatedAt, &notification.ConfirmedBy,
+		&notification.Message, &notification.Room, &notification.AccessionNumber)
+	if errRowScan != nil {
+		if errRowScan == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.WithStack(errRowScan)
+	}
+
+	_, errExec := tx.Exec(`
 	UPDATE
 		Notification
 	SET
-		cancelledAt = ?
+		cancelledAt = ?,
+		cancelledBy = ?,
+		isOpen = NULL
 	WHERE
-		modality = ?
-	AND
-		departmentId = ?
-	AND
-		confirmedAt = -1
-	AND
-		cancelledAt = -1`)
-
-	if err != nil {
-		return err
+		notificationId = ?`, cancelledAt, cancelledBy, notification.NotificationID)
+	if errExec != nil {
+		return nil, errors.WithStack(errExec)
 	}
 
-	defer updateStmt.Close()
+	errEventInsert := notificationEventInsert(tx, &NotificationEvent{
+		NotificationID: notification.NotificationID,
+		EventType:      NotificationEventCancelled,
+		CreatedAt:      cancelledAt,
+		ClientAddress:  clientAddress,
+	})
+	if errEventInsert != nil {
+		return nil, errEventInsert
+	}
 
-	_, errExec := updateStmt.Exec(cancelledAt, modality, department)
-	if errExec != nil {
-		return errors.WithStack(errExec)
+	errCommit := tx.Commit()
+	if errCommit != nil {
+		return nil, errors.WithStack(errCommit)
 	}
 
-	return nil
+	return &notification, nil
 }
 
-// NotificationUpdatePriority ..
-func NotificationUpdatePriority(db *sql.DB, notificationID string, priority int) error {
-	updateStmt, err := db.Prepare(`
+// NotificationChangePriority changes the priority of the open notification and records the event in the same
+// transaction. The notification is locked while its priority changes, so a concurrent confirmation or cancellation
+// either happens before and returns ErrNotificationNotOpen or waits. It returns the notification with its new priority,
+// nil if the notification does not exist.
+func NotificationChangePriority(db *DB, notificationID string, priority int, now int64, clientAddress string) (*Notification, error) {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return nil, errors.WithStack(errBegin)
+	}
+	defer tx.Rollback()
+
+	queryStmt :=
+		`SELECT
+			notificationId, departmentId, modality, priority, createdAt, confirmedAt, cancelledAt, confirmedBy, cancelledBy,
+			message, room, accessionNumber
+		FROM
+			Notification
+		WHERE
+			notificationId = ?` + forUpdate(db.Driver)
+
+	var notification Notification
+	errRowScan := tx.QueryRow(queryStmt, notificationID).Scan(&notification.NotificationID, &notification.DepartmentID,
+		&notification.Modality, &notification.Priority, &notification.CreatedAt, &notification.ConfirmedAt,
+		&notification.CancelledAt, &notification.ConfirmedBy, &notification.CancelledBy, &notification.Message,
+		&notification.Room, &notification.AccessionNumber)
+	if errRowScan != nil {
+		if errRowScan == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.WithStack(errRowScan)
+	}
+
+	if notification.ConfirmedAt != -1 || notification.CancelledAt != -1 {
+		return nil, ErrNotificationNotOpen
+	}
+
+	if notification.Priority == priority {
+		return &notification, nil
+	}
+
+	result, errExec := tx.Exec(`
 	UPDATE
 		Notification
 	SET
 		priority = ?
 	WHERE
-		notificationId = ?`)
+		notificationId = ?
+	AND
+		confirmedAt = -1
+	AND
+		cancelledAt = -1`, priority, notificationID)
+	if errExec != nil {
+		return nil, errors.WithStack(errExec)
+	}
 
-	if err != nil {
-		return errors.WithStack(err)
+	rowsAffected, errRowsAffected := result.RowsAffected()
+	if errRowsAffected != nil {
+		return nil, errors.WithStack(errRowsAffected)
 	}
-	defer updateStmt.Close()
 
-	_, errExec := updateStmt.Exec(priority, notificationID)
-	if errExec != nil {
-		return errors.WithStack(errExec)
+	if rowsAffected == 0 {
+		return nil, ErrNotificationNotOpen
+	}
+
+	errEventInsert := notificationEventInsert(tx, &NotificationEvent{
+		NotificationID: notificationID,
+		EventType:      NotificationEventPriority,
+		CreatedAt:      now,
+		PreviousValue:  strconv.Itoa(notification.Priority),
+		NewValue:       strconv.Itoa(priority),
+		ClientAddress:  clientAddress,
+	})
+	if errEventInsert != nil {
+		return nil, errEventInsert
 	}
 
-	return nil
+	errCommit := tx.Commit()
+	if errCommit != nil {
+		return nil, errors.WithStack(errCommit)
+	}
+
+	notification.Priority = priority
+	return &notification, nil
 }
 
-// NotificationConfirm ..
-func NotificationConfirm(db *sql.DB, notificationID string, now int64) (int64, error) {
-	updateStmt, err := db.Prepare(`
+// NotificationConfirm confirms the open notification and records the event in the same transaction, confirmedBy
+// records the user or workstation. It returns 0 if the notification does not exist or was confirmed or cancelled
+// already, so the first confirmation is kept.
+func NotificationConfirm(db *DB, notificationID string, now int64, confirmedBy string, clientAddress string) (int64, error) {
+	tx, errBegin := db.Begin()
+	if errBegin != nil {
+		return 0, errors.WithStack(errBegin)
+	}
+	defer tx.Rollback()
+
+	result, errExec := tx.Exec(`
 	UPDATE
 		Notification
 	SET
-		confirmedAt = ?
+		confirmedAt = ?,
+		confirmedBy = ?,
+		isOpen = NULL
 	WHERE
-		notificationId = ?`)
-
-	if err != nil {
-		return 0, err
-	}
-
-	defer updateStmt.Close()
-
-	result, errExec := updateStmt.Exec(now, notificationID)
+		notificationId = ?
+	AND
+		confirmedAt = -1
+	AND
+		cancelledAt = -1`, now, confirmedBy, notificationID)
 	if errExec != nil {
 		return 0, errors.WithStack(errExec)
 	}
@@ -249,5 +583,24 @@ func NotificationConfirm(db *sql.DB, notificationID string, now int64) (int64, e
 		return 0, errors.WithStack(errRowsAffected)
 	}
 
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+
+	errEventInsert := notificationEventInsert(tx, &NotificationEvent{
+		NotificationID: notificationID,
+		EventType:      NotificationEventConfirmed,
+		CreatedAt:      now,
+		ClientAddress:  clientAddress,
+	})
+	if errEventInsert != nil {
+		return 0, errEventInsert
+	}
+
+	errCommit := tx.Commit()
+	if errCommit != nil {
+		return 0, errors.WithStack(errCommit)
+	}
+
 	return rowsAffected, nil
 }
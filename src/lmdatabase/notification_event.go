@@ -0,0 +1,83 @@
+package lmdatabase
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// values of NotificationEvent.EventType
+const (
+	NotificationEventCreated   = "created"
+	NotificationEventPriority  = "priority"
+	NotificationEventForwarded = "forwarded"
+	NotificationEventCancelled = "cancelled"
+	NotificationEventConfirmed = "confirmed"
+)
+
+// NotificationEvent records a change in the lifecycle of a notification
+type NotificationEvent struct {
+	EventID        string
+	NotificationID string
+	EventType      string
+	CreatedAt      int64
+	PreviousValue  string // e.g. the priority before a priority change, empty if not applicable
+	NewValue       string
+	ClientAddress  string
+}
+
+// notificationEventInsert assigns a new id to the event and inserts it, the operations that change a notification call
+// it in their transaction so every change is recorded
+func notificationEventInsert(db preparer, event *NotificationEvent) error {
+	insertStmt, err := db.Prepare(`
+	INSERT INTO
+		NotificationEvent (eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress)
+	VALUES( ?, ?, ?, ?, ?, ?, ? )`)
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer insertStmt.Close()
+
+	event.EventID = uuid.New().String()
+
+	_, errExec := insertStmt.Exec(event.EventID, event.NotificationID, event.EventType, event.CreatedAt, event.PreviousValue, event.NewValue, event.ClientAddress)
+	if errExec != nil {
+		return errors.WithStack(errExec)
+	}
+
+	return nil
+}
+
+// NotificationEventGetByNotificationID returns the events of a notification in the order they were recorded, also
+// within the same second
+func NotificationEventGetByNotificationID(db *DB, notificationID string) (*[]NotificationEvent, error) {
+	queryStmt :=
+		`SELECT
+			eventId, notificationId, eventType, createdAt, previousValue, newValue, clientAddress
+		FROM
+			NotificationEvent
+		WHERE
+			notificationId = ?
+		ORDER BY
+			sequenceNumber ASC`
+
+	rows, errQuery := db.Query(queryStmt, notificationID)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+	defer rows.Close()
+
+	events := make([]NotificationEvent, 0)
+
+	for rows.Next() {
+		var event NotificationEvent
+		if errRowScan := rows.Scan(&event.EventID, &event.NotificationID, &event.EventType, &event.CreatedAt,
+			&event.PreviousValue, &event.NewValue, &event.ClientAddress); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		events = append(events, event)
+	}
+
+	return &events, nil
+}
@@ -0,0 +1,148 @@
+package lmdatabase
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// outcomes of processed notifications
+const (
+	NotificationOutcomeConfirmed = "confirmed"
+	NotificationOutcomeCancelled = "cancelled"
+)
+
+// NotificationHistoryQuery selects processed, i.e. confirmed or cancelled, notifications. Zero values do not filter.
+type NotificationHistoryQuery struct {
+	Modality   string
+	Department string
+	Priority   int
+	Outcome    string // NotificationOutcomeConfirmed or NotificationOutcomeCancelled
+	From       int64  // created at or after
+	To         int64  // created before
+	Limit      int
+	Offset     int
+}
+
+// where returns the sql conditions of the query and their arguments
+func (query NotificationHistoryQuery) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	switch query.Outcome {
+	case NotificationOutcomeConfirmed:
+		conditions = append(conditions, "confirmedAt <> -1")
+	case NotificationOutcomeCancelled:
+		conditions = append(conditions, "cancelledAt <> -1")
+	default:
+		conditions = append(conditions, "(confirmedAt <> -1 OR cancelledAt <> -1)")
+	}
+
+	if query.Modality != "" {
+		conditions = append(conditions, "modality = ?")
+		args = append(args, query.Modality)
+	}
+	if query.Department != "" {
+		conditions = append(conditions, "departmentId = ?")
+		args = append(args, query.Department)
+	}
+	if query.Priority != 0 {
+		conditions = append(conditions, "priority = ?")
+		args = append(args, query.Priority)
+	}
+	if query.From != 0 {
+		conditions = append(conditions, "createdAt >= ?")
+		args = append(args, query.From)
+	}
+	if query.To != 0 {
+		conditions = append(conditions, "createdAt < ?")
+		args = append(args, query.To)
+	}
+
+	return strings.Join(conditions, "\n\t\tAND\n\t\t\t"), args
+}
+
+// matches reports whether the notification is selected by the query, it mirrors where
+func (query NotificationHistoryQuery) matches(notification *Notification) bool {
+	switch query.Outcome {
+	case NotificationOutcomeConfirmed:
+		if notification.ConfirmedAt == -1 {
+			return false
+		}
+	case NotificationOutcomeCancelled:
+		if notification.CancelledAt == -1 {
+			return false
+		}
+	default:
+		if notification.ConfirmedAt == -1 && notification.CancelledAt == -1 {
+			return false
+		}
+	}
+
+	return (query.Modality == "" || notification.Modality == query.Modality) &&
+		(query.Department == "" || notification.DepartmentID == query.Department) &&
+		(query.Priority == 0 || notification.Priority == query.Priority) &&
+		(query.From == 0 || notification.CreatedAt >= query.From) &&
+		(query.To == 0 || notification.CreatedAt < query.To)
+}
+
+// NotificationGetHistory returns the page of processed notifications selected by the query, the most recently created
+// first, together with the number of all notifications it selects
+func NotificationGetHistory(db *DB, query NotificationHistoryQuery) (*[]Notification, int, error) {
+	where, args := query.where()
+
+	var total int
+	errCount := db.QueryRow(`
+		SELECT
+			COUNT(*)
+		FROM
+			Notification
+		WHERE
+			`+where, args...).Scan(&total)
+	if errCount != nil {
+		return nil, 0, errors.WithStack(errCount)
+	}
+
+	queryStmt :=
+		`SELECT
+			notificationId, modality, departmentId, priority, createdAt, confirmedAt, cancelledAt, confirmedBy, cancelledBy,
+			message, room, accessionNumber
+		FROM
+			Notification
+		WHERE
+			` + where + `
+		ORDER BY
+			createdAt DESC, notificationId DESC`
+
+	// limit and offset are integers, so they can safely be part of the statement in every dialect
+	if query.Limit > 0 {
+		queryStmt += `
+		LIMIT ` + strconv.Itoa(query.Limit) + ` OFFSET ` + strconv.Itoa(query.Offset)
+	}
+
+	rows, errQuery := db.Query(queryStmt, args...)
+	if errQuery != nil {
+		return nil, 0, errors.WithStack(errQuery)
+	}
+	defer rows.Close()
+
+	notifications := make([]Notification, 0)
+
+	for rows.Next() {
+		var notification Notification
+		if errRowScan := rows.Scan(&notification.NotificationID, &notification.Modality,
+			&notification.DepartmentID, &notification.Priority, &notification.CreatedAt,
+			&notification.ConfirmedAt, &notification.CancelledAt, &notification.ConfirmedBy, &notification.CancelledBy,
+			&notification.Message, &notification.Room, &notification.AccessionNumber); errRowScan != nil {
+			return nil, 0, errors.WithStack(errRowScan)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, 0, errors.WithStack(errRows)
+	}
+
+	return &notifications, total, nil
+}
@@ -19,7 +19,7 @@ func TestIntegrationShouldInsertAndGetNotification(t *testing.T) {
 
 	// when
 	{
-		errInsert := NotificationInsert(db, departmentID, priority, modality, createdAt)
+		_, errInsert := NotificationInsert(db, departmentID, priority, modality, createdAt)
 		if errInsert != nil {
 			t.Fatalf("%+v", errors.WithStack(errInsert))
 		}
@@ -0,0 +1,78 @@
+package lmdatabase
+
+import (
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+)
+
+// supported values of configuration.Database.Driver
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Store is the persistence used by the server for notifications, arduino status, devices and users
+type Store interface {
+	NotificationInsert(department string, priority int, modality string, createdAt int64) (string, error)
+	NotificationCreateOrEscalate(department string, priority int, modality string, details NotificationDetails, now int64, clientAddress string) (*NotificationEvent, error)
+	NotificationGetOpenNotificationByDepartmentAndModality(department string, modality string) (*Notification, error)
+	NotificationGetByID(notificationID string) (*Notification, error)
+	NotificationGetOpenNotificationsByDepartment(department string) (*[]Notification, error)
+	NotificationGetProcessedNotificationsByModality(modality string) (*[]Notification, error)
+	NotificationGetByCreatedAt(from int64, to int64) (*[]Notification, error)
+	NotificationGetHistory(query NotificationHistoryQuery) (*[]Notification, int, error)
+	NotificationCancel(modality string, department string, cancelledAt int64, cancelledBy string, clientAddress string) (*Notification, error)
+	NotificationChangePriority(notificationID string, priority int, now int64, clientAddress string) (*Notification, error)
+	NotificationConfirm(notificationID string, now int64, confirmedBy string, clientAddress string) (int64, error)
+	NotificationForward(notificationID string, department string, now int64, clientAddress string) (*NotificationEvent, error)
+
+	NotificationEventGetByNotificationID(notificationID string) (*[]NotificationEvent, error)
+
+	ArduinoStatusInsert(status ArduinoStatus) error
+	ArduinoStatusQueryWithin5MinutesFromNow(department string, now int64) (*ArduinoStatus, error)
+
+	DeviceHeartbeat(device Device) error
+	DeviceGetByDepartment(department string) (*[]Device, error)
+	DeviceUptimeGetByDepartment(department string, from int64, to int64) (*[]DeviceUptimeInterval, error)
+	DeviceTokenInsert(token DeviceToken) error
+	DeviceTokenGetByHash(tokenHash string) (*DeviceToken, error)
+	DeviceTokenGetByDevice(deviceID string) (*DeviceToken, error)
+	DeviceTokenGetByDepartment(department string) (*[]DeviceToken, error)
+	DeviceTokenDelete(deviceID string) (int64, error)
+
+	UserInsert(user User) error
+	UserGetByUsername(username string) (*User, error)
+	UserGetAll() (*[]User, error)
+	UserUpdatePassword(username string, passwordHash string) (int64, error)
+	UserUpdateRole(username string, role string, modality string, departmentID string) (int64, error)
+	UserDelete(username string) (int64, error)
+
+	Close() error
+}
+
+// GetDriver returns the configured database driver, defaults to mysql
+func GetDriver(initConfig *configuration.Configuration) string {
+	if initConfig.Database.Driver == "" {
+		return DriverMySQL
+	}
+	return initConfig.Database.Driver
+}
+
+// GetStore returns the store for the configured database driver
+func GetStore(initConfig *configuration.Configuration) (Store, error) {
+	switch GetDriver(initConfig) {
+	case DriverMySQL, DriverPostgres, DriverSQLite:
+		db, errDb := GetDB(initConfig)
+		if errDb != nil {
+			return nil, errDb
+		}
+		return NewSQLStore(db), nil
+
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	}
+
+	return nil, errors.Errorf("unknown database driver %s", initConfig.Database.Driver)
+}
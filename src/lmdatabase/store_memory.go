@@ -0,0 +1,615 @@
+package lmdatabase
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// memoryStore keeps everything in process memory, it mirrors the semantics of the sql queries and is meant for
+// development and tests without a database server
+type memoryStore struct {
+	mutex         sync.RWMutex
+	notifications []Notification      // in insertion order
+	events        []NotificationEvent // in insertion order
+	arduinoStatus map[string]ArduinoStatus
+	devices       map[string]Device
+	deviceTokens  map[string]DeviceToken
+	uptime        []DeviceUptimeInterval // in insertion order
+	users         map[string]User
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		notifications: make([]Notification, 0),
+		events:        make([]NotificationEvent, 0),
+		arduinoStatus: make(map[string]ArduinoStatus),
+		devices:       make(map[string]Device),
+		deviceTokens:  make(map[string]DeviceToken),
+		uptime:        make([]DeviceUptimeInterval, 0),
+		users:         make(map[string]User),
+	}
+}
+
+func isOpen(notification *Notification) bool {
+	return notification.ConfirmedAt == -1 && notification.CancelledAt == -1
+}
+
+// openNotification returns a copy with the fields the open notification queries select
+func openNotification(notification Notification) Notification {
+	notification.ConfirmedAt = 0
+	notification.CancelledAt = 0
+	return notification
+}
+
+func (s *memoryStore) NotificationInsert(department string, priority int, modality string, createdAt int64) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.findOpen(department, modality) != nil {
+		// mirrors the unique index on open notifications
+		return "", errors.Errorf("there is an open notification for department %s and modality %s already", department, modality)
+	}
+
+	return s.insert(department, priority, modality, createdAt), nil
+}
+
+// insert appends an open notification, the caller holds the write lock
+func (s *memoryStore) insert(department string, priority int, modality string, createdAt int64) string {
+	notificationID := uuid.New().String()
+
+	s.notifications = append(s.notifications, Notification{
+		NotificationID: notificationID,
+		DepartmentID:   department,
+		Priority:       priority,
+		Modality:       modality,
+		CreatedAt:      createdAt,
+		ConfirmedAt:    -1,
+		CancelledAt:    -1,
+	})
+
+	return notificationID
+}
+
+// findOpen returns the open notification of the department and modality or nil, the caller holds the lock
+func (s *memoryStore) findOpen(department string, modality string) *Notification {
+	for i := range s.notifications {
+		notification := &s.notifications[i]
+		if notification.DepartmentID == department && notification.Modality == modality && isOpen(notification) {
+			return notification
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) NotificationCreateOrEscalate(department string, priority int, modality string, details NotificationDetails, now int64, clientAddress string) (*NotificationEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event := NotificationEvent{
+		EventID:       uuid.New().String(),
+		CreatedAt:     now,
+		NewValue:      strconv.Itoa(priority),
+		ClientAddress: clientAddress,
+	}
+
+	if notification := s.findOpen(department, modality); notification != nil {
+		event.NotificationID = notification.NotificationID
+		event.EventType = NotificationEventPriority
+		event.PreviousValue = strconv.Itoa(notification.Priority)
+		notification.Priority = priority
+		notification.NotificationDetails = details.merge(notification.NotificationDetails)
+	} else {
+		event.NotificationID = s.insert(department, priority, modality, now)
+		event.EventType = NotificationEventCreated
+		s.notifications[len(s.notifications)-1].NotificationDetails = details
+	}
+
+	s.events = append(s.events, event)
+	return &event, nil
+}
+
+func (s *memoryStore) NotificationGetOpenNotificationByDepartmentAndModality(department string, modality string) (*Notification, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if notification := s.findOpen(department, modality); notification != nil {
+		result := openNotification(*notification)
+		return &result, nil
+	}
+
+	return &Notification{DepartmentID: department, Modality: modality, Priority: 99}, nil
+}
+
+func (s *memoryStore) NotificationGetByID(notificationID string) (*Notification, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, notification := range s.notifications {
+		if notification.NotificationID == notificationID {
+			result := notification
+			return &result, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) NotificationGetOpenNotificationsByDepartment(department string) (*[]Notification, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	openNotifications := make([]Notification, 0)
+	for _, notification := range s.notifications {
+		if notification.DepartmentID == department && isOpen(&notification) {
+			openNotifications = append(openNotifications, openNotification(notification))
+		}
+	}
+
+	sort.SliceStable(openNotifications, func(i, j int) bool {
+		return openNotifications[i].Priority < openNotifications[j].Priority
+	})
+
+	return &openNotifications, nil
+}
+
+func (s *memoryStore) NotificationGetProcessedNotificationsByModality(modality string) (*[]Notification, error) {
+	processedNotifications, _, errHistory := s.NotificationGetHistory(NotificationHistoryQuery{Modality: modality, Limit: 20})
+	return processedNotifications, errHistory
+}
+
+func (s *memoryStore) NotificationGetHistory(query NotificationHistoryQuery) (*[]Notification, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	notifications := make([]Notification, 0)
+	for _, notification := range s.notifications {
+		if query.matches(&notification) {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool {
+		if notifications[i].CreatedAt != notifications[j].CreatedAt {
+			return notifications[i].CreatedAt > notifications[j].CreatedAt
+		}
+		return notifications[i].NotificationID > notifications[j].NotificationID
+	})
+
+	total := len(notifications)
+
+	if query.Limit > 0 {
+		start := query.Offset
+		if start > total {
+			start = total
+		}
+		end := start + query.Limit
+		if end > total {
+			end = total
+		}
+		notifications = notifications[start:end]
+	}
+
+	return &notifications, total, nil
+}
+
+func (s *memoryStore) NotificationGetByCreatedAt(from int64, to int64) (*[]Notification, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	notifications := make([]Notification, 0)
+	for _, notification := range s.notifications {
+		if notification.CreatedAt >= from && notification.CreatedAt < to {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool {
+		if notifications[i].CreatedAt != notifications[j].CreatedAt {
+			return notifications[i].CreatedAt < notifications[j].CreatedAt
+		}
+		return notifications[i].NotificationID < notifications[j].NotificationID
+	})
+
+	return &notifications, nil
+}
+
+func (s *memoryStore) NotificationCancel(modality string, department string, cancelledAt int64, cancelledBy string, clientAddress string) (*Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	notification := s.findOpen(department, modality)
+	if notification == nil {
+		return nil, nil
+	}
+
+	notification.CancelledAt = cancelledAt
+	notification.CancelledBy = cancelledBy
+
+	s.events = append(s.events, NotificationEvent{
+		EventID:        uuid.New().String(),
+		NotificationID: notification.NotificationID,
+		EventType:      NotificationEventCancelled,
+		CreatedAt:      cancelledAt,
+		ClientAddress:  clientAddress,
+	})
+
+	cancelled := *notification
+	return &cancelled, nil
+}
+
+func (s *memoryStore) NotificationChangePriority(notificationID string, priority int, now int64, clientAddress string) (*Notification, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.notifications {
+		notification := &s.notifications[i]
+		if notification.NotificationID != notificationID {
+			continue
+		}
+
+		if !isOpen(notification) {
+			return nil, ErrNotificationNotOpen
+		}
+
+		if notification.Priority != priority {
+			s.events = append(s.events, NotificationEvent{
+				EventID:        uuid.New().String(),
+				NotificationID: notificationID,
+				EventType:      NotificationEventPriority,
+				CreatedAt:      now,
+				PreviousValue:  strconv.Itoa(notification.Priority),
+				NewValue:       strconv.Itoa(priority),
+				ClientAddress:  clientAddress,
+			})
+			notification.Priority = priority
+		}
+
+		changed := *notification
+		return &changed, nil
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) NotificationConfirm(notificationID string, now int64, confirmedBy string, clientAddress string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var rowsAffected int64
+	for i := range s.notifications {
+		notification := &s.notifications[i]
+		if notification.NotificationID == notificationID && isOpen(notification) {
+			notification.ConfirmedAt = now
+			notification.ConfirmedBy = confirmedBy
+			rowsAffected++
+
+			s.events = append(s.events, NotificationEvent{
+				EventID:        uuid.New().String(),
+				NotificationID: notificationID,
+				EventType:      NotificationEventConfirmed,
+				CreatedAt:      now,
+				ClientAddress:  clientAddress,
+			})
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+func (s *memoryStore) NotificationForward(notificationID string, department string, now int64, clientAddress string) (*NotificationEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.notifications {
+		notification := &s.notifications[i]
+		if notification.NotificationID != notificationID {
+			continue
+		}
+
+		if !isOpen(notification) {
+			return nil, ErrNotificationNotOpen
+		}
+
+		if notification.DepartmentID == department {
+			return nil, ErrNotificationInDepartment
+		}
+
+		if s.findOpen(department, notification.Modality) != nil {
+			return nil, ErrNotificationOpenInDepartment
+		}
+
+		event := NotificationEvent{
+			EventID:        uuid.New().String(),
+			NotificationID: notificationID,
+			EventType:      NotificationEventForwarded,
+			CreatedAt:      now,
+			PreviousValue:  notification.DepartmentID,
+			NewValue:       department,
+			ClientAddress:  clientAddress,
+		}
+
+		notification.DepartmentID = department
+		s.events = append(s.events, event)
+		return &event, nil
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) NotificationEventGetByNotificationID(notificationID string) (*[]NotificationEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	events := make([]NotificationEvent, 0)
+	for _, event := range s.events {
+		if event.NotificationID == notificationID {
+			events = append(events, event)
+		}
+	}
+
+	return &events, nil
+}
+
+func (s *memoryStore) ArduinoStatusInsert(status ArduinoStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.arduinoStatus[status.DepartmentID] = status
+	return nil
+}
+
+func (s *memoryStore) ArduinoStatusQueryWithin5MinutesFromNow(department string, now int64) (*ArduinoStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	status, exists := s.arduinoStatus[department]
+	if !exists || status.StatusAt <= now-300 {
+		return nil, nil
+	}
+
+	return &status, nil
+}
+
+func (s *memoryStore) DeviceHeartbeat(device Device) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if registered, exists := s.devices[device.DeviceID]; exists {
+		if device.Location == "" {
+			device.Location = registered.Location
+		}
+		if device.FirmwareVersion == "" {
+			device.FirmwareVersion = registered.FirmwareVersion
+		}
+	}
+
+	s.devices[device.DeviceID] = device
+
+	if device.Unauthenticated {
+		return nil
+	}
+
+	var current *DeviceUptimeInterval
+	for i := range s.uptime {
+		if s.uptime[i].DeviceID == device.DeviceID && (current == nil || s.uptime[i].StartedAt > current.StartedAt) {
+			current = &s.uptime[i]
+		}
+	}
+
+	switch {
+	case current != nil && current.EndedAt >= device.LastSeenAt:
+	case current != nil && current.EndedAt >= device.LastSeenAt-DeviceHeartbeatTolerance:
+		current.EndedAt = device.LastSeenAt
+	default:
+		s.uptime = append(s.uptime, DeviceUptimeInterval{
+			DeviceID:     device.DeviceID,
+			DepartmentID: device.DepartmentID,
+			StartedAt:    device.LastSeenAt,
+			EndedAt:      device.LastSeenAt,
+		})
+	}
+
+	return nil
+}
+
+func (s *memoryStore) DeviceGetByDepartment(department string) (*[]Device, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	devices := make([]Device, 0)
+	for _, device := range s.devices {
+		if device.DepartmentID == department {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		return devices[i].DeviceID < devices[j].DeviceID
+	})
+
+	return &devices, nil
+}
+
+func (s *memoryStore) DeviceUptimeGetByDepartment(department string, from int64, to int64) (*[]DeviceUptimeInterval, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	intervals := make([]DeviceUptimeInterval, 0)
+	for _, interval := range s.uptime {
+		if interval.DepartmentID == department && interval.EndedAt >= from && interval.StartedAt <= to {
+			intervals = append(intervals, interval)
+		}
+	}
+
+	sort.SliceStable(intervals, func(i, j int) bool {
+		if intervals[i].DeviceID != intervals[j].DeviceID {
+			return intervals[i].DeviceID < intervals[j].DeviceID
+		}
+		return intervals[i].StartedAt < intervals[j].StartedAt
+	})
+
+	return &intervals, nil
+}
+
+func (s *memoryStore) DeviceTokenInsert(token DeviceToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// mirrors the primary key on the device and the unique key on the hash
+	for _, existing := range s.deviceTokens {
+		if existing.DeviceID == token.DeviceID || existing.TokenHash == token.TokenHash {
+			return errors.Errorf("there is a token of the device %s already", existing.DeviceID)
+		}
+	}
+
+	s.deviceTokens[token.DeviceID] = token
+	return nil
+}
+
+func (s *memoryStore) DeviceTokenGetByHash(tokenHash string) (*DeviceToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, token := range s.deviceTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) DeviceTokenGetByDevice(deviceID string) (*DeviceToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, exists := s.deviceTokens[deviceID]
+	if !exists {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *memoryStore) DeviceTokenGetByDepartment(department string) (*[]DeviceToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := make([]DeviceToken, 0)
+	for _, token := range s.deviceTokens {
+		if department == "" || token.DepartmentID == department {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.SliceStable(tokens, func(i, j int) bool {
+		if tokens[i].DepartmentID != tokens[j].DepartmentID {
+			return tokens[i].DepartmentID < tokens[j].DepartmentID
+		}
+		return tokens[i].DeviceID < tokens[j].DeviceID
+	})
+
+	return &tokens, nil
+}
+
+func (s *memoryStore) DeviceTokenDelete(deviceID string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.deviceTokens[deviceID]; !exists {
+		return 0, nil
+	}
+
+	delete(s.deviceTokens, deviceID)
+	return 1, nil
+}
+
+func (s *memoryStore) UserInsert(user User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[user.Username]; exists {
+		// mirrors the primary key on the username
+		return errors.Errorf("there is a user %s already", user.Username)
+	}
+
+	s.users[user.Username] = user
+	return nil
+}
+
+func (s *memoryStore) UserGetByUsername(username string) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+func (s *memoryStore) UserGetAll() (*[]User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return &users, nil
+}
+
+func (s *memoryStore) UserUpdatePassword(username string, passwordHash string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return 0, nil
+	}
+
+	user.PasswordHash = passwordHash
+	s.users[username] = user
+	return 1, nil
+}
+
+func (s *memoryStore) UserUpdateRole(username string, role string, modality string, departmentID string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return 0, nil
+	}
+
+	user.Role = role
+	user.Modality = modality
+	user.DepartmentID = departmentID
+	s.users[username] = user
+	return 1, nil
+}
+
+func (s *memoryStore) UserDelete(username string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[username]; !exists {
+		return 0, nil
+	}
+
+	delete(s.users, username)
+	return 1, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package lmdatabase
+
+import (
+	"github.com/pkg/errors"
+)
+
+type sqlStore struct {
+	db *DB
+}
+
+// NewSQLStore returns a store backed by the given database
+func NewSQLStore(db *DB) Store {
+	return &sqlStore{db: db}
+}
+
+func (s *sqlStore) NotificationInsert(department string, priority int, modality string, createdAt int64) (string, error) {
+	return NotificationInsert(s.db, department, priority, modality, createdAt)
+}
+
+func (s *sqlStore) NotificationCreateOrEscalate(department string, priority int, modality string, details NotificationDetails, now int64, clientAddress string) (*NotificationEvent, error) {
+	return NotificationCreateOrEscalate(s.db, department, priority, modality, details, now, clientAddress)
+}
+
+func (s *sqlStore) NotificationGetOpenNotificationByDepartmentAndModality(department string, modality string) (*Notification, error) {
+	return NotificationGetOpenNotificationByDepartmentAndModality(s.db, department, modality)
+}
+
+func (s *sqlStore) NotificationGetByID(notificationID string) (*Notification, error) {
+	return NotificationGetByID(s.db, notificationID)
+}
+
+func (s *sqlStore) NotificationGetOpenNotificationsByDepartment(department string) (*[]Notification, error) {
+	return NotificationGetOpenNotificationsByDepartment(s.db, department)
+}
+
+func (s *sqlStore) NotificationGetProcessedNotificationsByModality(modality string) (*[]Notification, error) {
+	return NotificationGetProcessedNotificationsByModality(s.db, modality)
+}
+
+func (s *sqlStore) NotificationGetHistory(query NotificationHistoryQuery) (*[]Notification, int, error) {
+	return NotificationGetHistory(s.db, query)
+}
+
+func (s *sqlStore) NotificationGetByCreatedAt(from int64, to int64) (*[]Notification, error) {
+	return NotificationGetByCreatedAt(s.db, from, to)
+}
+
+func (s *sqlStore) NotificationCancel(modality string, department string, cancelledAt int64, cancelledBy string, clientAddress string) (*Notification, error) {
+	return NotificationCancel(s.db, modality, department, cancelledAt, cancelledBy, clientAddress)
+}
+
+func (s *sqlStore) NotificationChangePriority(notificationID string, priority int, now int64, clientAddress string) (*Notification, error) {
+	return NotificationChangePriority(s.db, notificationID, priority, now, clientAddress)
+}
+
+func (s *sqlStore) NotificationConfirm(notificationID string, now int64, confirmedBy string, clientAddress string) (int64, error) {
+	return NotificationConfirm(s.db, notificationID, now, confirmedBy, clientAddress)
+}
+
+func (s *sqlStore) NotificationForward(notificationID string, department string, now int64, clientAddress string) (*NotificationEvent, error) {
+	return NotificationForward(s.db, notificationID, department, now, clientAddress)
+}
+
+func (s *sqlStore) NotificationEventGetByNotificationID(notificationID string) (*[]NotificationEvent, error) {
+	return NotificationEventGetByNotificationID(s.db, notificationID)
+}
+
+func (s *sqlStore) ArduinoStatusInsert(status ArduinoStatus) error {
+	return ArduinoStatusInsert(s.db, status)
+}
+
+func (s *sqlStore) ArduinoStatusQueryWithin5MinutesFromNow(department string, now int64) (*ArduinoStatus, error) {
+	return ArduinoStatusQueryWithin5MinutesFromNow(s.db, department, now)
+}
+
+func (s *sqlStore) DeviceHeartbeat(device Device) error {
+	return DeviceHeartbeat(s.db, device)
+}
+
+func (s *sqlStore) DeviceGetByDepartment(department string) (*[]Device, error) {
+	return DeviceGetByDepartment(s.db, department)
+}
+
+func (s *sqlStore) DeviceUptimeGetByDepartment(department string, from int64, to int64) (*[]DeviceUptimeInterval, error) {
+	return DeviceUptimeGetByDepartment(s.db, department, from, to)
+}
+
+func (s *sqlStore) DeviceTokenInsert(token DeviceToken) error {
+	return DeviceTokenInsert(s.db, token)
+}
+
+func (s *sqlStore) DeviceTokenGetByHash(tokenHash string) (*DeviceToken, error) {
+	return DeviceTokenGetByHash(s.db, tokenHash)
+}
+
+func (s *sqlStore) DeviceTokenGetByDevice(deviceID string) (*DeviceToken, error) {
+	return DeviceTokenGetByDevice(s.db, deviceID)
+}
+
+func (s *sqlStore) DeviceTokenGetByDepartment(department string) (*[]DeviceToken, error) {
+	return DeviceTokenGetByDepartment(s.db, department)
+}
+
+func (s *sqlStore) DeviceTokenDelete(deviceID string) (int64, error) {
+	return DeviceTokenDelete(s.db, deviceID)
+}
+
+func (s *sqlStore) UserInsert(user User) error {
+	return UserInsert(s.db, user)
+}
+
+func (s *sqlStore) UserGetByUsername(username string) (*User, error) {
+	return UserGetByUsername(s.db, username)
+}
+
+func (s *sqlStore) UserGetAll() (*[]User, error) {
+	return UserGetAll(s.db)
+}
+
+func (s *sqlStore) UserUpdatePassword(username string, passwordHash string) (int64, error) {
+	return UserUpdatePassword(s.db, username, passwordHash)
+}
+
+func (s *sqlStore) UserUpdateRole(username string, role string, modality string, departmentID string) (int64, error) {
+	return UserUpdateRole(s.db, username, role, modality, departmentID)
+}
+
+func (s *sqlStore) UserDelete(username string) (int64, error) {
+	return UserDelete(s.db, username)
+}
+
+func (s *sqlStore) Close() error {
+	return errors.WithStack(s.db.Close())
+}
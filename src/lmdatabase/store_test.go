@@ -0,0 +1,850 @@
+package lmdatabase
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// storeTests are run against every store implementation to guarantee the same semantics
+var storeTests = []struct {
+	name string
+	test func(t *testing.T, store Store)
+}{
+	{"ShouldGetOpenNotificationByDepartmentAndModality", testStoreShouldGetOpenNotificationByDepartmentAndModality},
+	{"ShouldReturnPlaceholderWhenNoOpenNotification", testStoreShouldReturnPlaceholderWhenNoOpenNotification},
+	{"ShouldGetOpenNotificationsByDepartmentOrderedByPriority", testStoreShouldGetOpenNotificationsByDepartmentOrderedByPriority},
+	{"ShouldGetProcessedNotificationsByModality", testStoreShouldGetProcessedNotificationsByModality},
+	{"ShouldGetNotificationsByCreatedAt", testStoreShouldGetNotificationsByCreatedAt},
+	{"ShouldGetFilteredPageOfNotificationHistory", testStoreShouldGetFilteredPageOfNotificationHistory},
+	{"ShouldCancelOnlyOpenNotificationOfModalityAndDepartment", testStoreShouldCancelOnlyOpenNotificationOfModalityAndDepartment},
+	{"ShouldChangePriorityOfOpenNotificationOnly", testStoreShouldChangePriorityOfOpenNotificationOnly},
+	{"ShouldCreateThenEscalateNotification", testStoreShouldCreateThenEscalateNotification},
+	{"ShouldCreateOrEscalateConcurrentlyWithoutDuplicates", testStoreShouldCreateOrEscalateConcurrentlyWithoutDuplicates},
+	{"ShouldRejectSecondOpenNotification", testStoreShouldRejectSecondOpenNotification},
+	{"ShouldConfirmNotification", testStoreShouldConfirmNotification},
+	{"ShouldForwardNotificationToAnotherDepartment", testStoreShouldForwardNotificationToAnotherDepartment},
+	{"ShouldNotForwardWhenDepartmentHasOpenNotification", testStoreShouldNotForwardWhenDepartmentHasOpenNotification},
+	{"ShouldNotForwardToTheSameDepartment", testStoreShouldNotForwardToTheSameDepartment},
+	{"ShouldGetNotificationEventsInRecordedOrder", testStoreShouldGetNotificationEventsInRecordedOrder},
+	{"ShouldInsertAndUpdateArduinoStatus", testStoreShouldInsertAndUpdateArduinoStatus},
+	{"ShouldRegisterAndUpdateDevices", testStoreShouldRegisterAndUpdateDevices},
+	{"ShouldRecordDeviceUptimeIntervals", testStoreShouldRecordDeviceUptimeIntervals},
+	{"ShouldInsertAndDeleteDeviceTokens", testStoreShouldInsertAndDeleteDeviceTokens},
+	{"ShouldInsertUpdateAndDeleteUsers", testStoreShouldInsertUpdateAndDeleteUsers},
+}
+
+func TestUnitMemoryStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		test := storeTest.test
+		t.Run(storeTest.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			test(t, store)
+			store.Close()
+		})
+	}
+}
+
+func TestIntegrationSQLStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		test := storeTest.test
+		t.Run(storeTest.name, func(t *testing.T) {
+			db := setupTest(t)
+			test(t, NewSQLStore(db))
+			tearDownTest(t, db)
+		})
+	}
+}
+
+func TestIntegrationPostgresStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		test := storeTest.test
+		t.Run(storeTest.name, func(t *testing.T) {
+			db := setupPostgresTest(t)
+			test(t, NewSQLStore(db))
+			tearDownTest(t, db)
+		})
+	}
+}
+
+func TestIntegrationSQLiteStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		test := storeTest.test
+		t.Run(storeTest.name, func(t *testing.T) {
+			db, dir := setupSQLiteTest(t)
+			test(t, NewSQLStore(db))
+			tearDownSQLiteTest(t, db, dir)
+		})
+	}
+}
+
+func storeNotificationInsert(t *testing.T, store Store, department string, priority int, modality string, createdAt int64) *Notification {
+	_, errInsert := store.NotificationInsert(department, priority, modality, createdAt)
+	if errInsert != nil {
+		t.Fatalf("%+v", errors.WithStack(errInsert))
+	}
+
+	notification, errQuery := store.NotificationGetOpenNotificationByDepartmentAndModality(department, modality)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	return notification
+}
+
+func testStoreShouldGetOpenNotificationByDepartmentAndModality(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "abc", 2, "ct", 1000)
+
+	assert.NotEmpty(t, notification.NotificationID)
+	assert.Equal(t, "abc", notification.DepartmentID)
+	assert.Equal(t, "ct", notification.Modality)
+	assert.Equal(t, 2, notification.Priority)
+	assert.Equal(t, int64(1000), notification.CreatedAt)
+
+	byID, errQuery := store.NotificationGetByID(notification.NotificationID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, int64(-1), byID.ConfirmedAt)
+	assert.Equal(t, int64(-1), byID.CancelledAt)
+
+	unknown, errQueryUnknown := store.NotificationGetByID("unknown")
+	if errQueryUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknown))
+	}
+	assert.Nil(t, unknown)
+}
+
+func testStoreShouldReturnPlaceholderWhenNoOpenNotification(t *testing.T, store Store) {
+	storeNotificationInsert(t, store, "abc", 2, "mr", 1000)
+
+	notification, errQuery := store.NotificationGetOpenNotificationByDepartmentAndModality("abc", "ct")
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Empty(t, notification.NotificationID)
+	assert.Equal(t, "abc", notification.DepartmentID)
+	assert.Equal(t, "ct", notification.Modality)
+	assert.Equal(t, 99, notification.Priority)
+}
+
+func testStoreShouldGetOpenNotificationsByDepartmentOrderedByPriority(t *testing.T, store Store) {
+	storeNotificationInsert(t, store, "abc", 3, "x", 1000)
+	storeNotificationInsert(t, store, "abc", 1, "y", 1001)
+	storeNotificationInsert(t, store, "abc", 2, "z", 1002)
+	storeNotificationInsert(t, store, "def", 1, "x", 1003)
+	confirmed := storeNotificationInsert(t, store, "abc", 1, "w", 1004)
+
+	_, errConfirm := store.NotificationConfirm(confirmed.NotificationID, 1005, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+
+	notifications, errQuery := store.NotificationGetOpenNotificationsByDepartment("abc")
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 3, len(*notifications))
+	assert.Equal(t, "y", (*notifications)[0].Modality)
+	assert.Equal(t, "z", (*notifications)[1].Modality)
+	assert.Equal(t, "x", (*notifications)[2].Modality)
+}
+
+func testStoreShouldGetProcessedNotificationsByModality(t *testing.T, store Store) {
+	for i := 0; i < 25; i++ {
+		notification := storeNotificationInsert(t, store, "abc", 1, "ct", int64(1000+i))
+		_, errConfirm := store.NotificationConfirm(notification.NotificationID, int64(2000+i), "ws-1", "")
+		if errConfirm != nil {
+			t.Fatalf("%+v", errors.WithStack(errConfirm))
+		}
+	}
+	storeNotificationInsert(t, store, "def", 1, "ct", 3000) // open
+	storeNotificationInsert(t, store, "def", 1, "mr", 3001)
+	_, errCancel := store.NotificationCancel("mr", "def", 3002, "ws-2", "")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+
+	notifications, errQuery := store.NotificationGetProcessedNotificationsByModality("ct")
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 20, len(*notifications))
+	assert.Equal(t, int64(1024), (*notifications)[0].CreatedAt)
+	assert.Equal(t, int64(2024), (*notifications)[0].ConfirmedAt)
+	assert.Equal(t, int64(-1), (*notifications)[0].CancelledAt)
+	assert.Equal(t, "ws-1", (*notifications)[0].ConfirmedBy)
+	assert.Empty(t, (*notifications)[0].CancelledBy)
+	assert.Equal(t, int64(1005), (*notifications)[19].CreatedAt)
+
+	cancelled, errQueryCancelled := store.NotificationGetProcessedNotificationsByModality("mr")
+	if errQueryCancelled != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryCancelled))
+	}
+
+	assert.Equal(t, 1, len(*cancelled))
+	assert.Equal(t, int64(3002), (*cancelled)[0].CancelledAt)
+	assert.Equal(t, "ws-2", (*cancelled)[0].CancelledBy)
+}
+
+func testStoreShouldGetNotificationsByCreatedAt(t *testing.T, store Store) {
+	storeNotificationInsert(t, store, "abc", 1, "mr", 999)
+	confirmed := storeNotificationInsert(t, store, "abc", 2, "ct", 1000)
+	_, errConfirm := store.NotificationConfirm(confirmed.NotificationID, 1100, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+	storeNotificationInsert(t, store, "def", 3, "mr", 1500) // open
+	storeNotificationInsert(t, store, "def", 3, "ct", 2000)
+
+	notifications, errQuery := store.NotificationGetByCreatedAt(1000, 2000)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 2, len(*notifications))
+	assert.Equal(t, confirmed.NotificationID, (*notifications)[0].NotificationID)
+	assert.Equal(t, int64(1100), (*notifications)[0].ConfirmedAt)
+	assert.Equal(t, int64(-1), (*notifications)[0].CancelledAt)
+	assert.Equal(t, "mr", (*notifications)[1].Modality)
+	assert.Equal(t, int64(-1), (*notifications)[1].ConfirmedAt)
+}
+
+func testStoreShouldGetFilteredPageOfNotificationHistory(t *testing.T, store Store) {
+	for i := 0; i < 5; i++ {
+		notification := storeNotificationInsert(t, store, "abc", i%3+1, "ct", int64(1000+i))
+		_, errConfirm := store.NotificationConfirm(notification.NotificationID, int64(2000+i), "ws-1", "")
+		if errConfirm != nil {
+			t.Fatalf("%+v", errors.WithStack(errConfirm))
+		}
+	}
+	storeNotificationInsert(t, store, "abc", 1, "mr", 1100)
+	_, errCancel := store.NotificationCancel("mr", "abc", 1200, "ws-2", "")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+	storeNotificationInsert(t, store, "def", 1, "ct", 1300)
+	_, errCancelDef := store.NotificationCancel("ct", "def", 1400, "ws-2", "")
+	if errCancelDef != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancelDef))
+	}
+	storeNotificationInsert(t, store, "abc", 1, "ct", 1500) // open
+
+	page, total, errQuery := store.NotificationGetHistory(NotificationHistoryQuery{Department: "abc", Limit: 2, Offset: 2})
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, 6, total)
+	assert.Equal(t, 2, len(*page))
+	assert.Equal(t, int64(1003), (*page)[0].CreatedAt)
+	assert.Equal(t, int64(1002), (*page)[1].CreatedAt)
+
+	cancelled, totalCancelled, errQueryCancelled := store.NotificationGetHistory(NotificationHistoryQuery{Outcome: NotificationOutcomeCancelled})
+	if errQueryCancelled != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryCancelled))
+	}
+	assert.Equal(t, 2, totalCancelled)
+	assert.Equal(t, "def", (*cancelled)[0].DepartmentID)
+	assert.Equal(t, "ws-2", (*cancelled)[0].CancelledBy)
+
+	filtered, totalFiltered, errQueryFiltered := store.NotificationGetHistory(NotificationHistoryQuery{
+		Modality: "ct", Priority: 1, Outcome: NotificationOutcomeConfirmed, From: 1001, To: 1004})
+	if errQueryFiltered != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryFiltered))
+	}
+	assert.Equal(t, 1, totalFiltered)
+	assert.Equal(t, int64(1003), (*filtered)[0].CreatedAt)
+
+	filtered, totalFiltered, errQueryFiltered = store.NotificationGetHistory(NotificationHistoryQuery{
+		Modality: "ct", Priority: 1, Outcome: NotificationOutcomeConfirmed, From: 1000, To: 1004})
+	if errQueryFiltered != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryFiltered))
+	}
+	assert.Equal(t, 2, totalFiltered)
+	assert.Equal(t, int64(1003), (*filtered)[0].CreatedAt)
+	assert.Equal(t, int64(1000), (*filtered)[1].CreatedAt)
+}
+
+func testStoreShouldCancelOnlyOpenNotificationOfModalityAndDepartment(t *testing.T, store Store) {
+	cancel := storeNotificationInsert(t, store, "abc", 1, "ct", 1000)
+	otherModality := storeNotificationInsert(t, store, "abc", 1, "mr", 1000)
+	otherDepartment := storeNotificationInsert(t, store, "def", 1, "ct", 1000)
+
+	cancelled, errCancel := store.NotificationCancel("ct", "abc", 2000, "ws-2", "10.0.0.2")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+	assert.Equal(t, cancel.NotificationID, cancelled.NotificationID)
+	assert.Equal(t, int64(2000), cancelled.CancelledAt)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(cancel.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, 1, len(*events))
+	assert.Equal(t, NotificationEventCancelled, (*events)[0].EventType)
+	assert.Equal(t, "10.0.0.2", (*events)[0].ClientAddress)
+
+	cancelledAgain, errCancelAgain := store.NotificationCancel("ct", "abc", 3000, "ws-3", "")
+	if errCancelAgain != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancelAgain))
+	}
+	assert.Nil(t, cancelledAgain)
+
+	for notificationID, expectedCancelledAt := range map[string]int64{
+		cancel.NotificationID:          2000,
+		otherModality.NotificationID:   -1,
+		otherDepartment.NotificationID: -1,
+	} {
+		notification, errQuery := store.NotificationGetByID(notificationID)
+		if errQuery != nil {
+			t.Fatalf("%+v", errors.WithStack(errQuery))
+		}
+		assert.Equal(t, expectedCancelledAt, notification.CancelledAt)
+		if expectedCancelledAt != -1 {
+			assert.Equal(t, "ws-2", notification.CancelledBy)
+		} else {
+			assert.Empty(t, notification.CancelledBy)
+		}
+	}
+}
+
+func testStoreShouldChangePriorityOfOpenNotificationOnly(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "abc", 3, "ct", 1000)
+	confirmed := storeNotificationInsert(t, store, "abc", 3, "mr", 1000)
+
+	_, errConfirm := store.NotificationConfirm(confirmed.NotificationID, 1001, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+
+	changed, errChange := store.NotificationChangePriority(notification.NotificationID, 1, 1002, "10.0.0.1")
+	if errChange != nil {
+		t.Fatalf("%+v", errors.WithStack(errChange))
+	}
+
+	unchanged, errUnchanged := store.NotificationChangePriority(notification.NotificationID, 1, 1003, "10.0.0.1")
+	if errUnchanged != nil {
+		t.Fatalf("%+v", errors.WithStack(errUnchanged))
+	}
+
+	_, errClosed := store.NotificationChangePriority(confirmed.NotificationID, 1, 1004, "10.0.0.1")
+
+	unknown, errUnknown := store.NotificationChangePriority("unknown", 1, 1005, "10.0.0.1")
+	if errUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errUnknown))
+	}
+
+	assert.Equal(t, 1, changed.Priority)
+	assert.Equal(t, int64(1000), changed.CreatedAt)
+	assert.Equal(t, 1, unchanged.Priority)
+	assert.Equal(t, ErrNotificationNotOpen, errors.Cause(errClosed))
+	assert.Nil(t, unknown)
+
+	stored, errQuery := store.NotificationGetByID(confirmed.NotificationID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, 3, stored.Priority)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	if assert.Len(t, *events, 1) {
+		assert.Equal(t, NotificationEventPriority, (*events)[0].EventType)
+		assert.Equal(t, "3", (*events)[0].PreviousValue)
+		assert.Equal(t, "1", (*events)[0].NewValue)
+		assert.Equal(t, int64(1002), (*events)[0].CreatedAt)
+		assert.Equal(t, "10.0.0.1", (*events)[0].ClientAddress)
+	}
+}
+
+func testStoreShouldCreateThenEscalateNotification(t *testing.T, store Store) {
+	created, errCreate := store.NotificationCreateOrEscalate("abc", 3, "ct", NotificationDetails{Message: "Kontrastmittel?", Room: "CT 2"}, 1000, "10.0.0.1")
+	if errCreate != nil {
+		t.Fatalf("%+v", errors.WithStack(errCreate))
+	}
+
+	escalated, errEscalate := store.NotificationCreateOrEscalate("abc", 1, "ct", NotificationDetails{Room: "CT 1", AccessionNumber: "A123"}, 1001, "10.0.0.2")
+	if errEscalate != nil {
+		t.Fatalf("%+v", errors.WithStack(errEscalate))
+	}
+
+	assert.Equal(t, NotificationEventCreated, created.EventType)
+	assert.Equal(t, "3", created.NewValue)
+	assert.Equal(t, NotificationEventPriority, escalated.EventType)
+	assert.Equal(t, created.NotificationID, escalated.NotificationID)
+	assert.Equal(t, "3", escalated.PreviousValue)
+	assert.Equal(t, "1", escalated.NewValue)
+
+	notification := storeGetOpenNotification(t, store, "abc", "ct")
+	assert.Equal(t, created.NotificationID, notification.NotificationID)
+	assert.Equal(t, 1, notification.Priority)
+	assert.Equal(t, int64(1000), notification.CreatedAt)
+	assert.Equal(t, NotificationDetails{Message: "Kontrastmittel?", Room: "CT 1", AccessionNumber: "A123"}, notification.NotificationDetails)
+
+	byID, errQuery := store.NotificationGetByID(created.NotificationID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, notification.NotificationDetails, byID.NotificationDetails)
+
+	openNotifications, errQueryOpen := store.NotificationGetOpenNotificationsByDepartment("abc")
+	if errQueryOpen != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryOpen))
+	}
+	assert.Equal(t, "Kontrastmittel?", (*openNotifications)[0].Message)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(created.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, 2, len(*events))
+	assert.Equal(t, "10.0.0.2", (*events)[1].ClientAddress)
+}
+
+func testStoreShouldCreateOrEscalateConcurrentlyWithoutDuplicates(t *testing.T, store Store) {
+	const concurrency = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(priority int) {
+			defer wg.Done()
+			_, errCreate := store.NotificationCreateOrEscalate("abc", priority, "ct", NotificationDetails{}, 1000, "")
+			errs <- errCreate
+		}(i%3 + 1)
+	}
+	wg.Wait()
+	close(errs)
+
+	for errCreate := range errs {
+		assert.NoError(t, errCreate)
+	}
+
+	openNotifications, errQuery := store.NotificationGetOpenNotificationsByDepartment("abc")
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, 1, len(*openNotifications))
+
+	events, errEvents := store.NotificationEventGetByNotificationID((*openNotifications)[0].NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, concurrency, len(*events))
+	assert.Equal(t, NotificationEventCreated, (*events)[0].EventType)
+}
+
+func testStoreShouldRejectSecondOpenNotification(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "abc", 2, "ct", 1000)
+
+	_, errInsert := store.NotificationInsert("abc", 1, "ct", 1001)
+	assert.Error(t, errInsert)
+
+	_, errConfirm := store.NotificationConfirm(notification.NotificationID, 1002, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+
+	storeNotificationInsert(t, store, "abc", 1, "ct", 1003)
+}
+
+func storeGetOpenNotification(t *testing.T, store Store, department string, modality string) *Notification {
+	notification, errQuery := store.NotificationGetOpenNotificationByDepartmentAndModality(department, modality)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	return notification
+}
+
+func testStoreShouldConfirmNotification(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "abc", 3, "ct", 1000)
+
+	rowsAffected, errConfirm := store.NotificationConfirm(notification.NotificationID, 2000, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+	assert.Equal(t, int64(1), rowsAffected)
+
+	rowsAffectedUnknown, errConfirmUnknown := store.NotificationConfirm("unknown", 2000, "ws-1", "")
+	if errConfirmUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirmUnknown))
+	}
+	assert.Equal(t, int64(0), rowsAffectedUnknown)
+
+	rowsAffectedAgain, errConfirmAgain := store.NotificationConfirm(notification.NotificationID, 3000, "ws-2", "")
+	if errConfirmAgain != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirmAgain))
+	}
+	assert.Equal(t, int64(0), rowsAffectedAgain)
+
+	cancelled := storeNotificationInsert(t, store, "def", 3, "ct", 1000)
+	_, errCancel := store.NotificationCancel("ct", "def", 1500, "ws-2", "")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+
+	rowsAffectedCancelled, errConfirmCancelled := store.NotificationConfirm(cancelled.NotificationID, 2000, "ws-1", "")
+	if errConfirmCancelled != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirmCancelled))
+	}
+	assert.Equal(t, int64(0), rowsAffectedCancelled)
+
+	confirmed, errQuery := store.NotificationGetByID(notification.NotificationID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, int64(2000), confirmed.ConfirmedAt)
+	assert.Equal(t, "ws-1", confirmed.ConfirmedBy)
+
+	stillCancelled, errQueryCancelled := store.NotificationGetByID(cancelled.NotificationID)
+	if errQueryCancelled != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryCancelled))
+	}
+	assert.Equal(t, int64(-1), stillCancelled.ConfirmedAt)
+}
+
+func testStoreShouldForwardNotificationToAnotherDepartment(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "msk", 2, "ct", 1000)
+
+	event, errForward := store.NotificationForward(notification.NotificationID, "nr", 1001, "10.0.0.1")
+	if errForward != nil {
+		t.Fatalf("%+v", errors.WithStack(errForward))
+	}
+
+	assert.Equal(t, NotificationEventForwarded, event.EventType)
+	assert.Equal(t, "msk", event.PreviousValue)
+	assert.Equal(t, "nr", event.NewValue)
+
+	forwarded := storeGetOpenNotification(t, store, "nr", "ct")
+	assert.Equal(t, notification.NotificationID, forwarded.NotificationID)
+	assert.Equal(t, 2, forwarded.Priority)
+	assert.Equal(t, int64(1000), forwarded.CreatedAt)
+	assert.Empty(t, storeGetOpenNotification(t, store, "msk", "ct").NotificationID)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, 1, len(*events))
+
+	unknown, errForwardUnknown := store.NotificationForward("unknown", "nr", 1002, "")
+	if errForwardUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errForwardUnknown))
+	}
+	assert.Nil(t, unknown)
+
+	_, errConfirm := store.NotificationConfirm(notification.NotificationID, 1003, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+	_, errForwardConfirmed := store.NotificationForward(notification.NotificationID, "msk", 1004, "")
+	assert.Equal(t, ErrNotificationNotOpen, errors.Cause(errForwardConfirmed))
+}
+
+func testStoreShouldNotForwardWhenDepartmentHasOpenNotification(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "msk", 2, "ct", 1000)
+	storeNotificationInsert(t, store, "nr", 3, "ct", 1001)
+
+	_, errForward := store.NotificationForward(notification.NotificationID, "nr", 1002, "")
+	assert.Equal(t, ErrNotificationOpenInDepartment, errors.Cause(errForward))
+
+	unchanged := storeGetOpenNotification(t, store, "msk", "ct")
+	assert.Equal(t, notification.NotificationID, unchanged.NotificationID)
+}
+
+func testStoreShouldNotForwardToTheSameDepartment(t *testing.T, store Store) {
+	notification := storeNotificationInsert(t, store, "msk", 2, "ct", 1000)
+
+	_, errForward := store.NotificationForward(notification.NotificationID, "msk", 1001, "")
+	assert.Equal(t, ErrNotificationInDepartment, errors.Cause(errForward))
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Empty(t, *events)
+}
+
+func testStoreShouldGetNotificationEventsInRecordedOrder(t *testing.T, store Store) {
+	// all changes within the same second
+	created, errCreate := store.NotificationCreateOrEscalate("abc", 3, "ct", NotificationDetails{}, 1000, "10.0.0.1")
+	if errCreate != nil {
+		t.Fatalf("%+v", errors.WithStack(errCreate))
+	}
+	for _, priority := range []int{2, 1} {
+		_, errEscalate := store.NotificationCreateOrEscalate("abc", priority, "ct", NotificationDetails{}, 1000, "10.0.0.1")
+		if errEscalate != nil {
+			t.Fatalf("%+v", errors.WithStack(errEscalate))
+		}
+	}
+	for _, department := range []string{"def", "abc"} {
+		_, errForward := store.NotificationForward(created.NotificationID, department, 1000, "10.0.0.1")
+		if errForward != nil {
+			t.Fatalf("%+v", errors.WithStack(errForward))
+		}
+	}
+	_, errConfirm := store.NotificationConfirm(created.NotificationID, 1000, "ws-1", "10.0.0.2")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+	_, errCreateOther := store.NotificationCreateOrEscalate("abc", 2, "mr", NotificationDetails{}, 1000, "")
+	if errCreateOther != nil {
+		t.Fatalf("%+v", errors.WithStack(errCreateOther))
+	}
+
+	events, errQuery := store.NotificationEventGetByNotificationID(created.NotificationID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	recorded := make([]string, 0)
+	for _, event := range *events {
+		assert.NotEmpty(t, event.EventID)
+		recorded = append(recorded, event.EventType+" "+event.PreviousValue+" "+event.NewValue)
+	}
+	assert.Equal(t, []string{
+		NotificationEventCreated + "  3",
+		NotificationEventPriority + " 3 2",
+		NotificationEventPriority + " 2 1",
+		NotificationEventForwarded + " abc def",
+		NotificationEventForwarded + " def abc",
+		NotificationEventConfirmed + "  ",
+	}, recorded)
+	assert.Equal(t, "10.0.0.2", (*events)[5].ClientAddress)
+}
+
+func testStoreShouldInsertAndUpdateArduinoStatus(t *testing.T, store Store) {
+	errInsert := store.ArduinoStatusInsert(ArduinoStatus{DepartmentID: "abc", StatusAt: 1000})
+	if errInsert != nil {
+		t.Fatalf("%+v", errors.WithStack(errInsert))
+	}
+
+	status, errQuery := store.ArduinoStatusQueryWithin5MinutesFromNow("abc", 1299)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.NotNil(t, status)
+
+	expired, errQueryExpired := store.ArduinoStatusQueryWithin5MinutesFromNow("abc", 1300)
+	if errQueryExpired != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryExpired))
+	}
+	assert.Nil(t, expired)
+
+	errUpdate := store.ArduinoStatusInsert(ArduinoStatus{DepartmentID: "abc", StatusAt: 2000})
+	if errUpdate != nil {
+		t.Fatalf("%+v", errors.WithStack(errUpdate))
+	}
+
+	updated, errQueryUpdated := store.ArduinoStatusQueryWithin5MinutesFromNow("abc", 2000)
+	if errQueryUpdated != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUpdated))
+	}
+	assert.Equal(t, int64(2000), updated.StatusAt)
+
+	unknown, errQueryUnknown := store.ArduinoStatusQueryWithin5MinutesFromNow("def", 2000)
+	if errQueryUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknown))
+	}
+	assert.Nil(t, unknown)
+}
+
+func testStoreShouldRegisterAndUpdateDevices(t *testing.T, store Store) {
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-2", DepartmentID: "abc", Location: "Befundraum 2", FirmwareVersion: "1.0", LastSeenAt: 1000, RemoteAddress: "10.0.0.2"})
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-1", DepartmentID: "abc", Location: "Befundraum 1", FirmwareVersion: "1.0", LastSeenAt: 1000, RemoteAddress: "10.0.0.1"})
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-3", DepartmentID: "def", LastSeenAt: 1000, RemoteAddress: "10.0.0.3"})
+
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-1", DepartmentID: "abc", FirmwareVersion: "1.1", LastSeenAt: 1200, RemoteAddress: "10.0.0.11", Unauthenticated: true})
+
+	devices, errQuery := store.DeviceGetByDepartment("abc")
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 2, len(*devices))
+
+	updated := (*devices)[0]
+	assert.Equal(t, "light-1", updated.DeviceID)
+	assert.Equal(t, "abc", updated.DepartmentID)
+	assert.Equal(t, "Befundraum 1", updated.Location)
+	assert.Equal(t, "1.1", updated.FirmwareVersion)
+	assert.Equal(t, int64(1200), updated.LastSeenAt)
+	assert.Equal(t, "10.0.0.11", updated.RemoteAddress)
+	assert.True(t, updated.Unauthenticated)
+	assert.True(t, updated.SeenWithin5MinutesFrom(1300))
+
+	unchanged := (*devices)[1]
+	assert.Equal(t, "light-2", unchanged.DeviceID)
+	assert.Equal(t, int64(1000), unchanged.LastSeenAt)
+	assert.False(t, unchanged.Unauthenticated)
+	assert.False(t, unchanged.SeenWithin5MinutesFrom(1300))
+
+	unknown, errQueryUnknown := store.DeviceGetByDepartment("xyz")
+	if errQueryUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknown))
+	}
+	assert.Empty(t, *unknown)
+}
+
+func testStoreShouldInsertAndDeleteDeviceTokens(t *testing.T, store Store) {
+	light1 := DeviceToken{DeviceID: "light-1", DepartmentID: "def", TokenHash: strings.Repeat("1", 64), CreatedAt: 1000}
+	light2 := DeviceToken{DeviceID: "light-2", DepartmentID: "abc", TokenHash: strings.Repeat("2", 64), Secret: strings.Repeat("s", 64), CreatedAt: 1001}
+	light3 := DeviceToken{DeviceID: "light-3", DepartmentID: "abc", TokenHash: strings.Repeat("3", 64), CreatedAt: 1002}
+
+	for _, token := range []DeviceToken{light3, light1, light2} {
+		if errInsert := store.DeviceTokenInsert(token); errInsert != nil {
+			t.Fatalf("%+v", errors.WithStack(errInsert))
+		}
+	}
+
+	assert.Error(t, store.DeviceTokenInsert(DeviceToken{DeviceID: "light-1", DepartmentID: "abc", TokenHash: strings.Repeat("4", 64)}))
+	assert.Error(t, store.DeviceTokenInsert(DeviceToken{DeviceID: "light-4", DepartmentID: "abc", TokenHash: strings.Repeat("1", 64)}))
+
+	all, errQueryAll := store.DeviceTokenGetByDepartment("")
+	if errQueryAll != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryAll))
+	}
+	assert.Equal(t, []DeviceToken{light2, light3, light1}, *all)
+
+	abc, errQueryAbc := store.DeviceTokenGetByDepartment("abc")
+	if errQueryAbc != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryAbc))
+	}
+	assert.Equal(t, []DeviceToken{light2, light3}, *abc)
+
+	token, errQueryToken := store.DeviceTokenGetByHash(strings.Repeat("3", 64))
+	if errQueryToken != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryToken))
+	}
+	assert.Equal(t, light3, *token)
+
+	signing, errQuerySigning := store.DeviceTokenGetByDevice("light-2")
+	if errQuerySigning != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuerySigning))
+	}
+	assert.Equal(t, light2, *signing)
+
+	deleted, errDelete := store.DeviceTokenDelete("light-3")
+	if errDelete != nil {
+		t.Fatalf("%+v", errors.WithStack(errDelete))
+	}
+	assert.Equal(t, int64(1), deleted)
+
+	unknown, errQueryUnknown := store.DeviceTokenGetByHash(strings.Repeat("3", 64))
+	if errQueryUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknown))
+	}
+	assert.Nil(t, unknown)
+
+	unknownDevice, errQueryUnknownDevice := store.DeviceTokenGetByDevice("light-3")
+	if errQueryUnknownDevice != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknownDevice))
+	}
+	assert.Nil(t, unknownDevice)
+}
+
+func testStoreShouldRecordDeviceUptimeIntervals(t *testing.T, store Store) {
+	for _, lastSeenAt := range []int64{1000, 1100, 1100, 1400, 1800, 1900} {
+		storeDeviceHeartbeat(t, store, Device{DeviceID: "light-1", DepartmentID: "abc", LastSeenAt: lastSeenAt})
+	}
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-2", DepartmentID: "abc", LastSeenAt: 1200})
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-3", DepartmentID: "def", LastSeenAt: 1200})
+	// heartbeats without valid token don't prove the light was up
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-1", DepartmentID: "abc", LastSeenAt: 1600, Unauthenticated: true})
+	storeDeviceHeartbeat(t, store, Device{DeviceID: "light-4", DepartmentID: "abc", LastSeenAt: 1200, Unauthenticated: true})
+
+	intervals, errQuery := store.DeviceUptimeGetByDepartment("abc", 0, 5000)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, []DeviceUptimeInterval{
+		{DeviceID: "light-1", DepartmentID: "abc", StartedAt: 1000, EndedAt: 1400},
+		{DeviceID: "light-1", DepartmentID: "abc", StartedAt: 1800, EndedAt: 1900},
+		{DeviceID: "light-2", DepartmentID: "abc", StartedAt: 1200, EndedAt: 1200},
+	}, *intervals)
+
+	overlapping, errQueryOverlapping := store.DeviceUptimeGetByDepartment("abc", 1300, 1700)
+	if errQueryOverlapping != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryOverlapping))
+	}
+
+	assert.Equal(t, 1, len(*overlapping))
+	assert.Equal(t, int64(1000), (*overlapping)[0].StartedAt)
+}
+
+func storeDeviceHeartbeat(t *testing.T, store Store, device Device) {
+	errHeartbeat := store.DeviceHeartbeat(device)
+	if errHeartbeat != nil {
+		t.Fatalf("%+v", errors.WithStack(errHeartbeat))
+	}
+}
+
+func testStoreShouldInsertUpdateAndDeleteUsers(t *testing.T, store Store) {
+	mtra := User{Username: "mtra-ct", PasswordHash: "hash-1", Role: RoleMTRA, Modality: "ct", CreatedAt: 1000}
+	radiologist := User{Username: "radiologist-msk", PasswordHash: "hash-2", Role: RoleRadiologist, DepartmentID: "msk", CreatedAt: 1001}
+
+	for _, user := range []User{radiologist, mtra} {
+		if errInsert := store.UserInsert(user); errInsert != nil {
+			t.Fatalf("%+v", errors.WithStack(errInsert))
+		}
+	}
+
+	assert.Error(t, store.UserInsert(User{Username: "mtra-ct", PasswordHash: "hash-3", Role: RoleAdmin, CreatedAt: 1002}))
+
+	users, errQuery := store.UserGetAll()
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, []User{mtra, radiologist}, *users)
+
+	updated, errUpdate := store.UserUpdatePassword("mtra-ct", "hash-4")
+	if errUpdate != nil {
+		t.Fatalf("%+v", errors.WithStack(errUpdate))
+	}
+	assert.Equal(t, int64(1), updated)
+
+	user, errQueryUser := store.UserGetByUsername("mtra-ct")
+	if errQueryUser != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUser))
+	}
+	assert.Equal(t, "hash-4", user.PasswordHash)
+
+	if _, errUpdateRole := store.UserUpdateRole("mtra-ct", RoleRadiologist, "", "nr"); errUpdateRole != nil {
+		t.Fatalf("%+v", errors.WithStack(errUpdateRole))
+	}
+
+	radiologistNr, errQueryRadiologistNr := store.UserGetByUsername("mtra-ct")
+	if errQueryRadiologistNr != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryRadiologistNr))
+	}
+	assert.Equal(t, User{Username: "mtra-ct", PasswordHash: "hash-4", Role: RoleRadiologist, DepartmentID: "nr", CreatedAt: 1000}, *radiologistNr)
+
+	deleted, errDelete := store.UserDelete("radiologist-msk")
+	if errDelete != nil {
+		t.Fatalf("%+v", errors.WithStack(errDelete))
+	}
+	assert.Equal(t, int64(1), deleted)
+
+	unknown, errQueryUnknown := store.UserGetByUsername("radiologist-msk")
+	if errQueryUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errQueryUnknown))
+	}
+	assert.Nil(t, unknown)
+
+	updatedUnknown, errUpdateUnknown := store.UserUpdatePassword("radiologist-msk", "hash-5")
+	if errUpdateUnknown != nil {
+		t.Fatalf("%+v", errors.WithStack(errUpdateUnknown))
+	}
+	assert.Equal(t, int64(0), updatedUnknown)
+}
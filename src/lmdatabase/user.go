@@ -0,0 +1,165 @@
+package lmdatabase
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// values of User.Role
+const (
+	RoleMTRA        = "mtra"
+	RoleRadiologist = "radiologist"
+	RoleAdmin       = "admin"
+)
+
+// Roles are the known roles of users
+var Roles = []string{RoleMTRA, RoleRadiologist, RoleAdmin}
+
+// User is a login of the pages. MTRAs create and cancel the notifications of their modality, radiologists confirm
+// the notifications of their department and admins may do both for all modalities and departments.
+type User struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	Modality     string // of MTRAs, empty otherwise
+	DepartmentID string // of radiologists, empty otherwise
+	CreatedAt    int64
+}
+
+// UserInsert ..
+func UserInsert(db *DB, user User) error {
+	insertStmt, err := db.Prepare(`
+	INSERT INTO
+		UserAccount (username, passwordHash, role, modality, departmentId, createdAt)
+	VALUES( ?, ?, ?, ?, ?, ? )`)
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer insertStmt.Close()
+
+	_, errExec := insertStmt.Exec(user.Username, user.PasswordHash, user.Role, user.Modality, user.DepartmentID, user.CreatedAt)
+	if errExec != nil {
+		return errors.WithStack(errExec)
+	}
+
+	return nil
+}
+
+// UserGetByUsername returns nil if there is no user with the username
+func UserGetByUsername(db *DB, username string) (*User, error) {
+	var user User
+
+	errQuery := db.QueryRow(`
+	SELECT
+		username, passwordHash, role, modality, departmentId, createdAt
+	FROM
+		UserAccount
+	WHERE
+		username = ?`, username).Scan(&user.Username, &user.PasswordHash, &user.Role, &user.Modality, &user.DepartmentID, &user.CreatedAt)
+
+	if errQuery == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	return &user, nil
+}
+
+// UserGetAll returns all users ordered by username
+func UserGetAll(db *DB) (*[]User, error) {
+	rows, errQuery := db.Query(`
+	SELECT
+		username, passwordHash, role, modality, departmentId, createdAt
+	FROM
+		UserAccount
+	ORDER BY
+		username`)
+	if errQuery != nil {
+		return nil, errors.WithStack(errQuery)
+	}
+
+	defer rows.Close()
+
+	users := make([]User, 0)
+
+	for rows.Next() {
+		var user User
+		if errRowScan := rows.Scan(&user.Username, &user.PasswordHash, &user.Role, &user.Modality, &user.DepartmentID, &user.CreatedAt); errRowScan != nil {
+			return nil, errors.WithStack(errRowScan)
+		}
+		users = append(users, user)
+	}
+
+	if errRows := rows.Err(); errRows != nil {
+		return nil, errors.WithStack(errRows)
+	}
+
+	return &users, nil
+}
+
+// UserUpdatePassword returns the number of updated users, 0 if there is no user with the username
+func UserUpdatePassword(db *DB, username string, passwordHash string) (int64, error) {
+	result, errExec := db.Exec(`
+	UPDATE
+		UserAccount
+	SET
+		passwordHash = ?
+	WHERE
+		username = ?`, passwordHash, username)
+	if errExec != nil {
+		return 0, errors.WithStack(errExec)
+	}
+
+	rowsAffected, errRowsAffected := result.RowsAffected()
+	if errRowsAffected != nil {
+		return 0, errors.WithStack(errRowsAffected)
+	}
+
+	return rowsAffected, nil
+}
+
+// UserUpdateRole returns the number of updated users, 0 if there is no user with the username
+func UserUpdateRole(db *DB, username string, role string, modality string, departmentID string) (int64, error) {
+	result, errExec := db.Exec(`
+	UPDATE
+		UserAccount
+	SET
+		role = ?, modality = ?, departmentId = ?
+	WHERE
+		username = ?`, role, modality, departmentID, username)
+	if errExec != nil {
+		return 0, errors.WithStack(errExec)
+	}
+
+	rowsAffected, errRowsAffected := result.RowsAffected()
+	if errRowsAffected != nil {
+		return 0, errors.WithStack(errRowsAffected)
+	}
+
+	return rowsAffected, nil
+}
+
+// UserDelete returns the number of deleted users, 0 if there is no user with the username
+func UserDelete(db *DB, username string) (int64, error) {
+	result, errExec := db.Exec(`
+	DELETE FROM
+		UserAccount
+	WHERE
+		username = ?`, username)
+	if errExec != nil {
+		return 0, errors.WithStack(errExec)
+	}
+
+	rowsAffected, errRowsAffected := result.RowsAffected()
+	if errRowsAffected != nil {
+		return 0, errors.WithStack(errRowsAffected)
+	}
+
+	return rowsAffected, nil
+}
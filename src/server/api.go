@@ -0,0 +1,620 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/eventbus"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// the api
+const (
+	APIPrefix           = "/api/v1"
+	APIContentTypeValue = "application/json; charset=utf-8"
+	apiMediaType        = "application/json"
+	apiDefaultLimit     = 50
+	apiMaxLimit         = 500
+)
+
+// values of apiNotification.Status and of the status filter of the notification list
+const (
+	apiStatusOpen      = "open"
+	apiStatusConfirmed = lmdatabase.NotificationOutcomeConfirmed
+	apiStatusCancelled = lmdatabase.NotificationOutcomeCancelled
+	apiStatusProcessed = "processed"
+)
+
+// apiNotification is the notification resource, times are null until the notification is confirmed or cancelled
+type apiNotification struct {
+	ID              string     `json:"id"`
+	Department      string     `json:"department"`
+	Modality        string     `json:"modality"`
+	Priority        int        `json:"priority"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	ConfirmedAt     *time.Time `json:"confirmedAt"`
+	ConfirmedBy     string     `json:"confirmedBy"`
+	CancelledAt     *time.Time `json:"cancelledAt"`
+	CancelledBy     string     `json:"cancelledBy"`
+	Message         string     `json:"message"`
+	Room            string     `json:"room"`
+	AccessionNumber string     `json:"accessionNumber"`
+}
+
+// apiNotificationList is a page of notifications with the number of all notifications selected by the filters
+type apiNotificationList struct {
+	Notifications []apiNotification `json:"notifications"`
+	Total         int               `json:"total"`
+}
+
+// apiNotificationCreate is the request body to create a notification or to change the priority of the open one
+type apiNotificationCreate struct {
+	Department      string `json:"department"`
+	Modality        string `json:"modality"`
+	Priority        int    `json:"priority"`
+	Message         string `json:"message"`
+	Room            string `json:"room"`
+	AccessionNumber string `json:"accessionNumber"`
+}
+
+// apiNotificationUpdate is the request body to change the priority of an open notification
+type apiNotificationUpdate struct {
+	Priority int `json:"priority"`
+}
+
+// apiDepartment is the department resource, it is connected if any of its lights sent an authenticated heartbeat
+// recently
+type apiDepartment struct {
+	ID        string      `json:"id"`
+	Connected bool        `json:"connected"`
+	Devices   []apiDevice `json:"devices"`
+}
+
+// apiModality is the modality resource
+type apiModality struct {
+	ID string `json:"id"`
+}
+
+// apiDevice is the resource of a light registered by its heartbeats
+type apiDevice struct {
+	ID              string    `json:"id"`
+	Department      string    `json:"department"`
+	Location        string    `json:"location"`
+	FirmwareVersion string    `json:"firmwareVersion"`
+	LastSeenAt      time.Time `json:"lastSeenAt"`
+	RemoteAddress   string    `json:"remoteAddress"`
+	Connected       bool      `json:"connected"`
+	Unauthenticated bool      `json:"unauthenticated"`
+}
+
+// apiError is the body of every error response
+type apiError struct {
+	Error apiErrorDetails `json:"error"`
+}
+
+type apiErrorDetails struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func registerAPIRoutes(r *mux.Router, initConfig *configuration.Configuration, store lmdatabase.Store, bus *eventbus.Bus, authenticator *authentication.Authenticator) {
+	methodNotAllowed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method "+r.Method+" is not allowed on "+r.URL.Path)
+	})
+
+	// mux hands requests whose method matches no route of a subrouter to the handler of the subrouter's own route
+	api := r.PathPrefix(APIPrefix).Handler(methodNotAllowed).Subrouter()
+
+	api.Handle("/notifications", apiHandler{store, initConfig, apiNotificationListHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/notifications", apiHandler{store, initConfig, apiNotificationCreateHandler, authenticator, accessMTRA}).Methods(http.MethodPost)
+	api.Handle("/notifications/{id}", apiHandler{store, initConfig, apiNotificationGetHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/notifications/{id}", apiHandler{store, initConfig, apiNotificationUpdateHandler, authenticator, accessMTRA}).Methods(http.MethodPatch)
+	api.Handle("/notifications/{id}", apiHandler{store, initConfig, apiNotificationCancelHandler, authenticator, accessMTRA}).Methods(http.MethodDelete)
+	api.Handle("/notifications/{id}/confirm", apiHandler{store, initConfig, apiNotificationConfirmHandler, authenticator, accessRadiologist}).Methods(http.MethodPost)
+
+	api.Handle("/departments", apiHandler{store, initConfig, apiDepartmentListHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/departments/{id}", apiHandler{store, initConfig, apiDepartmentGetHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/modalities", apiHandler{store, initConfig, apiModalityListHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/devices", apiHandler{store, initConfig, apiDeviceListHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	api.Handle("/websocket", apiHandler{store, initConfig, apiWebSocketHandler(bus), authenticator, accessUser}).Methods(http.MethodGet)
+
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "unknown resource "+r.URL.Path)
+	})
+	api.MethodNotAllowedHandler = methodNotAllowed
+}
+
+// openAPIHandler serves the OpenAPI document that describes all routes
+func openAPIHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	document, errDocument := box.Bytes("api/openapi.json")
+	if errDocument != nil {
+		return errors.WithStack(errDocument)
+	}
+
+	w.Header().Set(HTMLHeaderContentType, APIContentTypeValue)
+	return writeBytes(w, document)
+}
+
+//
+// notifications
+//
+
+func apiNotificationListHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	department := query.Get("department")
+	modality := query.Get("modality")
+
+	if department != "" && !isDepartment(department) {
+		writeAPIError(w, http.StatusBadRequest, "unknown department "+department)
+		return nil
+	}
+
+	status := query.Get("status")
+	if status == "" {
+		status = apiStatusOpen
+	}
+
+	if status == apiStatusOpen {
+		notifications, errOpenNotifications := apiOpenNotifications(store, department, modality)
+		if errOpenNotifications != nil {
+			return errOpenNotifications
+		}
+		return writeAPIJSON(w, http.StatusOK, apiNotificationList{Notifications: notifications, Total: len(notifications)})
+	}
+
+	historyQuery := lmdatabase.NotificationHistoryQuery{
+		Modality:   modality,
+		Department: department,
+	}
+
+	switch status {
+	case apiStatusConfirmed, apiStatusCancelled:
+		historyQuery.Outcome = status
+	case apiStatusProcessed:
+	default:
+		writeAPIError(w, http.StatusBadRequest, "unknown status "+status)
+		return nil
+	}
+
+	if query.Get("from") != "" || query.Get("to") != "" {
+		from, to, validPeriod := periodFromRequest(r, time.Now(), 30)
+		if !validPeriod {
+			writeAPIError(w, http.StatusBadRequest, "from and to must be dates like 2020-01-31 and form a period")
+			return nil
+		}
+		historyQuery.From = from.Unix()
+		historyQuery.To = to.Unix()
+	}
+
+	limit, validLimit := apiIntFromQuery(r, "limit", apiDefaultLimit)
+	offset, validOffset := apiIntFromQuery(r, "offset", 0)
+	if !validLimit || !validOffset || limit < 1 || limit > apiMaxLimit || offset < 0 {
+		writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(apiMaxLimit)+" and offset must not be negative")
+		return nil
+	}
+	historyQuery.Limit = limit
+	historyQuery.Offset = offset
+
+	notifications, total, errNotificationGetHistory := store.NotificationGetHistory(historyQuery)
+	if errNotificationGetHistory != nil {
+		return errNotificationGetHistory
+	}
+
+	return writeAPIJSON(w, http.StatusOK, apiNotificationList{Notifications: apiNotificationsFrom(*notifications), Total: total})
+}
+
+// apiOpenNotifications returns the open notifications of the department, or of all departments if it is empty, and
+// of the modality, or of all modalities if it is empty
+func apiOpenNotifications(store lmdatabase.Store, department string, modality string) ([]apiNotification, error) {
+	selected := departments
+	if department != "" {
+		selected = []string{department}
+	}
+
+	result := make([]apiNotification, 0)
+	for _, selectedDepartment := range selected {
+		notifications, errNotificationGetByDepartment := store.NotificationGetOpenNotificationsByDepartment(selectedDepartment)
+		if errNotificationGetByDepartment != nil {
+			return nil, errNotificationGetByDepartment
+		}
+		for _, notification := range *notifications {
+			// open notifications are read without their processing times
+			notification.ConfirmedAt = -1
+			notification.CancelledAt = -1
+			if modality == "" || notification.Modality == modality {
+				result = append(result, apiNotificationFrom(notification))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func apiNotificationCreateHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	var body apiNotificationCreate
+	if !readAPIJSON(w, r, &body) {
+		return nil
+	}
+
+	details := lmdatabase.NotificationDetails{
+		Message:         strings.TrimSpace(body.Message),
+		Room:            strings.TrimSpace(body.Room),
+		AccessionNumber: strings.TrimSpace(body.AccessionNumber),
+	}
+
+	switch {
+	case !isDepartment(body.Department):
+		writeAPIError(w, http.StatusBadRequest, "unknown department "+body.Department)
+		return nil
+	case !isModality(body.Modality):
+		writeAPIError(w, http.StatusBadRequest, "unknown modality "+body.Modality)
+		return nil
+	case priorityNameMap[body.Priority] == "":
+		writeAPIError(w, http.StatusBadRequest, "the priority must be 1 (high), 2 (medium) or 3 (low)")
+		return nil
+	case !validNotificationDetails(details):
+		writeAPIError(w, http.StatusBadRequest, "message, room or accessionNumber is too long")
+		return nil
+	case !mayCreateAndCancel(r, body.Modality):
+		writeAPIError(w, http.StatusForbidden, "the role of the user does not permit notifications of the modality "+body.Modality)
+		return nil
+	}
+
+	event, errNotificationCreateOrEscalate := store.NotificationCreateOrEscalate(body.Department, body.Priority, body.Modality, details, time.Now().Unix(), clientAddress(r))
+	if errNotificationCreateOrEscalate != nil {
+		return errNotificationCreateOrEscalate
+	}
+
+	notification, errNotificationGetByID := store.NotificationGetByID(event.NotificationID)
+	if errNotificationGetByID != nil {
+		return errNotificationGetByID
+	}
+
+	// an open notification of the department and modality has its priority changed instead
+	status := http.StatusOK
+	if event.EventType == lmdatabase.NotificationEventCreated {
+		status = http.StatusCreated
+		w.Header().Set("location", APIPrefix+"/notifications/"+notification.NotificationID)
+	}
+
+	return writeAPIJSON(w, status, apiNotificationFrom(*notification))
+}
+
+func apiNotificationGetHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	notification, errNotification := notificationByID(store, mux.Vars(r)["id"])
+	if errNotification != nil {
+		return writeAPINotificationError(w, errNotification)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, apiNotificationFrom(*notification))
+}
+
+func apiNotificationUpdateHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	var body apiNotificationUpdate
+	if !readAPIJSON(w, r, &body) {
+		return nil
+	}
+
+	if priorityNameMap[body.Priority] == "" {
+		writeAPIError(w, http.StatusBadRequest, "the priority must be 1 (high), 2 (medium) or 3 (low)")
+		return nil
+	}
+
+	notification, errNotification := changeNotificationPriority(store, mux.Vars(r)["id"], body.Priority, time.Now().Unix(), r)
+	if errNotification != nil {
+		return writeAPINotificationError(w, errNotification)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, apiNotificationFrom(*notification))
+}
+
+func apiNotificationCancelHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	notification, errNotification := cancelOpenNotification(store, mux.Vars(r)["id"], time.Now().Unix(), r)
+	if errNotification != nil {
+		return writeAPINotificationError(w, errNotification)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, apiNotificationFrom(*notification))
+}
+
+func apiNotificationConfirmHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	notification, errNotification := confirmOpenNotification(store, mux.Vars(r)["id"], time.Now().Unix(), r)
+	if errNotification != nil {
+		return writeAPINotificationError(w, errNotification)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, apiNotificationFrom(*notification))
+}
+
+// notificationErrorStatus returns the http status of the expected errors of the operations on notifications, 0 for
+// others
+func notificationErrorStatus(err error) int {
+	switch errors.Cause(err) {
+	case errNotificationUnknown:
+		return http.StatusNotFound
+	case lmdatabase.ErrNotificationNotOpen:
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// writeAPINotificationError writes the error response for the expected errors of the operations on notifications and
+// returns the others
+func writeAPINotificationError(w http.ResponseWriter, err error) error {
+	status := notificationErrorStatus(err)
+	if status == 0 {
+		return err
+	}
+
+	writeAPIError(w, status, err.Error())
+	return nil
+}
+
+func apiNotificationStatus(notification lmdatabase.Notification) string {
+	switch {
+	case notification.ConfirmedAt != -1:
+		return apiStatusConfirmed
+	case notification.CancelledAt != -1:
+		return apiStatusCancelled
+	}
+	return apiStatusOpen
+}
+
+func apiNotificationFrom(notification lmdatabase.Notification) apiNotification {
+	return apiNotification{
+		ID:              notification.NotificationID,
+		Department:      notification.DepartmentID,
+		Modality:        notification.Modality,
+		Priority:        notification.Priority,
+		Status:          apiNotificationStatus(notification),
+		CreatedAt:       time.Unix(notification.CreatedAt, 0).UTC(),
+		ConfirmedAt:     apiTime(notification.ConfirmedAt),
+		ConfirmedBy:     notification.ConfirmedBy,
+		CancelledAt:     apiTime(notification.CancelledAt),
+		CancelledBy:     notification.CancelledBy,
+		Message:         notification.Message,
+		Room:            notification.Room,
+		AccessionNumber: notification.AccessionNumber,
+	}
+}
+
+func apiNotificationsFrom(notifications []lmdatabase.Notification) []apiNotification {
+	result := make([]apiNotification, 0, len(notifications))
+	for _, notification := range notifications {
+		result = append(result, apiNotificationFrom(notification))
+	}
+	return result
+}
+
+// apiTime returns the time of the unix timestamp, nil for -1 which marks unset times
+func apiTime(at int64) *time.Time {
+	if at == -1 {
+		return nil
+	}
+	t := time.Unix(at, 0).UTC()
+	return &t
+}
+
+//
+// departments, modalities and devices
+//
+
+func apiDepartmentListHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	now := time.Now().Unix()
+
+	result := make([]apiDepartment, 0, len(departments))
+	for _, department := range departments {
+		resource, errAPIDepartment := apiDepartmentFrom(store, department, now)
+		if errAPIDepartment != nil {
+			return errAPIDepartment
+		}
+		result = append(result, resource)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, result)
+}
+
+func apiDepartmentGetHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	department := mux.Vars(r)["id"]
+
+	if !isDepartment(department) {
+		writeAPIError(w, http.StatusNotFound, "unknown department "+department)
+		return nil
+	}
+
+	resource, errAPIDepartment := apiDepartmentFrom(store, department, time.Now().Unix())
+	if errAPIDepartment != nil {
+		return errAPIDepartment
+	}
+
+	return writeAPIJSON(w, http.StatusOK, resource)
+}
+
+func apiModalityListHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	result := make([]apiModality, 0, len(modalities))
+	for _, modality := range modalities {
+		result = append(result, apiModality{ID: modality})
+	}
+
+	return writeAPIJSON(w, http.StatusOK, result)
+}
+
+func apiDeviceListHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	selected := departments
+	if department := r.URL.Query().Get("department"); department != "" {
+		if !isDepartment(department) {
+			writeAPIError(w, http.StatusBadRequest, "unknown department "+department)
+			return nil
+		}
+		selected = []string{department}
+	}
+
+	now := time.Now().Unix()
+
+	result := make([]apiDevice, 0)
+	for _, department := range selected {
+		devices, errAPIDevices := apiDevicesFrom(store, department, now)
+		if errAPIDevices != nil {
+			return errAPIDevices
+		}
+		result = append(result, devices...)
+	}
+
+	return writeAPIJSON(w, http.StatusOK, result)
+}
+
+// apiDepartmentFrom returns the department with its devices, lights that only report the legacy arduino status
+// count as connected as well
+func apiDepartmentFrom(store lmdatabase.Store, department string, now int64) (apiDepartment, error) {
+	devices, errAPIDevices := apiDevicesFrom(store, department, now)
+	if errAPIDevices != nil {
+		return apiDepartment{}, errAPIDevices
+	}
+
+	arduinoStatus, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(department, now)
+	if errStatusQuery != nil {
+		return apiDepartment{}, errStatusQuery
+	}
+
+	connected := arduinoStatus != nil
+	for _, device := range devices {
+		connected = connected || (device.Connected && !device.Unauthenticated)
+	}
+
+	return apiDepartment{ID: department, Connected: connected, Devices: devices}, nil
+}
+
+func apiDevicesFrom(store lmdatabase.Store, department string, now int64) ([]apiDevice, error) {
+	devices, errDeviceGetByDepartment := store.DeviceGetByDepartment(department)
+	if errDeviceGetByDepartment != nil {
+		return nil, errDeviceGetByDepartment
+	}
+
+	result := make([]apiDevice, 0, len(*devices))
+	for _, device := range *devices {
+		result = append(result, apiDevice{
+			ID:              device.DeviceID,
+			Department:      device.DepartmentID,
+			Location:        device.Location,
+			FirmwareVersion: device.FirmwareVersion,
+			LastSeenAt:      time.Unix(device.LastSeenAt, 0).UTC(),
+			RemoteAddress:   device.RemoteAddress,
+			Connected:       device.SeenWithin5MinutesFrom(now),
+			Unauthenticated: device.Unauthenticated,
+		})
+	}
+
+	return result, nil
+}
+
+//
+// requests and responses
+//
+
+// acceptsJSON reports whether the accept header of the request allows a json response, without the header any
+// response is accepted. The most specific media range that matches decides, e.g. "application/json;q=0, */*" does not.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("accept")
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	specificity := -1
+	quality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, errParse := mime.ParseMediaType(mediaRange)
+		if errParse != nil {
+			continue
+		}
+
+		rangeSpecificity := -1
+		switch mediaType {
+		case apiMediaType:
+			rangeSpecificity = 2
+		case "application/*":
+			rangeSpecificity = 1
+		case "*/*":
+			rangeSpecificity = 0
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		rangeQuality := 1.0
+		if value, ok := params["q"]; ok {
+			parsed, errParseFloat := strconv.ParseFloat(value, 64)
+			if errParseFloat != nil {
+				continue
+			}
+			rangeQuality = parsed
+		}
+
+		specificity = rangeSpecificity
+		quality = rangeQuality
+	}
+
+	return quality > 0
+}
+
+// readAPIJSON decodes the json request body into v, if that fails it writes the error response and returns false
+func readAPIJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if !sendsJSON(r) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "the request body must be "+apiMediaType)
+		return false
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if errDecode := decoder.Decode(v); errDecode != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: "+errDecode.Error())
+		return false
+	}
+
+	return true
+}
+
+// sendsJSON reports whether the content type of the request is json, also for requests without body
+func sendsJSON(r *http.Request) bool {
+	mediaType, _, errParse := mime.ParseMediaType(r.Header.Get(HTMLHeaderContentType))
+	return errParse == nil && mediaType == apiMediaType
+}
+
+// apiIntFromQuery returns the integer query parameter or the default if it is missing, it reports false if it is no
+// integer
+func apiIntFromQuery(r *http.Request, key string, defaultValue int) (int, bool) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue, true
+	}
+	number, errConversion := strconv.Atoi(value)
+	return number, errConversion == nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, data interface{}) error {
+	body, errJSONMarshal := json.Marshal(data)
+	if errJSONMarshal != nil {
+		return errors.WithStack(errJSONMarshal)
+	}
+
+	w.Header().Set(HTMLHeaderContentType, APIContentTypeValue)
+	w.WriteHeader(status)
+
+	return writeBytes(w, body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	errWrite := writeAPIJSON(w, status, apiError{Error: apiErrorDetails{Status: status, Message: message}})
+	if errWrite != nil {
+		log.Printf("%+v", errWrite)
+	}
+}
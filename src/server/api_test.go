@@ -0,0 +1,470 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func getAPIResponse(t *testing.T, method string, url string, body string, v interface{}) *http.Response {
+	request, _ := http.NewRequest(method, url, strings.NewReader(body))
+	request.Header.Set("accept", apiMediaType)
+	if method != http.MethodGet {
+		request.Header.Set(HTMLHeaderContentType, APIContentTypeValue)
+	}
+
+	response := getResponse(t, request)
+	defer response.Body.Close()
+
+	assert.Equal(t, APIContentTypeValue, response.Header.Get(HTMLHeaderContentType))
+
+	errJSONDecode := json.NewDecoder(response.Body).Decode(v)
+	if errJSONDecode != nil {
+		t.Fatalf("%+v", errors.WithStack(errJSONDecode))
+	}
+
+	return response
+}
+
+func TestUnitAcceptsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                                  true,
+		"application/json":                  true,
+		"text/html, */*; q=0.01":            true,
+		"application/*":                     true,
+		"text/html":                         false,
+		"application/json;q=0, */*":         false,
+		"text/html, application/json;q=0.5": true,
+	}
+
+	for accept, expected := range tests {
+		// given
+		request, _ := http.NewRequest("GET", "/api/v1/modalities", nil)
+		request.Header.Set("accept", accept)
+
+		// when
+		accepted := acceptsJSON(request)
+
+		// then
+		assert.Equal(t, expected, accepted, accept)
+	}
+}
+
+func TestIntegrationAPIShouldCreateEscalateConfirmAndGetNotification(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	var created apiNotification
+	createResponse := getAPIResponse(t, "POST", server.URL+"/api/v1/notifications",
+		`{"department": "msk", "modality": "ct", "priority": 3, "room": "CT 2"}`, &created)
+
+	var escalated apiNotification
+	escalateResponse := getAPIResponse(t, "POST", server.URL+"/api/v1/notifications",
+		`{"department": "msk", "modality": "ct", "priority": 1}`, &escalated)
+
+	var confirmed apiNotification
+	confirmResponse := getAPIResponse(t, "POST", server.URL+"/api/v1/notifications/"+created.ID+"/confirm", "", &confirmed)
+
+	var fetched apiNotification
+	getAPIResponse(t, "GET", server.URL+"/api/v1/notifications/"+created.ID, "", &fetched)
+
+	// then
+	assert.Equal(t, http.StatusCreated, createResponse.StatusCode)
+	assert.Equal(t, "/api/v1/notifications/"+created.ID, createResponse.Header.Get("location"))
+	assert.Equal(t, apiStatusOpen, created.Status)
+	assert.Equal(t, 3, created.Priority)
+	assert.Nil(t, created.ConfirmedAt)
+
+	assert.Equal(t, http.StatusOK, escalateResponse.StatusCode)
+	assert.Equal(t, created.ID, escalated.ID)
+	assert.Equal(t, 1, escalated.Priority)
+	assert.Equal(t, "CT 2", escalated.Room)
+
+	assert.Equal(t, http.StatusOK, confirmResponse.StatusCode)
+	assert.Equal(t, apiStatusConfirmed, confirmed.Status)
+	assert.NotNil(t, confirmed.ConfirmedAt)
+	assert.Equal(t, confirmed, fetched)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(created.ID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, 3, len(*events))
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldChangePriorityAndCancelNotification(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var created apiNotification
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "nr", "modality": "mr", "priority": 2}`, &created)
+
+	// when
+	var updated apiNotification
+	updateResponse := getAPIResponse(t, "PATCH", server.URL+"/api/v1/notifications/"+created.ID, `{"priority": 1}`, &updated)
+
+	var cancelled apiNotification
+	cancelResponse := getAPIResponse(t, "DELETE", server.URL+"/api/v1/notifications/"+created.ID, "", &cancelled)
+
+	var cancelledAgain apiError
+	cancelAgainResponse := getAPIResponse(t, "DELETE", server.URL+"/api/v1/notifications/"+created.ID, "", &cancelledAgain)
+
+	// then
+	assert.Equal(t, http.StatusOK, updateResponse.StatusCode)
+	assert.Equal(t, 1, updated.Priority)
+
+	assert.Equal(t, http.StatusOK, cancelResponse.StatusCode)
+	assert.Equal(t, apiStatusCancelled, cancelled.Status)
+	assert.Equal(t, 1, cancelled.Priority)
+	assert.NotNil(t, cancelled.CancelledAt)
+
+	assert.Equal(t, http.StatusConflict, cancelAgainResponse.StatusCode)
+	assert.Equal(t, http.StatusConflict, cancelledAgain.Error.Status)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(created.ID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, lmdatabase.NotificationEventPriority, (*events)[1].EventType)
+	assert.Equal(t, "2", (*events)[1].PreviousValue)
+	assert.Equal(t, lmdatabase.NotificationEventCancelled, (*events)[2].EventType)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldNotChangePriorityAfterConcurrentConfirmation(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	const concurrency = 20
+
+	notificationID, errInsert := store.NotificationInsert("nr", 3, "mr", 1000)
+	if errInsert != nil {
+		t.Fatalf("%+v", errors.WithStack(errInsert))
+	}
+
+	request := func(method string, path string, body string) int {
+		request, _ := http.NewRequest(method, server.URL+APIPrefix+"/notifications/"+notificationID+path, strings.NewReader(body))
+		request.Header.Set("accept", apiMediaType)
+		request.Header.Set(HTMLHeaderContentType, APIContentTypeValue)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return -1
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	var wg sync.WaitGroup
+	statusCodes := make(chan int, concurrency)
+	confirmStatusCode := make(chan int, 1)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(priority int) {
+			defer wg.Done()
+			statusCodes <- request("PATCH", "", `{"priority": `+strconv.Itoa(priority)+`}`)
+		}(i%3 + 1)
+
+		if i == concurrency/2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				confirmStatusCode <- request("POST", "/confirm", "")
+			}()
+		}
+	}
+	wg.Wait()
+	close(statusCodes)
+
+	// then
+	assert.Equal(t, http.StatusOK, <-confirmStatusCode)
+	for statusCode := range statusCodes {
+		assert.Contains(t, []int{http.StatusOK, http.StatusConflict}, statusCode)
+	}
+
+	notification := getNotificationByID(t, store, notificationID)
+	assert.NotEqual(t, int64(-1), notification.ConfirmedAt)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+
+	lastEvent := (*events)[len(*events)-1]
+	assert.Equal(t, lmdatabase.NotificationEventConfirmed, lastEvent.EventType)
+
+	priority := "3"
+	for _, event := range *events {
+		if event.EventType == lmdatabase.NotificationEventPriority {
+			assert.Equal(t, priority, event.PreviousValue)
+			priority = event.NewValue
+		}
+	}
+	assert.Equal(t, priority, strconv.Itoa(notification.Priority))
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldListOpenAndProcessedNotifications(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationInsert(t, store, "msk", 1, "ct", dayStart)
+	testNotificationInsert(t, store, "nr", 2, "mr", dayStart)
+	testNotificationConfirmAfter(t, store, "aod", 3, "ct", dayStart, 30)
+	testNotificationConfirmAfter(t, store, "aod", 3, "ct", dayStart+60, 30)
+
+	// when
+	var open apiNotificationList
+	getAPIResponse(t, "GET", server.URL+"/api/v1/notifications?modality=ct", "", &open)
+
+	var confirmed apiNotificationList
+	getAPIResponse(t, "GET", server.URL+"/api/v1/notifications?status=confirmed&from=2020-01-01&to=2020-01-01&limit=1", "", &confirmed)
+
+	// then
+	assert.Equal(t, 1, open.Total)
+	assert.Equal(t, "msk", open.Notifications[0].Department)
+	assert.Equal(t, apiStatusOpen, open.Notifications[0].Status)
+	assert.Nil(t, open.Notifications[0].ConfirmedAt)
+
+	assert.Equal(t, 2, confirmed.Total)
+	assert.Equal(t, 1, len(confirmed.Notifications))
+	assert.Equal(t, time.Unix(dayStart+60, 0).UTC(), confirmed.Notifications[0].CreatedAt)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldReturnDepartmentsWithDevicesAndModalities(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "msk-1", DepartmentID: "msk", LastSeenAt: time.Now().Unix()})
+
+	// when
+	var departmentList []apiDepartment
+	getAPIResponse(t, "GET", server.URL+"/api/v1/departments", "", &departmentList)
+
+	var department apiDepartment
+	getAPIResponse(t, "GET", server.URL+"/api/v1/departments/msk", "", &department)
+
+	var modalityList []apiModality
+	getAPIResponse(t, "GET", server.URL+"/api/v1/modalities", "", &modalityList)
+
+	// then
+	assert.Equal(t, len(departments), len(departmentList))
+	assert.True(t, department.Connected)
+	assert.Equal(t, "msk-1", department.Devices[0].ID)
+	assert.Equal(t, []apiModality{{ID: "ct"}, {ID: "mr"}, {ID: "nuk"}}, modalityList)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldReturnJSONErrors(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/api/v1/notifications/unknown", "", http.StatusNotFound},
+		{"GET", "/api/v1/unknown", "", http.StatusNotFound},
+		{"PUT", "/api/v1/notifications", "", http.StatusMethodNotAllowed},
+		{"POST", "/api/v1/notifications", `{"department": "msk", "modality": "ct", "priority": 4}`, http.StatusBadRequest},
+		{"POST", "/api/v1/notifications", `{"department": "xyz", "modality": "ct", "priority": 1}`, http.StatusBadRequest},
+		{"POST", "/api/v1/notifications", `{"department": "msk"`, http.StatusBadRequest},
+		{"GET", "/api/v1/notifications?status=unknown", "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		// when
+		var body apiError
+		response := getAPIResponse(t, test.method, server.URL+test.path, test.body, &body)
+
+		// then
+		assert.Equal(t, test.status, response.StatusCode, test.method+" "+test.path)
+		assert.Equal(t, test.status, body.Error.Status, test.method+" "+test.path)
+		assert.NotEmpty(t, body.Error.Message)
+	}
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldReturnHTTP406WithoutJSONInAccept(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/api/v1/modalities", nil)
+	request.Header.Set("accept", "text/html")
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldReturnHTTP415WithoutJSONBody(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("POST", server.URL+"/api/v1/notifications", strings.NewReader("department=msk"))
+	request.Header.Set(HTMLHeaderContentType, "application/x-www-form-urlencoded")
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAPIShouldReturnHTTP415ForChangesWithoutJSONContentType(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	notificationID, errInsert := store.NotificationInsert("msk", 1, "ct", 1000)
+	if errInsert != nil {
+		t.Fatalf("%+v", errors.WithStack(errInsert))
+	}
+
+	status := func(method string, path string, contentType string) int {
+		request, _ := http.NewRequest(method, server.URL+APIPrefix+"/notifications/"+notificationID+path, nil)
+		if contentType != "" {
+			request.Header.Set(HTMLHeaderContentType, contentType)
+		}
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	confirmedByForm := status("POST", "/confirm", "application/x-www-form-urlencoded")
+	confirmedByTextForm := status("POST", "/confirm", "text/plain")
+	confirmedWithoutContentType := status("POST", "/confirm", "")
+	cancelledWithoutContentType := status("DELETE", "", "")
+	read := status("GET", "", "")
+
+	// then
+	assert.Equal(t, http.StatusUnsupportedMediaType, confirmedByForm)
+	assert.Equal(t, http.StatusUnsupportedMediaType, confirmedByTextForm)
+	assert.Equal(t, http.StatusUnsupportedMediaType, confirmedWithoutContentType)
+	assert.Equal(t, http.StatusUnsupportedMediaType, cancelledWithoutContentType)
+	assert.Equal(t, http.StatusOK, read)
+
+	notification := getNotificationByID(t, store, notificationID)
+	assert.Equal(t, int64(-1), notification.ConfirmedAt)
+	assert.Equal(t, int64(-1), notification.CancelledAt)
+
+	tearDownTest(t, server, store)
+}
+
+func TestUnitOpenAPIShouldDescribeEveryRoute(t *testing.T) {
+
+	// given
+	document, errDocument := box.Bytes("api/openapi.json")
+	if errDocument != nil {
+		t.Fatalf("%+v", errors.WithStack(errDocument))
+	}
+
+	var openAPI struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	errJSONDecode := json.Unmarshal(document, &openAPI)
+	if errJSONDecode != nil {
+		t.Fatalf("%+v", errors.WithStack(errJSONDecode))
+	}
+
+	router := getRouter(&configuration.Configuration{}, lmdatabase.NewMemoryStore())
+
+	// when
+	routes := make(map[string]bool)
+	errWalk := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pathTemplate, errPathTemplate := route.GetPathTemplate()
+		if errPathTemplate != nil {
+			return errors.WithStack(errPathTemplate)
+		}
+
+		// prefixes, i.e. the static files and the api subrouter, are no operations
+		pathRegexp, errPathRegexp := route.GetPathRegexp()
+		if errPathRegexp != nil {
+			return errors.WithStack(errPathRegexp)
+		}
+		if !strings.HasSuffix(pathRegexp, "$") {
+			return nil
+		}
+
+		routes[pathTemplate] = true
+
+		operations, described := openAPI.Paths[pathTemplate]
+		if !assert.True(t, described, "route %s is not described", pathTemplate) {
+			return nil
+		}
+
+		methods, errMethods := route.GetMethods()
+		if errMethods != nil {
+			// the route serves every method
+			assert.NotEmpty(t, operations, "route %s has no operation", pathTemplate)
+			return nil
+		}
+		for _, method := range methods {
+			_, operationDescribed := operations[strings.ToLower(method)]
+			assert.True(t, operationDescribed, "operation %s %s is not described", method, pathTemplate)
+		}
+		return nil
+	})
+	if errWalk != nil {
+		t.Fatalf("%+v", errWalk)
+	}
+
+	// then
+	assert.Equal(t, "3.0.3", openAPI.OpenAPI)
+	for path := range openAPI.Paths {
+		assert.True(t, routes[path], "path %s is described but not registered", path)
+	}
+}
+
+func TestIntegrationOpenAPIShouldBeServed(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	var openAPI map[string]interface{}
+	response := getAPIResponse(t, "GET", server.URL+"/api/openapi.json", "", &openAPI)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "3.0.3", openAPI["openapi"])
+
+	tearDownTest(t, server, store)
+}
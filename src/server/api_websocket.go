@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/eventbus"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// the websocket protocol, clients send commands and receive their results or errors and the events of the
+// notifications they subscribed to
+const (
+	wsCommandSubscribe = "subscribe"
+	wsCommandConfirm   = "confirm"
+	wsCommandCancel    = "cancel"
+
+	wsMessageEvent  = "event"
+	wsMessageResult = "result"
+	wsMessageError  = "error"
+
+	wsMaxCommandSize = 4096
+	wsPingInterval   = 30 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsWriteTimeout   = 10 * time.Second
+)
+
+// wsCommand is a message from the client, the id is returned with the result of the command
+type wsCommand struct {
+	Type           string   `json:"type"`
+	ID             string   `json:"id"`
+	Departments    []string `json:"departments"`
+	Modalities     []string `json:"modalities"`
+	NotificationID string   `json:"notificationId"`
+}
+
+// wsMessage is a message to the client, the event of a notification, the result of a command or its error
+type wsMessage struct {
+	Type          string             `json:"type"`
+	ID            string             `json:"id,omitempty"`
+	Event         string             `json:"event,omitempty"`
+	Notification  *apiNotification   `json:"notification,omitempty"`
+	Notifications *[]apiNotification `json:"notifications,omitempty"`
+	Error         *apiErrorDetails   `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsSession is a websocket connection with the departments and modalities the client subscribed to
+type wsSession struct {
+	store       lmdatabase.Store
+	connection  *websocket.Conn
+	request     *http.Request
+	departments map[string]bool
+	modalities  map[string]bool
+}
+
+func apiWebSocketHandler(bus *eventbus.Bus) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		connection, errUpgrade := wsUpgrader.Upgrade(w, r, nil)
+		if errUpgrade != nil {
+			return nil // the upgrader responded with the error already
+		}
+		defer connection.Close()
+
+		subscription := bus.Subscribe()
+		defer bus.Unsubscribe(subscription)
+
+		done := make(chan struct{})
+		defer close(done)
+		commands := wsReadCommands(connection, done)
+
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+
+		session := &wsSession{
+			store:       store,
+			connection:  connection,
+			request:     r,
+			departments: make(map[string]bool),
+			modalities:  make(map[string]bool),
+		}
+
+		for {
+			var errWrite error
+
+			select {
+			case command, connected := <-commands:
+				if !connected {
+					return nil
+				}
+				errWrite = session.execute(command)
+
+			case event, subscribed := <-subscription:
+				if !subscribed {
+					return nil // the client fell behind, it reconnects and subscribes again
+				}
+				if session.concerns(event.Department, event.PreviousDepartment, event.Modality) {
+					errWrite = session.sendEvent(event)
+				}
+
+			case <-ticker.C:
+				errWrite = connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			}
+
+			// the connection is gone, there is nobody to report to
+			if errWrite != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// wsReadCommands reads the commands of the client until the connection is closed or done, commands that are no valid
+// json are passed on without type
+func wsReadCommands(connection *websocket.Conn, done chan struct{}) chan wsCommand {
+	commands := make(chan wsCommand)
+
+	connection.SetReadLimit(wsMaxCommandSize)
+	connection.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	connection.SetPongHandler(func(string) error {
+		return connection.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	go func() {
+		defer close(commands)
+
+		for {
+			_, message, errRead := connection.ReadMessage()
+			if errRead != nil {
+				return
+			}
+
+			var command wsCommand
+			if errJSONUnmarshal := json.Unmarshal(message, &command); errJSONUnmarshal != nil {
+				command = wsCommand{}
+			}
+
+			select {
+			case commands <- command:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return commands
+}
+
+// execute executes the command and sends its result or error, it returns errors of the connection only
+func (session *wsSession) execute(command wsCommand) error {
+	var result wsMessage
+	var errCommand error
+
+	switch command.Type {
+	case wsCommandSubscribe:
+		if message := wsInvalidSubscription(command); message != "" {
+			return session.sendError(command.ID, http.StatusBadRequest, message)
+		}
+		result, errCommand = session.subscribe(command)
+
+	case wsCommandConfirm, wsCommandCancel:
+		permitted, errPermitted := session.permits(command)
+		if errPermitted != nil {
+			errCommand = errPermitted
+			break
+		}
+		if !permitted {
+			return session.sendError(command.ID, http.StatusForbidden, "the role of the user does not permit to "+command.Type+" the notification")
+		}
+
+		operation := confirmOpenNotification
+		if command.Type == wsCommandCancel {
+			operation = cancelOpenNotification
+		}
+
+		notification, errOperation := operation(session.store, command.NotificationID, time.Now().Unix(), session.request)
+		if errOperation != nil {
+			errCommand = errOperation
+			break
+		}
+
+		resource := apiNotificationFrom(*notification)
+		result = wsMessage{Notification: &resource}
+
+	default:
+		return session.sendError(command.ID, http.StatusBadRequest, "unknown command, send subscribe, confirm or cancel")
+	}
+
+	if errCommand != nil {
+		status := notificationErrorStatus(errCommand)
+		if status == 0 {
+			log.Printf("%+v", errCommand)
+			return session.sendError(command.ID, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return session.sendError(command.ID, status, errCommand.Error())
+	}
+
+	result.Type = wsMessageResult
+	result.ID = command.ID
+	return session.send(result)
+}
+
+// permits reports whether the user may confirm or cancel the notification of the command, unknown notifications are
+// left to the operation
+func (session *wsSession) permits(command wsCommand) (bool, error) {
+	notification, errNotification := session.store.NotificationGetByID(command.NotificationID)
+	if errNotification != nil || notification == nil {
+		return true, errNotification
+	}
+
+	if command.Type == wsCommandConfirm {
+		return mayConfirm(session.request, notification.DepartmentID), nil
+	}
+	return mayCreateAndCancel(session.request, notification.Modality), nil
+}
+
+// wsInvalidSubscription returns why the departments or modalities to subscribe to are invalid, empty if they are valid
+func wsInvalidSubscription(command wsCommand) string {
+	for _, department := range command.Departments {
+		if !isDepartment(department) {
+			return "unknown department " + department
+		}
+	}
+	for _, modality := range command.Modalities {
+		if !isModality(modality) {
+			return "unknown modality " + modality
+		}
+	}
+	return ""
+}
+
+// subscribe replaces the subscribed departments and modalities, the result holds their open notifications
+func (session *wsSession) subscribe(command wsCommand) (wsMessage, error) {
+	departments := make(map[string]bool)
+	for _, department := range command.Departments {
+		departments[department] = true
+	}
+
+	modalities := make(map[string]bool)
+	for _, modality := range command.Modalities {
+		modalities[modality] = true
+	}
+
+	session.departments = departments
+	session.modalities = modalities
+
+	notifications, errOpenNotifications := apiOpenNotifications(session.store, "", "")
+	if errOpenNotifications != nil {
+		return wsMessage{}, errOpenNotifications
+	}
+
+	subscribed := make([]apiNotification, 0)
+	for _, notification := range notifications {
+		if session.concerns(notification.Department, "", notification.Modality) {
+			subscribed = append(subscribed, notification)
+		}
+	}
+
+	return wsMessage{Notifications: &subscribed}, nil
+}
+
+// concerns reports whether a notification of the departments and modality is subscribed to
+func (session *wsSession) concerns(department string, previousDepartment string, modality string) bool {
+	return session.departments[department] || session.departments[previousDepartment] || session.modalities[modality]
+}
+
+func (session *wsSession) sendEvent(event eventbus.Event) error {
+	notification, errNotification := notificationByID(session.store, event.NotificationID)
+	if errNotification != nil {
+		if notificationErrorStatus(errNotification) == 0 {
+			log.Printf("%+v", errNotification)
+		}
+		return nil
+	}
+
+	resource := apiNotificationFrom(*notification)
+	return session.send(wsMessage{Type: wsMessageEvent, Event: event.Type, Notification: &resource})
+}
+
+func (session *wsSession) sendError(id string, status int, message string) error {
+	return session.send(wsMessage{Type: wsMessageError, ID: id, Error: &apiErrorDetails{Status: status, Message: message}})
+}
+
+func (session *wsSession) send(message wsMessage) error {
+	errDeadline := session.connection.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if errDeadline != nil {
+		return errDeadline
+	}
+	return session.connection.WriteJSON(message)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// openWebSocket connects to the websocket of the api, reads fail after 10 seconds
+func openWebSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	connection, response, errDial := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+APIPrefix+"/websocket", nil)
+	if errDial != nil {
+		t.Fatalf("%+v", errors.WithStack(errDial))
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+
+	connection.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return connection
+}
+
+// sendWebSocketCommand sends the command and reads the next message
+func sendWebSocketCommand(t *testing.T, connection *websocket.Conn, command string) wsMessage {
+	if errWrite := connection.WriteMessage(websocket.TextMessage, []byte(command)); errWrite != nil {
+		t.Fatalf("%+v", errors.WithStack(errWrite))
+	}
+	return readWebSocketMessage(t, connection)
+}
+
+func readWebSocketMessage(t *testing.T, connection *websocket.Conn) wsMessage {
+	var message wsMessage
+	if errRead := connection.ReadJSON(&message); errRead != nil {
+		t.Fatalf("%+v", errors.WithStack(errRead))
+	}
+	return message
+}
+
+func TestIntegrationWebSocketShouldPushEventsOfSubscribedDepartmentsAndModalities(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var open apiNotification
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "msk", "modality": "ct", "priority": 2}`, &open)
+
+	connection := openWebSocket(t, server)
+	defer connection.Close()
+
+	// when
+	subscribed := sendWebSocketCommand(t, connection, `{"type": "subscribe", "id": "1", "departments": ["msk"], "modalities": ["mr"]}`)
+
+	var created apiNotification
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "nr", "modality": "ct", "priority": 2}`, &apiNotification{})
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "nr", "modality": "mr", "priority": 1}`, &created)
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications/"+open.ID+"/confirm", "", &apiNotification{})
+
+	// then
+	assert.Equal(t, wsMessageResult, subscribed.Type)
+	assert.Equal(t, "1", subscribed.ID)
+	if assert.NotNil(t, subscribed.Notifications) && assert.Equal(t, 1, len(*subscribed.Notifications)) {
+		assert.Equal(t, open, (*subscribed.Notifications)[0])
+	}
+
+	event := readWebSocketMessage(t, connection)
+	assert.Equal(t, wsMessageEvent, event.Type)
+	assert.Equal(t, "created", event.Event)
+	assert.Equal(t, created, *event.Notification)
+
+	event = readWebSocketMessage(t, connection)
+	assert.Equal(t, "confirmed", event.Event)
+	assert.Equal(t, open.ID, event.Notification.ID)
+	assert.Equal(t, apiStatusConfirmed, event.Notification.Status)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationWebSocketShouldConfirmAndCancelNotifications(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var toConfirm, toCancel apiNotification
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "msk", "modality": "ct", "priority": 1}`, &toConfirm)
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "msk", "modality": "mr", "priority": 3}`, &toCancel)
+
+	connection := openWebSocket(t, server)
+	defer connection.Close()
+
+	// when
+	confirmed := sendWebSocketCommand(t, connection, `{"type": "confirm", "id": "c", "notificationId": "`+toConfirm.ID+`"}`)
+	cancelled := sendWebSocketCommand(t, connection, `{"type": "cancel", "id": "x", "notificationId": "`+toCancel.ID+`"}`)
+
+	// then
+	assert.Equal(t, wsMessageResult, confirmed.Type)
+	assert.Equal(t, "c", confirmed.ID)
+	assert.Equal(t, apiStatusConfirmed, confirmed.Notification.Status)
+
+	assert.Equal(t, wsMessageResult, cancelled.Type)
+	assert.Equal(t, "x", cancelled.ID)
+	assert.Equal(t, apiStatusCancelled, cancelled.Notification.Status)
+
+	notification, errNotification := store.NotificationGetByID(toConfirm.ID)
+	if errNotification != nil {
+		t.Fatalf("%+v", errors.WithStack(errNotification))
+	}
+	assert.NotEqual(t, int64(-1), notification.ConfirmedAt)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationWebSocketShouldReturnErrors(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var confirmed apiNotification
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications", `{"department": "msk", "modality": "ct", "priority": 1}`, &confirmed)
+	getAPIResponse(t, "POST", server.URL+"/api/v1/notifications/"+confirmed.ID+"/confirm", "", &confirmed)
+
+	connection := openWebSocket(t, server)
+	defer connection.Close()
+
+	tests := []struct {
+		command string
+		id      string
+		status  int
+	}{
+		{`no json`, "", http.StatusBadRequest},
+		{`{"type": "escalate", "id": "1"}`, "1", http.StatusBadRequest},
+		{`{"type": "subscribe", "id": "2", "departments": ["unknown"]}`, "2", http.StatusBadRequest},
+		{`{"type": "subscribe", "id": "3", "modalities": ["xray"]}`, "3", http.StatusBadRequest},
+		{`{"type": "confirm", "id": "4", "notificationId": "unknown"}`, "4", http.StatusNotFound},
+		{`{"type": "confirm", "id": "5", "notificationId": "` + confirmed.ID + `"}`, "5", http.StatusConflict},
+		{`{"type": "cancel", "id": "6", "notificationId": "` + confirmed.ID + `"}`, "6", http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		// when
+		message := sendWebSocketCommand(t, connection, test.command)
+
+		// then
+		assert.Equal(t, wsMessageError, message.Type, test.command)
+		assert.Equal(t, test.id, message.ID, test.command)
+		if assert.NotNil(t, message.Error, test.command) {
+			assert.Equal(t, test.status, message.Error.Status, test.command)
+		}
+	}
+
+	tearDownTest(t, server, store)
+}
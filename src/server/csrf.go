@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+)
+
+const (
+	csrfCookieName = "light-messenger-csrf"
+	csrfHeader     = "x-csrf-token"
+	csrfFormField  = "csrf_token"
+)
+
+// csrfProtect rejects requests whose token header does not match the token cookie of the browser; the pages send the
+// token with every action of intercooler, other sites can neither read the cookie nor set the header. Plain forms like
+// the login can't set a header and send the token in the field csrf_token instead
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(csrfHeader)
+		if token == "" {
+			token = r.PostFormValue(csrfFormField)
+		}
+
+		cookie, errCookie := r.Cookie(csrfCookieName)
+		if errCookie != nil || !validCSRFToken(cookie.Value) ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+			http.Error(w, "invalid CSRF token, reload the page", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the token of the browser for the pages to send, a new one is set as cookie; the token is not tied
+// to a session so the pages that stay open keep working across logins and restarts
+func csrfToken(config *configuration.Configuration, w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, errCookie := r.Cookie(csrfCookieName); errCookie == nil && validCSRFToken(cookie.Value) {
+		return cookie.Value, nil
+	}
+
+	random := make([]byte, 32)
+	if _, errRead := rand.Read(random); errRead != nil {
+		return "", errors.WithStack(errRead)
+	}
+	token := hex.EncodeToString(random)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   config.Authentication.SecureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+func validCSRFToken(token string) bool {
+	decoded, errDecode := hex.DecodeString(token)
+	return errDecode == nil && len(decoded) == 32
+}
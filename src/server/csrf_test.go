@@ -0,0 +1,137 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCSRFToken = strings.Repeat("c0", 32)
+
+// newCSRFRequest returns a request that sends the token cookie and header as the pages do
+func newCSRFRequest(method string, url string, body io.Reader) *http.Request {
+	request, _ := http.NewRequest(method, url, body)
+	request.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+	request.Header.Set(csrfHeader, testCSRFToken)
+	return request
+}
+
+func TestUnitCSRFProtectShouldRequireTheTokenOfTheCookie(t *testing.T) {
+
+	// given
+	protected := csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(cookie string, header string) int {
+		r := httptest.NewRequest("POST", "/modality/ct/department/msk/prio/1", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookie})
+		}
+		r.Header.Set(csrfHeader, header)
+
+		recorder := httptest.NewRecorder()
+		protected.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// then
+	assert.Equal(t, http.StatusOK, request(testCSRFToken, testCSRFToken))
+	assert.Equal(t, http.StatusForbidden, request(testCSRFToken, ""))
+	assert.Equal(t, http.StatusForbidden, request(testCSRFToken, strings.Repeat("c1", 32)))
+	assert.Equal(t, http.StatusForbidden, request("", testCSRFToken))
+	assert.Equal(t, http.StatusForbidden, request("", ""))
+	assert.Equal(t, http.StatusForbidden, request("short", "short"))
+}
+
+func TestUnitCSRFProtectShouldAcceptTheTokenOfTheForm(t *testing.T) {
+
+	// given
+	protected := csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(field string) int {
+		r := httptest.NewRequest("POST", "/logout", strings.NewReader(url.Values{csrfFormField: {field}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+
+		recorder := httptest.NewRecorder()
+		protected.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// then
+	assert.Equal(t, http.StatusOK, request(testCSRFToken))
+	assert.Equal(t, http.StatusForbidden, request(strings.Repeat("c1", 32)))
+	assert.Equal(t, http.StatusForbidden, request(""))
+}
+
+func TestIntegrationPagesShouldSetTheCSRFTokenTheyEmbed(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	response, errGet := http.Get(server.URL + "/mtra/ct")
+	if errGet != nil {
+		t.Fatalf("%+v", errors.WithStack(errGet))
+	}
+	defer response.Body.Close()
+
+	doc, errHTMLDoc := goquery.NewDocumentFromResponse(response)
+	if errHTMLDoc != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTMLDoc))
+	}
+
+	reloadedDoc := getResponseHTMLDoc(t, newCSRFRequest("GET", server.URL+"/radiologie/msk", nil))
+
+	// then
+	cookies := response.Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, csrfCookieName, cookies[0].Name)
+		assert.True(t, validCSRFToken(cookies[0].Value))
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, cookies[0].Value, doc.Find("meta[name=csrf-token]").AttrOr("content", ""))
+	}
+	assert.Equal(t, testCSRFToken, reloadedDoc.Find("meta[name=csrf-token]").AttrOr("content", ""))
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationStateChangingRoutesShouldRejectOtherMethodsAndMissingCSRFTokens(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+	created := server.URL + "/modality/ct/department/msk/prio/1"
+
+	status := func(request *http.Request) int {
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	get, _ := http.NewRequest("GET", created, nil)
+	prefetched := status(get)
+
+	withoutToken, _ := http.NewRequest("POST", created, nil)
+	forged := status(withoutToken)
+
+	openNotifications := getOpenNotificationsStatus(t, server.URL, "msk")
+
+	posted := status(newCSRFRequest("POST", created, nil))
+	confirmedWithPost := status(newCSRFRequest("POST", server.URL+"/notification/msk/xxx", nil))
+
+	// then
+	assert.Equal(t, http.StatusMethodNotAllowed, prefetched)
+	assert.Equal(t, http.StatusForbidden, forged)
+	assert.Equal(t, ";0;", openNotifications)
+	assert.Equal(t, http.StatusOK, posted)
+	assert.Equal(t, http.StatusMethodNotAllowed, confirmedWithPost)
+
+	tearDownTest(t, server, store)
+}
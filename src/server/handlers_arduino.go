@@ -1,79 +1,253 @@
 package server
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/authentication"
 	"github.com/usb-radiology/light-messenger/src/configuration"
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
-func arduinoStatusHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
-	w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueText)
+const defaultSignatureMaxAge = 5 * time.Minute
 
-	vars := mux.Vars(r)
-	department := vars["department"]
+func arduinoStatusHandler(nonces *authentication.Nonces) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueText)
 
-	status := lmdatabase.ArduinoStatus{
-		DepartmentID: department,
-		StatusAt:     time.Now().Unix(),
-	}
+		vars := mux.Vars(r)
+		department := vars["department"]
 
-	{
-		errInsert := lmdatabase.ArduinoStatusInsert(db, status)
-		if errInsert != nil {
-			return errInsert
+		token, status, errAuthenticate := authenticateDevice(config, store, nonces, r, department)
+		if errAuthenticate != nil {
+			return errAuthenticate
 		}
-	}
-
-	{
-		errWrite := writeBytes(w, []byte(fmt.Sprintf("%+v", status)))
-		if errWrite != nil {
-			return errors.WithStack(errWrite)
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return nil
 		}
-	}
 
-	return nil
-}
+		device, validDevice := deviceFromRequest(r, department, token)
+		if !validDevice {
+			writeBadRequest(w)
+			return nil
+		}
 
-func openStatusHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
-	w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueText)
+		if token == nil {
+			// a light with a token must send it, else anybody could move it to another department or report it up
+			bound, errBound := store.DeviceTokenGetByDevice(device.DeviceID)
+			if errBound != nil {
+				return errBound
+			}
+			if bound != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return nil
+			}
 
-	vars := mux.Vars(r)
-	department := vars["department"]
+			tokens, errTokens := store.DeviceTokenGetByDepartment(department)
+			if errTokens != nil {
+				return errTokens
+			}
+			device.Unauthenticated = len(*tokens) > 0
+		}
 
-	notifications, err := lmdatabase.NotificationGetOpenNotificationsByDepartment(db, department)
-	if err != nil {
-		return err
-	}
+		arduinoStatus := lmdatabase.ArduinoStatus{
+			DepartmentID: department,
+			StatusAt:     device.LastSeenAt,
+		}
 
-	if len(*notifications) > 0 {
-		arduinoPrioMap := map[int]string{
-			1: "HIGH",
-			2: "MEDIUM",
-			3: "LOW",
+		// the department is shown as connected for authenticated heartbeats only
+		if !device.Unauthenticated {
+			errInsert := store.ArduinoStatusInsert(arduinoStatus)
+			if errInsert != nil {
+				return errInsert
+			}
 		}
 
 		{
-			errWrite := writeBytes(w, []byte(fmt.Sprintf(";1;%v;", arduinoPrioMap[(*notifications)[0].Priority])))
-			if errWrite != nil {
-				return errors.WithStack(errWrite)
+			errHeartbeat := store.DeviceHeartbeat(device)
+			if errHeartbeat != nil {
+				return errHeartbeat
 			}
 		}
 
-	} else {
-
 		{
-			errWrite := writeBytes(w, []byte(fmt.Sprintf(";0;")))
+			errWrite := writeBytes(w, []byte(fmt.Sprintf("%+v", arduinoStatus)))
 			if errWrite != nil {
 				return errors.WithStack(errWrite)
 			}
 		}
+
+		return nil
+	}
+}
+
+// deviceFromRequest reads the heartbeat of a device from the query parameters, lights that do not send a device
+// identifier are registered under the identifier of their token or else of their department, it reports false if a
+// value does not fit into its column
+func deviceFromRequest(r *http.Request, department string, token *lmdatabase.DeviceToken) (lmdatabase.Device, bool) {
+	query := r.URL.Query()
+
+	device := lmdatabase.Device{
+		DeviceID:        strings.TrimSpace(query.Get("device")),
+		DepartmentID:    department,
+		Location:        strings.TrimSpace(query.Get("location")),
+		FirmwareVersion: strings.TrimSpace(query.Get("firmware")),
+		LastSeenAt:      time.Now().Unix(),
+		RemoteAddress:   clientAddress(r),
+	}
+
+	if device.DeviceID == "" {
+		device.DeviceID = department
+		if token != nil {
+			device.DeviceID = token.DeviceID
+		}
+	}
+
+	valid := utf8.RuneCountInString(device.DeviceID) <= 255 &&
+		utf8.RuneCountInString(device.Location) <= 255 &&
+		utf8.RuneCountInString(device.FirmwareVersion) <= 64
+
+	return device, valid
+}
+
+// authenticateDevice returns the token the light sent or signed with, nil if it did neither, and http.StatusOK if it
+// may access the department, http.StatusUnauthorized for unknown tokens, invalid signatures or, if required, without
+// token or signature and http.StatusForbidden for the token of a light of another department or another device
+// identifier
+func authenticateDevice(config *configuration.Configuration, store lmdatabase.Store, nonces *authentication.Nonces, r *http.Request, department string) (*lmdatabase.DeviceToken, int, error) {
+	if r.URL.Query().Get("signature") != "" {
+		return authenticateSignedDevice(store, nonces, r, department)
+	}
+
+	sent := deviceTokenFromRequest(r)
+	switch {
+	case sent == "" && (config.Devices.RequireToken || config.Devices.RequireSignature):
+		return nil, http.StatusUnauthorized, nil
+	case sent == "":
+		return nil, http.StatusOK, nil
+	case config.Devices.RequireSignature:
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	token, errToken := store.DeviceTokenGetByHash(authentication.HashDeviceToken(sent))
+	if errToken != nil {
+		return nil, 0, errToken
+	}
+
+	switch {
+	case token == nil:
+		return nil, http.StatusUnauthorized, nil
+	case token.DepartmentID != department:
+		return nil, http.StatusForbidden, nil
+	case r.URL.Query().Get("device") != "" && strings.TrimSpace(r.URL.Query().Get("device")) != token.DeviceID:
+		return nil, http.StatusForbidden, nil
+	}
+
+	return token, http.StatusOK, nil
+}
+
+// authenticateSignedDevice verifies the signature of the method, path and query parameters with the secret of the
+// device and rejects timestamps that are not fresh and nonces that were used before, so sniffed requests can't be
+// replayed. The nonce is only recorded for requests that are permitted otherwise, so a rejected request does not use
+// up the nonce of a legitimate one.
+func authenticateSignedDevice(store lmdatabase.Store, nonces *authentication.Nonces, r *http.Request, department string) (*lmdatabase.DeviceToken, int, error) {
+	query := r.URL.Query()
+
+	deviceID := query.Get("device")
+	nonce := query.Get("nonce")
+	timestamp, errTimestamp := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+	if deviceID == "" || nonce == "" || len(nonce) > 64 || errTimestamp != nil {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	token, errToken := store.DeviceTokenGetByDevice(deviceID)
+	if errToken != nil {
+		return nil, 0, errToken
+	}
+
+	switch {
+	case token == nil || token.Secret == "":
+		return nil, http.StatusUnauthorized, nil
+	case !authentication.VerifyDeviceSignature(token.Secret, r.Method, r.URL.Path, query, query.Get("signature")):
+		return nil, http.StatusUnauthorized, nil
+	case token.DepartmentID != department:
+		return nil, http.StatusForbidden, nil
+	case !nonces.Use(deviceID, nonce, timestamp, time.Now().Unix()):
+		return nil, http.StatusUnauthorized, nil
 	}
 
-	return nil
+	return token, http.StatusOK, nil
+}
+
+// signatureMaxAge returns how long signed requests of the lights are fresh
+func signatureMaxAge(initConfig *configuration.Configuration) time.Duration {
+	if initConfig.Devices.SignatureMaxAge <= 0 {
+		return defaultSignatureMaxAge
+	}
+	return time.Duration(initConfig.Devices.SignatureMaxAge) * time.Second
+}
+
+// deviceTokenFromRequest returns the bearer token of the authorization header or else the token query parameter,
+// which is easier to send for the HttpClient of the Arduino Yun
+func deviceTokenFromRequest(r *http.Request) string {
+	if authorization := r.Header.Get("authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	return strings.TrimSpace(r.URL.Query().Get("token"))
+}
+
+func openStatusHandler(nonces *authentication.Nonces) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueText)
+
+		vars := mux.Vars(r)
+		department := vars["department"]
+
+		_, status, errAuthenticate := authenticateDevice(config, store, nonces, r, department)
+		if errAuthenticate != nil {
+			return errAuthenticate
+		}
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return nil
+		}
+
+		notifications, err := store.NotificationGetOpenNotificationsByDepartment(department)
+		if err != nil {
+			return err
+		}
+
+		if len(*notifications) > 0 {
+			arduinoPrioMap := map[int]string{
+				1: "HIGH",
+				2: "MEDIUM",
+				3: "LOW",
+			}
+
+			{
+				errWrite := writeBytes(w, []byte(fmt.Sprintf(";1;%v;", arduinoPrioMap[(*notifications)[0].Priority])))
+				if errWrite != nil {
+					return errors.WithStack(errWrite)
+				}
+			}
+
+		} else {
+
+			{
+				errWrite := writeBytes(w, []byte(fmt.Sprintf(";0;")))
+				if errWrite != nil {
+					return errors.WithStack(errWrite)
+				}
+			}
+		}
+
+		return nil
+	}
 }
@@ -1,21 +1,26 @@
 package server
 
 import (
-	"database/sql"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/deviceclient"
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
 func TestIntegrationArduinoStatusShouldLogAtGivenTime(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	departmentID := "abc"
 	now := time.Now().Unix()
@@ -31,7 +36,7 @@ func TestIntegrationArduinoStatusShouldLogAtGivenTime(t *testing.T) {
 	// then
 	assert.Equal(t, http.StatusOK, response.StatusCode)
 
-	result, errQuery := lmdatabase.ArduinoStatusQueryWithin5MinutesFromNow(db, departmentID, now)
+	result, errQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(departmentID, now)
 	if errQuery != nil {
 		t.Fatalf("%+v", errors.WithStack(errQuery))
 	}
@@ -43,13 +48,96 @@ func TestIntegrationArduinoStatusShouldLogAtGivenTime(t *testing.T) {
 	assert.Equal(t, departmentID, result.DepartmentID)
 	assert.LessOrEqual(t, now, result.StatusAt)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoStatusShouldRegisterDevice(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	departmentID := "abc"
+	now := time.Now().Unix()
+
+	testRequest(t, "GET", server.URL+"/nce-rest/arduino-status/"+departmentID+"-status?device=light-1&location=Befundraum%201&firmware=1.0")
+
+	// when
+	testRequest(t, "GET", server.URL+"/nce-rest/arduino-status/"+departmentID+"-status?device=light-1&firmware=1.1")
+
+	// then
+	devices, errQuery := store.DeviceGetByDepartment(departmentID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 1, len(*devices))
+
+	device := (*devices)[0]
+	assert.Equal(t, "light-1", device.DeviceID)
+	assert.Equal(t, departmentID, device.DepartmentID)
+	assert.Equal(t, "Befundraum 1", device.Location)
+	assert.Equal(t, "1.1", device.FirmwareVersion)
+	assert.LessOrEqual(t, now, device.LastSeenAt)
+	assert.NotEmpty(t, device.RemoteAddress)
+
+	status, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(departmentID, now)
+	if errStatusQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errStatusQuery))
+	}
+	assert.NotNil(t, status)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoStatusShouldRegisterDeviceUnderDepartmentWithoutIdentifier(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	departmentID := "abc"
+
+	// when
+	testRequest(t, "GET", server.URL+"/nce-rest/arduino-status/"+departmentID+"-status")
+
+	// then
+	devices, errQuery := store.DeviceGetByDepartment(departmentID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+
+	assert.Equal(t, 1, len(*devices))
+	assert.Equal(t, departmentID, (*devices)[0].DeviceID)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoStatusShouldReturnHTTP400WhenFirmwareVersionIsTooLong(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	departmentID := "abc"
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/nce-rest/arduino-status/"+departmentID+"-status?device=light-1&firmware="+strings.Repeat("1", 65), nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	devices, errQuery := store.DeviceGetByDepartment(departmentID)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Empty(t, *devices)
+
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationArduinoGetOpenNotificationsShouldGetHighPriorityNotificationWhenMultipleExist(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		departmentID = "abc"
@@ -59,9 +147,9 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetHighPriorityNotification
 		now          = time.Now().Unix()
 	)
 
-	notificationInsert(t, db, departmentID, 1, modality1, now-10)
-	notificationInsert(t, db, departmentID, 2, modality2, now-5)
-	notificationInsert(t, db, departmentID, 3, modality3, now) // lowest priority came in last
+	notificationInsert(t, store, departmentID, 1, modality1, now-10)
+	notificationInsert(t, store, departmentID, 2, modality2, now-5)
+	notificationInsert(t, store, departmentID, 3, modality3, now) // lowest priority came in last
 
 	// when
 
@@ -82,13 +170,13 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetHighPriorityNotification
 
 	assert.Equal(t, ";1;HIGH;", bodyString)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationArduinoGetOpenNotificationsShouldGetMediumPriorityNotificationWhenMultipleExist(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		departmentID = "abc"
@@ -97,8 +185,8 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetMediumPriorityNotificati
 		now          = time.Now().Unix()
 	)
 
-	notificationInsert(t, db, departmentID, 2, modality2, now-5)
-	notificationInsert(t, db, departmentID, 3, modality3, now) // lowest priority came in last
+	notificationInsert(t, store, departmentID, 2, modality2, now-5)
+	notificationInsert(t, store, departmentID, 3, modality3, now) // lowest priority came in last
 
 	// when
 
@@ -119,13 +207,13 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetMediumPriorityNotificati
 
 	assert.Equal(t, ";1;MEDIUM;", bodyString)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationArduinoGetOpenNotificationsShouldGetLowPriorityNotificationWhenMultipleExist(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		departmentID = "abc"
@@ -134,8 +222,8 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetLowPriorityNotificationW
 		now          = time.Now().Unix()
 	)
 
-	notificationInsert(t, db, departmentID, 3, modality2, now)
-	notificationInsert(t, db, departmentID, 3, modality3, now)
+	notificationInsert(t, store, departmentID, 3, modality2, now)
+	notificationInsert(t, store, departmentID, 3, modality3, now)
 
 	// when
 
@@ -156,13 +244,13 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGetLowPriorityNotificationW
 
 	assert.Equal(t, ";1;LOW;", bodyString)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationArduinoGetOpenNotificationsShouldGet0WhenNoNotificationsExist(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		departmentID = "abc"
@@ -187,12 +275,210 @@ func TestIntegrationArduinoGetOpenNotificationsShouldGet0WhenNoNotificationsExis
 
 	assert.Equal(t, ";0;", bodyString)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
-func notificationInsert(t *testing.T, db *sql.DB, departmentID string, priority int, modality string, createdAt int64) {
-	errNotificationInsert := lmdatabase.NotificationInsert(db, departmentID, priority, modality, createdAt)
+func notificationInsert(t *testing.T, store lmdatabase.Store, departmentID string, priority int, modality string, createdAt int64) {
+	_, errNotificationInsert := store.NotificationInsert(departmentID, priority, modality, createdAt)
 	if errNotificationInsert != nil {
 		t.Fatalf("%+v", errNotificationInsert)
 	}
 }
+
+func TestIntegrationArduinoStatusShouldAuthenticateDeviceTokensAndFlagHeartbeatsWithout(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	token, tokenHash, errToken := authentication.NewDeviceToken()
+	if errToken != nil {
+		t.Fatalf("%+v", errToken)
+	}
+	store.DeviceTokenInsert(lmdatabase.DeviceToken{DeviceID: "abc-1", DepartmentID: "abc", TokenHash: tokenHash, CreatedAt: 1000})
+
+	status := func(path string, authorization string) int {
+		request, _ := http.NewRequest("GET", server.URL+"/nce-rest/arduino-status/"+path, nil)
+		if authorization != "" {
+			request.Header.Set("authorization", authorization)
+		}
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	withQueryToken := status("abc-status?token="+token, "")
+	withBearerToken := status("abc-status?device=abc-1&firmware=1.1", "Bearer "+token)
+	withoutToken := status("abc-status?device=abc-2", "")
+	unknownToken := status("abc-status?token=0123", "")
+	otherDepartment := status("def-status?token="+token, "")
+	otherDevice := status("abc-status?device=abc-2&token="+token, "")
+	openNotifications := status("abc-open-notifications?token="+token, "")
+
+	devices, _ := store.DeviceGetByDepartment("abc")
+	card, errCard := getCardHTML(store, "ct", "abc")
+	if errCard != nil {
+		t.Fatalf("%+v", errCard)
+	}
+
+	// then
+	assert.Equal(t, http.StatusOK, withQueryToken)
+	assert.Equal(t, http.StatusOK, withBearerToken)
+	assert.Equal(t, http.StatusOK, withoutToken)
+	assert.Equal(t, http.StatusUnauthorized, unknownToken)
+	assert.Equal(t, http.StatusForbidden, otherDepartment)
+	assert.Equal(t, http.StatusForbidden, otherDevice)
+	assert.Equal(t, http.StatusOK, openNotifications)
+
+	assert.Equal(t, 2, len(*devices))
+	assert.Equal(t, "abc-1", (*devices)[0].DeviceID)
+	assert.Equal(t, "1.1", (*devices)[0].FirmwareVersion)
+	assert.False(t, (*devices)[0].Unauthenticated)
+	assert.Equal(t, "abc-2", (*devices)[1].DeviceID)
+	assert.True(t, (*devices)[1].Unauthenticated)
+	assert.Contains(t, card, "abc-2: nicht authentifiziert")
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoStatusShouldRejectHeartbeatsWithoutTokenForDevicesWithToken(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	token, tokenHash, _ := authentication.NewDeviceToken()
+	store.DeviceTokenInsert(lmdatabase.DeviceToken{DeviceID: "abc-1", DepartmentID: "abc", TokenHash: tokenHash, CreatedAt: 1000})
+
+	testRequest(t, "GET", server.URL+"/nce-rest/arduino-status/abc-status?token="+token)
+
+	status := func(path string) int {
+		request, _ := http.NewRequest("GET", server.URL+"/nce-rest/arduino-status/"+path, nil)
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	otherDepartment := status("def-status?device=abc-1")
+	sameDepartment := status("abc-status?device=abc-1")
+
+	devices, _ := store.DeviceGetByDepartment("abc")
+	hijacked, _ := store.DeviceGetByDepartment("def")
+	arduinoStatus, _ := store.ArduinoStatusQueryWithin5MinutesFromNow("def", time.Now().Unix()-1)
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, otherDepartment)
+	assert.Equal(t, http.StatusUnauthorized, sameDepartment)
+
+	assert.Equal(t, 1, len(*devices))
+	assert.Equal(t, "abc-1", (*devices)[0].DeviceID)
+	assert.False(t, (*devices)[0].Unauthenticated)
+	assert.Equal(t, 0, len(*hijacked))
+	assert.Nil(t, arduinoStatus)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoShouldRejectLightsWithoutTokenIfRequired(t *testing.T) {
+
+	// given
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Devices.RequireToken = true
+	})
+
+	token, tokenHash, _ := authentication.NewDeviceToken()
+	store.DeviceTokenInsert(lmdatabase.DeviceToken{DeviceID: "abc", DepartmentID: "abc", TokenHash: tokenHash, CreatedAt: 1000})
+
+	status := func(path string) int {
+		request, _ := http.NewRequest("GET", server.URL+"/nce-rest/arduino-status/"+path, nil)
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// when
+	heartbeat := status("abc-status")
+	openNotifications := status("abc-open-notifications")
+	authenticated := status("abc-status?token=" + token)
+
+	arduinoStatus, _ := store.ArduinoStatusQueryWithin5MinutesFromNow("abc", time.Now().Unix()-1)
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, heartbeat)
+	assert.Equal(t, http.StatusUnauthorized, openNotifications)
+	assert.Equal(t, http.StatusOK, authenticated)
+	assert.NotNil(t, arduinoStatus)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationArduinoShouldAuthenticateSignedRequestsAndRejectReplays(t *testing.T) {
+
+	// given
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Devices.RequireSignature = true
+	})
+
+	_, tokenHash, _ := authentication.NewDeviceToken()
+	store.DeviceTokenInsert(lmdatabase.DeviceToken{DeviceID: "abc-1", DepartmentID: "abc", TokenHash: tokenHash, Secret: "secret", CreatedAt: 1000})
+
+	token, otherTokenHash, _ := authentication.NewDeviceToken()
+	store.DeviceTokenInsert(lmdatabase.DeviceToken{DeviceID: "abc-2", DepartmentID: "abc", TokenHash: otherTokenHash, CreatedAt: 1000})
+
+	client := deviceclient.Client{URL: server.URL, Department: "abc", Device: "abc-1", Secret: "secret"}
+
+	status := func(target string) int {
+		request, _ := http.NewRequest("GET", target, nil)
+		response := getResponse(t, request)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	signed := func(department string, secret string, timestamp int64, nonce string) string {
+		path := "/nce-rest/arduino-status/" + department + "-status"
+		query := url.Values{"device": {"abc-1"}, "timestamp": {fmt.Sprint(timestamp)}, "nonce": {nonce}}
+		query.Set("signature", authentication.SignDeviceRequest(secret, http.MethodGet, path, query))
+		return server.URL + path + "?" + query.Encode()
+	}
+
+	// when
+	errStatus := client.Status("Raum 1", "2.0")
+	open, errOpen := client.OpenNotifications()
+
+	replayedURL, _ := client.SignedURL("status", url.Values{"location": {"Raum 1"}})
+	tampered := status(strings.Replace(replayedURL, "location=Raum+1", "location=Raum+2", 1))
+	otherEndpoint := status(strings.Replace(replayedURL, "abc-status", "abc-open-notifications", 1))
+	first := status(replayedURL)
+	replayed := status(replayedURL)
+
+	now := time.Now().Unix()
+	wrongSecret := status(signed("abc", "wrong", now, "a"))
+	stale := status(signed("abc", "secret", now-301, "b"))
+	otherDepartment := status(signed("def", "secret", now, "c"))
+	nonceOfForbidden := status(signed("abc", "secret", now, "c"))
+	plainToken := status(server.URL + "/nce-rest/arduino-status/abc-status?token=" + token)
+	withoutToken := status(server.URL + "/nce-rest/arduino-status/abc-status")
+
+	devices, _ := store.DeviceGetByDepartment("abc")
+
+	// then
+	assert.NoError(t, errStatus)
+	assert.NoError(t, errOpen)
+	assert.Equal(t, ";0;", open)
+	assert.Equal(t, http.StatusUnauthorized, tampered)
+	assert.Equal(t, http.StatusUnauthorized, otherEndpoint)
+	assert.Equal(t, http.StatusOK, first)
+	assert.Equal(t, http.StatusUnauthorized, replayed)
+	assert.Equal(t, http.StatusUnauthorized, wrongSecret)
+	assert.Equal(t, http.StatusUnauthorized, stale)
+	assert.Equal(t, http.StatusForbidden, otherDepartment)
+	assert.Equal(t, http.StatusOK, nonceOfForbidden)
+	assert.Equal(t, http.StatusUnauthorized, plainToken)
+	assert.Equal(t, http.StatusUnauthorized, withoutToken)
+
+	assert.Equal(t, 1, len(*devices))
+	assert.Equal(t, "Raum 1", (*devices)[0].Location)
+	assert.False(t, (*devices)[0].Unauthenticated)
+
+	tearDownTest(t, server, store)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/eventbus"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// the status event is sent when a page connects and then every eventStreamInterval, it keeps the status of the
+// lights current and the connection open
+const (
+	eventStreamStatus   = "status"
+	eventStreamInterval = 30 * time.Second
+)
+
+// radiologieEventData is the data of the events of the radiologist page
+type radiologieEventData struct {
+	Type           string `json:"type"`
+	NotificationID string `json:"notificationId"`
+	Status         string `json:"status"`
+	Notifications  string `json:"notifications"`
+}
+
+// visierungEventData is the data of the events of the MTRA page, the cards by department
+type visierungEventData struct {
+	Type           string            `json:"type"`
+	NotificationID string            `json:"notificationId"`
+	Cards          map[string]string `json:"cards"`
+	Processed      string            `json:"processed"`
+}
+
+func radiologieEventsHandler(bus *eventbus.Bus) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		department := mux.Vars(r)["department"]
+
+		if !isDepartment(department) {
+			http.NotFound(w, r)
+			return nil
+		}
+
+		concerns := func(event eventbus.Event) bool {
+			return event.Concerns(department)
+		}
+
+		render := func(event eventbus.Event) (interface{}, error) {
+			statusHTML, errStatusHTML := getRadiologieStatusHTML(store, department, time.Now().Unix())
+			if errStatusHTML != nil {
+				return nil, errStatusHTML
+			}
+
+			notificationsHTML, errNotificationsHTML := getNotificationsHTML(store, department)
+			if errNotificationsHTML != nil {
+				return nil, errNotificationsHTML
+			}
+
+			return radiologieEventData{
+				Type:           event.Type,
+				NotificationID: event.NotificationID,
+				Status:         string(statusHTML),
+				Notifications:  string(notificationsHTML),
+			}, nil
+		}
+
+		return streamEvents(bus, w, r, concerns, render)
+	}
+}
+
+func visierungEventsHandler(bus *eventbus.Bus) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		modality := mux.Vars(r)["modality"]
+
+		if !isModality(modality) {
+			http.NotFound(w, r)
+			return nil
+		}
+
+		concerns := func(event eventbus.Event) bool {
+			return event.Modality == modality
+		}
+
+		render := func(event eventbus.Event) (interface{}, error) {
+			cards := make(map[string]string)
+			for _, department := range departments {
+				cardHTML, errCardHTML := getCardHTML(store, modality, department)
+				if errCardHTML != nil {
+					return nil, errCardHTML
+				}
+				cards[department] = string(cardHTML)
+			}
+
+			processedHTML, errProcessedHTML := getProcessedHTML(store, modality)
+			if errProcessedHTML != nil {
+				return nil, errProcessedHTML
+			}
+
+			return visierungEventData{
+				Type:           event.Type,
+				NotificationID: event.NotificationID,
+				Cards:          cards,
+				Processed:      string(processedHTML),
+			}, nil
+		}
+
+		return streamEvents(bus, w, r, concerns, render)
+	}
+}
+
+// streamEvents sends the rendered page updates as server-sent events until the client disconnects: a status event
+// first and then one for every event on the bus that concerns the page. A client that falls behind is disconnected,
+// its EventSource reconnects and catches up with the first status event.
+func streamEvents(bus *eventbus.Bus, w http.ResponseWriter, r *http.Request, concerns func(event eventbus.Event) bool, render func(event eventbus.Event) (interface{}, error)) error {
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		return errors.New("the response writer does not support streaming")
+	}
+
+	subscription := bus.Subscribe()
+	defer bus.Unsubscribe(subscription)
+
+	w.Header().Set(HTMLHeaderContentType, "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("x-accel-buffering", "no") // nginx must not buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event eventbus.Event) error {
+		data, errRender := render(event)
+		if errRender != nil {
+			return errRender
+		}
+
+		dataJSON, errJSONMarshal := json.Marshal(data)
+		if errJSONMarshal != nil {
+			return errors.WithStack(errJSONMarshal)
+		}
+
+		_, errWrite := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, dataJSON)
+		if errWrite != nil {
+			return errors.WithStack(errWrite)
+		}
+
+		flusher.Flush()
+		return nil
+	}
+
+	errSend := send(eventbus.Event{Type: eventStreamStatus})
+	if errSend != nil {
+		return errSend
+	}
+
+	ticker := time.NewTicker(eventStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+
+		case <-ticker.C:
+			errSend = send(eventbus.Event{Type: eventStreamStatus})
+
+		case event, subscribed := <-subscription:
+			if !subscribed {
+				return nil
+			}
+			if concerns(event) {
+				errSend = send(event)
+			}
+		}
+
+		if errSend != nil {
+			return errSend
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// openEventStream connects to the server-sent events of the path, the stream is closed by cancel
+func openEventStream(t *testing.T, server *httptest.Server, path string) (*bufio.Reader, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	request, _ := http.NewRequest("GET", server.URL+path, nil)
+	response := getResponse(t, request.WithContext(ctx))
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get(HTMLHeaderContentType))
+
+	return bufio.NewReader(response.Body), cancel
+}
+
+// readServerSentEvent reads the next event from the stream and decodes its data into v
+func readServerSentEvent(t *testing.T, reader *bufio.Reader, v interface{}) string {
+	var eventType string
+	for {
+		line, errRead := reader.ReadString('\n')
+		if errRead != nil {
+			t.Fatalf("%+v", errors.WithStack(errRead))
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			errJSONDecode := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), v)
+			if errJSONDecode != nil {
+				t.Fatalf("%+v", errors.WithStack(errJSONDecode))
+			}
+		case line == "" && eventType != "":
+			return eventType
+		}
+	}
+}
+
+func TestIntegrationRadiologieEventsShouldPushNotificationsOfTheDepartment(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	stream, cancel := openEventStream(t, server, "/radiologie/msk/events")
+
+	var status radiologieEventData
+	assert.Equal(t, eventStreamStatus, readServerSentEvent(t, stream, &status))
+	assert.Equal(t, 0, getDocument(t, status.Notifications).Find(".notification").Length())
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/modality/mr/department/nr/prio/2", nil) // another department
+	getResponse(t, request)
+	request = newCSRFRequest("POST", server.URL+"/modality/ct/department/msk/prio/1", nil)
+	getResponse(t, request)
+
+	// then
+	var created radiologieEventData
+	assert.Equal(t, "created", readServerSentEvent(t, stream, &created))
+	assert.NotEmpty(t, created.NotificationID)
+
+	doc := getDocument(t, created.Notifications)
+	assert.Equal(t, 1, doc.Find("#"+created.NotificationID).Length())
+	assert.Contains(t, created.Status, "Arduino Status")
+
+	cancel()
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationVisierungEventsShouldPushCardsAndProcessedNotificationsOfTheModality(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	stream, cancel := openEventStream(t, server, "/mtra/ct/events")
+
+	var status visierungEventData
+	assert.Equal(t, eventStreamStatus, readServerSentEvent(t, stream, &status))
+	assert.Equal(t, len(departments), len(status.Cards))
+
+	request := newCSRFRequest("POST", server.URL+"/modality/ct/department/aod/prio/2", nil)
+	getResponse(t, request)
+
+	var created visierungEventData
+	assert.Equal(t, "created", readServerSentEvent(t, stream, &created))
+
+	// when
+	request = newCSRFRequest("DELETE", server.URL+"/notification/aod/"+created.NotificationID, nil)
+	getResponse(t, request)
+
+	// then
+	var confirmed visierungEventData
+	assert.Equal(t, "confirmed", readServerSentEvent(t, stream, &confirmed))
+	assert.Equal(t, created.NotificationID, confirmed.NotificationID)
+
+	card := getDocument(t, confirmed.Cards["aod"])
+	assert.Equal(t, 0, card.Find("header .tags span").Length())
+
+	processed := getDocument(t, "<table>"+confirmed.Processed+"</table>")
+	assert.Equal(t, 1, processed.Find("#events-"+created.NotificationID).Length())
+
+	cancel()
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationEventsShouldReturnHTTP404ForUnknownDepartmentOrModality(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	for _, path := range []string{"/radiologie/xyz/events", "/mtra/xyz/events"} {
+		// when
+		request, _ := http.NewRequest("GET", server.URL+path, nil)
+		response := getResponse(t, request)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, response.StatusCode, path)
+	}
+
+	tearDownTest(t, server, store)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// loginHandler shows the login form and logs the user in, then it redirects to the page the user came from
+func loginHandler(authenticator *authentication.Authenticator) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		next := localPath(r.FormValue("next"))
+
+		if !authenticator.Enabled() {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return nil
+		}
+
+		// e.g. users a reverse proxy authenticated need no login
+		if r.Method == http.MethodGet {
+			user, errUser := authenticator.User(r)
+			if errUser != nil {
+				return errUser
+			}
+			if user != nil {
+				http.Redirect(w, r, next, http.StatusSeeOther)
+				return nil
+			}
+		}
+
+		token, errToken := csrfToken(config, w, r)
+		if errToken != nil {
+			return errToken
+		}
+
+		data := map[string]interface{}{
+			"Next":      next,
+			"Username":  "",
+			"Error":     "",
+			"CSRFToken": token,
+		}
+
+		if r.Method == http.MethodPost {
+			username := strings.TrimSpace(r.PostFormValue("username"))
+
+			_, errLogin := authenticator.Login(w, r, username, r.PostFormValue("password"))
+			if errLogin == nil {
+				http.Redirect(w, r, next, http.StatusSeeOther)
+				return nil
+			}
+
+			status := http.StatusUnauthorized
+			switch errors.Cause(errLogin) {
+			case authentication.ErrInvalidCredentials:
+				data["Error"] = "Benutzername oder Passwort ist falsch."
+			case authentication.ErrTooManyAttempts:
+				status = http.StatusTooManyRequests
+				data["Error"] = "Zu viele falsche Passwörter, bitte in einigen Minuten erneut versuchen."
+			default:
+				return errLogin
+			}
+
+			data["Username"] = username
+
+			w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueHTML)
+			w.WriteHeader(status)
+		}
+
+		return renderTemplate(w, r, templates[templateLoginID], data)
+	}
+}
+
+// logoutHandler ends the session and shows the login form
+func logoutHandler(authenticator *authentication.Authenticator) func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+	return func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+		errLogout := authenticator.Logout(w, r)
+		if errLogout != nil {
+			return errLogout
+		}
+
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil
+	}
+}
+
+// localPath returns the path if it is one of this server and "/" otherwise, so the login does not redirect elsewhere
+func localPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,454 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/authentication"
+	"github.com/usb-radiology/light-messenger/src/authentication/ldaptest"
+	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+const testPassword = "correct horse battery staple"
+
+// setupTestWithAuthentication is setupTest with authentication enabled and the users mtra-ct, radiologist-msk and
+// admin, all with testPassword
+func setupTestWithAuthentication(t *testing.T) (*httptest.Server, lmdatabase.Store) {
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Authentication.Enabled = true
+		initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+	})
+
+	passwordHash, errHash := authentication.HashPassword(testPassword)
+	if errHash != nil {
+		t.Fatalf("%+v", errors.WithStack(errHash))
+	}
+
+	users := []lmdatabase.User{
+		{Username: "mtra-ct", PasswordHash: passwordHash, Role: lmdatabase.RoleMTRA, Modality: "ct"},
+		{Username: "radiologist-msk", PasswordHash: passwordHash, Role: lmdatabase.RoleRadiologist, DepartmentID: "msk"},
+		{Username: "admin", PasswordHash: passwordHash, Role: lmdatabase.RoleAdmin},
+	}
+	for _, user := range users {
+		if errInsert := store.UserInsert(user); errInsert != nil {
+			t.Fatalf("%+v", errors.WithStack(errInsert))
+		}
+	}
+
+	return server, store
+}
+
+// getLoginClient returns a client that keeps its session cookie and does not follow redirects
+func getLoginClient(t *testing.T) *http.Client {
+	jar, errJar := cookiejar.New(nil)
+	if errJar != nil {
+		t.Fatalf("%+v", errors.WithStack(errJar))
+	}
+
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func doRequest(t *testing.T, client *http.Client, method string, url string) *http.Response {
+	request := newCSRFRequest(method, url, nil)
+
+	response, errDo := client.Do(request)
+	if errDo != nil {
+		t.Fatalf("%+v", errors.WithStack(errDo))
+	}
+	response.Body.Close()
+
+	return response
+}
+
+// loginAs logs the client in as the user, or else returns the response of the failed login; it sends the CSRF token
+// in the form as the login page does
+func loginAs(t *testing.T, client *http.Client, server *httptest.Server, username string, password string) *http.Response {
+	serverURL, errParse := url.Parse(server.URL)
+	if errParse != nil {
+		t.Fatalf("%+v", errors.WithStack(errParse))
+	}
+	client.Jar.SetCookies(serverURL, []*http.Cookie{{Name: csrfCookieName, Value: testCSRFToken}})
+
+	response, errPost := client.PostForm(server.URL+"/login", url.Values{
+		"username":    {username},
+		"password":    {password},
+		"next":        {"/history"},
+		csrfFormField: {testCSRFToken},
+	})
+	if errPost != nil {
+		t.Fatalf("%+v", errors.WithStack(errPost))
+	}
+
+	return response
+}
+
+func TestIntegrationLoginShouldRedirectToTheLoginAndBack(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+	client := getLoginClient(t)
+
+	// when
+	anonymous := doRequest(t, client, "GET", server.URL+"/")
+	failed := loginAs(t, client, server, "mtra-ct", "wrong")
+	loggedIn := loginAs(t, client, server, "mtra-ct", testPassword)
+	loggedIn.Body.Close()
+
+	indexResponse, errIndex := client.Get(server.URL + "/")
+	if errIndex != nil {
+		t.Fatalf("%+v", errors.WithStack(errIndex))
+	}
+	index, errHTMLDoc := goquery.NewDocumentFromResponse(indexResponse)
+	if errHTMLDoc != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTMLDoc))
+	}
+
+	loggedOut := doRequest(t, client, "POST", server.URL+"/logout")
+	afterLogout := doRequest(t, client, "GET", server.URL+"/")
+
+	// then
+	assert.Equal(t, http.StatusSeeOther, anonymous.StatusCode)
+	assert.Equal(t, "/login?next=%2F", anonymous.Header.Get("location"))
+
+	assert.Equal(t, http.StatusUnauthorized, failed.StatusCode)
+	assert.Contains(t, string(getResponseBody(t, failed)), "Benutzername oder Passwort ist falsch.")
+
+	assert.Equal(t, http.StatusSeeOther, loggedIn.StatusCode)
+	assert.Equal(t, "/history", loggedIn.Header.Get("location"))
+	assert.Equal(t, "mtra-ct", index.Find("#user").Text())
+
+	assert.Equal(t, http.StatusSeeOther, loggedOut.StatusCode)
+	assert.Equal(t, http.StatusSeeOther, afterLogout.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationLoginAndLogoutShouldRequireTheCSRFToken(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+	client := getLoginClient(t)
+	attacker := getLoginClient(t)
+
+	// when
+	loginPage, errGet := attacker.Get(server.URL + "/login")
+	if errGet != nil {
+		t.Fatalf("%+v", errors.WithStack(errGet))
+	}
+	loginDoc, errHTMLDoc := goquery.NewDocumentFromResponse(loginPage)
+	if errHTMLDoc != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTMLDoc))
+	}
+
+	forgedLogin, errPost := attacker.PostForm(server.URL+"/login", url.Values{
+		"username": {"mtra-ct"},
+		"password": {testPassword},
+	})
+	if errPost != nil {
+		t.Fatalf("%+v", errors.WithStack(errPost))
+	}
+	forgedLogin.Body.Close()
+
+	loggedIn := loginAs(t, client, server, "mtra-ct", testPassword)
+	loggedIn.Body.Close()
+
+	withoutToken, _ := http.NewRequest("POST", server.URL+"/logout", nil)
+	forgedLogout, errDo := client.Do(withoutToken)
+	if errDo != nil {
+		t.Fatalf("%+v", errors.WithStack(errDo))
+	}
+	forgedLogout.Body.Close()
+
+	afterForgedLogout := doRequest(t, client, "GET", server.URL+"/history")
+
+	// then
+	cookies := loginPage.Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, csrfCookieName, cookies[0].Name)
+		assert.Equal(t, cookies[0].Value, loginDoc.Find("input[name=csrf_token]").AttrOr("value", ""))
+	}
+
+	assert.Equal(t, http.StatusForbidden, forgedLogin.StatusCode)
+	assert.Empty(t, forgedLogin.Header.Get("location"))
+
+	assert.Equal(t, http.StatusSeeOther, loggedIn.StatusCode)
+	assert.Equal(t, http.StatusForbidden, forgedLogout.StatusCode)
+	assert.Equal(t, http.StatusOK, afterForgedLogout.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationLoginShouldAuthenticateUsersOfTheDirectory(t *testing.T) {
+
+	// given
+	directory := ldaptest.NewServer(ldaptest.Entry{
+		DN:       "CN=Ben Beispiel,OU=Staff,DC=example,DC=org",
+		Password: "ben-secret",
+		Attributes: map[string][]string{
+			"objectClass":    {"person"},
+			"sAMAccountName": {"bbeispiel"},
+			"memberOf":       {"CN=LM Radiologie MSK,OU=Groups,DC=example,DC=org"},
+		},
+	})
+	defer directory.Close()
+
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Authentication.Enabled = true
+		initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+		initConfig.Authentication.LDAP.URL = directory.URL
+		initConfig.Authentication.LDAP.BaseDN = "DC=example,DC=org"
+		initConfig.Authentication.LDAP.Groups = []configuration.LDAPGroup{
+			{DN: "CN=LM Radiologie MSK,OU=Groups,DC=example,DC=org", Role: lmdatabase.RoleRadiologist, Department: "msk"},
+		}
+	})
+
+	notificationID, _ := store.NotificationInsert("msk", 1, "ct", 1000)
+	client := getLoginClient(t)
+
+	// when
+	loggedIn := loginAs(t, client, server, "bbeispiel", "ben-secret")
+	loggedIn.Body.Close()
+	confirmed := doRequest(t, client, "DELETE", server.URL+"/notification/msk/"+notificationID)
+
+	// then
+	assert.Equal(t, http.StatusSeeOther, loggedIn.StatusCode)
+	assert.Equal(t, http.StatusOK, confirmed.StatusCode)
+	assert.Equal(t, "bbeispiel", getNotificationByID(t, store, notificationID).ConfirmedBy)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAuthenticationShouldTrustTheUserOfTheProxy(t *testing.T) {
+
+	// given
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Authentication.Enabled = true
+		initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+		initConfig.Authentication.Proxy.TrustedProxies = []string{"127.0.0.1", "::1"}
+		initConfig.Authentication.Proxy.Groups = []configuration.ProxyGroup{
+			{Name: "radiologie-msk", Role: lmdatabase.RoleRadiologist, Department: "msk"},
+		}
+	})
+
+	notificationID, _ := store.NotificationInsert("msk", 1, "ct", 1000)
+	client := getLoginClient(t)
+
+	proxyRequest := func(method string, path string, username string) *http.Response {
+		request := newCSRFRequest(method, server.URL+path, nil)
+		request.Header.Set("X-Remote-User", username)
+		request.Header.Set("X-Remote-Groups", "staff,radiologie-msk")
+
+		response, errDo := client.Do(request)
+		if errDo != nil {
+			t.Fatalf("%+v", errors.WithStack(errDo))
+		}
+		response.Body.Close()
+		return response
+	}
+
+	// when
+	login := proxyRequest("GET", "/login?next=%2Fhistory", "bbeispiel")
+	withoutUser := proxyRequest("GET", "/history", "")
+	confirmed := proxyRequest("DELETE", "/notification/msk/"+notificationID, "bbeispiel")
+
+	// then
+	assert.Equal(t, http.StatusSeeOther, login.StatusCode)
+	assert.Equal(t, "/history", login.Header.Get("location"))
+	assert.Equal(t, http.StatusSeeOther, withoutUser.StatusCode)
+	assert.Equal(t, "/login?next=%2Fhistory", withoutUser.Header.Get("location"))
+	assert.Equal(t, http.StatusOK, confirmed.StatusCode)
+	assert.Equal(t, "bbeispiel", getNotificationByID(t, store, notificationID).ConfirmedBy)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAuthenticationShouldIgnoreTheHeadersOfUntrustedProxies(t *testing.T) {
+
+	// given
+	server, store := setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {
+		initConfig.Authentication.Enabled = true
+		initConfig.Authentication.SessionKey = "0123456789abcdef0123456789abcdef"
+		initConfig.Authentication.Proxy.TrustedProxies = []string{"192.0.2.10"}
+		initConfig.Authentication.Proxy.Groups = []configuration.ProxyGroup{
+			{Name: "admin", Role: lmdatabase.RoleAdmin},
+		}
+	})
+
+	request := newCSRFRequest("POST", server.URL+"/modality/ct/department/msk/prio/1", nil)
+	request.Header.Set("X-Remote-User", "mallory")
+	request.Header.Set("X-Remote-Groups", "admin")
+
+	// when
+	response, errDo := getLoginClient(t).Do(request)
+	if errDo != nil {
+		t.Fatalf("%+v", errors.WithStack(errDo))
+	}
+	response.Body.Close()
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestUnitLocalPathShouldNotRedirectToOtherServers(t *testing.T) {
+	tests := map[string]string{
+		"/mtra/ct?x=1":          "/mtra/ct?x=1",
+		"":                      "/",
+		"https://example.com/":  "/",
+		"//example.com/":        "/",
+		"/\\example.com/":       "/",
+		"javascript:alert(1)//": "/",
+	}
+
+	for path, expected := range tests {
+		assert.Equal(t, expected, localPath(path), path)
+	}
+}
+
+func TestIntegrationAuthenticationShouldRestrictMTRAsToTheirModality(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+	client := getLoginClient(t)
+	loginAs(t, client, server, "mtra-ct", testPassword).Body.Close()
+
+	// when
+	created := doRequest(t, client, "POST", server.URL+"/modality/ct/department/msk/prio/1")
+	otherModality := doRequest(t, client, "POST", server.URL+"/modality/mr/department/msk/prio/1")
+	cancelOtherModality := doRequest(t, client, "POST", server.URL+"/modality/mr/department/msk/cancel")
+
+	notification, _ := store.NotificationGetOpenNotificationByDepartmentAndModality("msk", "ct")
+	confirm := doRequest(t, client, "DELETE", server.URL+"/notification/msk/"+notification.NotificationID)
+	cancelled := doRequest(t, client, "POST", server.URL+"/modality/ct/department/msk/cancel")
+
+	// then
+	assert.Equal(t, http.StatusOK, created.StatusCode)
+	assert.Equal(t, http.StatusForbidden, otherModality.StatusCode)
+	assert.Equal(t, http.StatusForbidden, cancelOtherModality.StatusCode)
+	assert.Equal(t, http.StatusForbidden, confirm.StatusCode)
+	assert.Equal(t, http.StatusOK, cancelled.StatusCode)
+	assert.Equal(t, "mtra-ct", getNotificationByID(t, store, notification.NotificationID).CancelledBy)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAuthenticationShouldRestrictRadiologistsToTheirDepartment(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+
+	admin := getLoginClient(t)
+	loginAs(t, admin, server, "admin", testPassword).Body.Close()
+	doRequest(t, admin, "POST", server.URL+"/modality/ct/department/msk/prio/1")
+	doRequest(t, admin, "POST", server.URL+"/modality/ct/department/nr/prio/1")
+	msk, _ := store.NotificationGetOpenNotificationByDepartmentAndModality("msk", "ct")
+	nr, _ := store.NotificationGetOpenNotificationByDepartmentAndModality("nr", "ct")
+
+	client := getLoginClient(t)
+	loginAs(t, client, server, "radiologist-msk", testPassword).Body.Close()
+
+	// when
+	create := doRequest(t, client, "POST", server.URL+"/modality/ct/department/msk/prio/2")
+	otherDepartment := doRequest(t, client, "DELETE", server.URL+"/notification/msk/"+nr.NotificationID)
+	confirmed := doRequest(t, client, "DELETE", server.URL+"/notification/msk/"+msk.NotificationID)
+
+	// then
+	assert.Equal(t, http.StatusForbidden, create.StatusCode)
+	assert.Equal(t, http.StatusForbidden, otherDepartment.StatusCode)
+	assert.Equal(t, http.StatusOK, confirmed.StatusCode)
+	assert.Equal(t, "radiologist-msk", getNotificationByID(t, store, msk.NotificationID).ConfirmedBy)
+	assert.Equal(t, int64(-1), getNotificationByID(t, store, nr.NotificationID).ConfirmedAt)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAuthenticationShouldProtectTheAPI(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+
+	apiRequest := func(method string, path string, body string, username string, password string) (*http.Response, string) {
+		request, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		request.Header.Set(HTMLHeaderContentType, APIContentTypeValue)
+		if username != "" {
+			request.SetBasicAuth(username, password)
+		}
+
+		response := getResponse(t, request)
+		defer response.Body.Close()
+
+		var apiError apiError
+		json.NewDecoder(response.Body).Decode(&apiError)
+		return response, apiError.Error.Message
+	}
+
+	// when
+	anonymous, _ := apiRequest("GET", "/api/v1/notifications", "", "", "")
+	wrongPassword, _ := apiRequest("GET", "/api/v1/notifications", "", "mtra-ct", "wrong")
+	list, _ := apiRequest("GET", "/api/v1/notifications", "", "mtra-ct", testPassword)
+	otherModality, message := apiRequest("POST", "/api/v1/notifications", `{"department": "msk", "modality": "mr", "priority": 1}`, "mtra-ct", testPassword)
+	created, _ := apiRequest("POST", "/api/v1/notifications", `{"department": "msk", "modality": "ct", "priority": 1}`, "mtra-ct", testPassword)
+	notification, _ := store.NotificationGetOpenNotificationByDepartmentAndModality("msk", "ct")
+	confirm, _ := apiRequest("POST", "/api/v1/notifications/"+notification.NotificationID+"/confirm", "", "mtra-ct", testPassword)
+
+	lights := doRequest(t, http.DefaultClient, "GET", server.URL+"/nce-rest/arduino-status/msk-status")
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, anonymous.StatusCode)
+	assert.Equal(t, APIContentTypeValue, anonymous.Header.Get(HTMLHeaderContentType))
+	assert.Equal(t, `Basic realm="light-messenger"`, anonymous.Header.Get("www-authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, wrongPassword.StatusCode)
+	assert.Equal(t, http.StatusOK, list.StatusCode)
+	assert.Equal(t, http.StatusForbidden, otherModality.StatusCode)
+	assert.Contains(t, message, "modality mr")
+	assert.Equal(t, http.StatusCreated, created.StatusCode)
+	assert.Equal(t, http.StatusForbidden, confirm.StatusCode)
+	assert.Equal(t, http.StatusOK, lights.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationAuthenticationShouldRestrictWebSocketCommands(t *testing.T) {
+
+	// given
+	server, store := setupTestWithAuthentication(t)
+
+	notificationID, _ := store.NotificationInsert("msk", 1, "ct", 1000)
+
+	header := http.Header{}
+	header.Set("authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("radiologist-msk:"+testPassword)))
+	connection, _, errDial := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+APIPrefix+"/websocket", header)
+	if errDial != nil {
+		t.Fatalf("%+v", errors.WithStack(errDial))
+	}
+	defer connection.Close()
+
+	// when
+	cancel := sendWebSocketCommand(t, connection, `{"type": "cancel", "id": "1", "notificationId": "`+notificationID+`"}`)
+	confirm := sendWebSocketCommand(t, connection, `{"type": "confirm", "id": "2", "notificationId": "`+notificationID+`"}`)
+
+	// then
+	assert.Equal(t, wsMessageError, cancel.Type)
+	assert.Equal(t, http.StatusForbidden, cancel.Error.Status)
+	assert.Equal(t, wsMessageResult, confirm.Type)
+	assert.Equal(t, "radiologist-msk", confirm.Notification.ConfirmedBy)
+
+	tearDownTest(t, server, store)
+}
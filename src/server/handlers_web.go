@@ -1,16 +1,22 @@
 package server
 
 import (
-	"database/sql"
+	"bytes"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/export"
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+	"github.com/usb-radiology/light-messenger/src/statistics"
 	"github.com/usb-radiology/light-messenger/src/version"
 )
 
@@ -18,11 +24,18 @@ import (
 // index
 //
 
-func mainHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+func mainHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	token, errToken := csrfToken(config, w, r)
+	if errToken != nil {
+		return errToken
+	}
 
 	data := map[string]interface{}{
 		"Version":   version.Version,
 		"BuildTime": version.BuildTime,
+		"User":      requestUser(r),
+		"CSRFToken": token,
 	}
 
 	return renderTemplate(w, r, templates[templateIndexID], data)
@@ -32,37 +45,37 @@ func mainHandler(config *configuration.Configuration, db *sql.DB, w http.Respons
 // MTRA
 //
 
-func visierungHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+func visierungHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	modality := vars["modality"]
 
-	processedNotifications, errNotificationGetByModality := lmdatabase.NotificationGetProcessedNotificationsByModality(db, modality)
+	processedNotifications, errNotificationGetByModality := store.NotificationGetProcessedNotificationsByModality(modality)
 	if errNotificationGetByModality != nil {
 		return errNotificationGetByModality
 	}
 
-	aodCardHTML, errAodCardHTML := getCardHTML(db, modality, "aod")
+	aodCardHTML, errAodCardHTML := getCardHTML(store, modality, "aod")
 	if errAodCardHTML != nil {
 		return errAodCardHTML
 	}
 
-	ctdCardHTML, errCtdCardHTML := getCardHTML(db, modality, "ctd")
+	ctdCardHTML, errCtdCardHTML := getCardHTML(store, modality, "ctd")
 	if errCtdCardHTML != nil {
 		return errCtdCardHTML
 	}
 
-	mskCardHTML, errMskCardHTML := getCardHTML(db, modality, "msk")
+	mskCardHTML, errMskCardHTML := getCardHTML(store, modality, "msk")
 	if errMskCardHTML != nil {
 		return errMskCardHTML
 	}
 
-	nrCardHTML, errNrCardHTML := getCardHTML(db, modality, "nr")
+	nrCardHTML, errNrCardHTML := getCardHTML(store, modality, "nr")
 	if errNrCardHTML != nil {
 		return errNrCardHTML
 	}
 
-	nukCardHTML, errNukCardHTML := getCardHTML(db, modality, "nuk")
+	nukCardHTML, errNukCardHTML := getCardHTML(store, modality, "nuk")
 	if errNukCardHTML != nil {
 		return errNukCardHTML
 	}
@@ -83,6 +96,12 @@ func visierungHandler(config *configuration.Configuration, db *sql.DB, w http.Re
 		return writeJSON(w, data)
 	}
 
+	token, errToken := csrfToken(config, w, r)
+	if errToken != nil {
+		return errToken
+	}
+	data["CSRFToken"] = token
+
 	return renderTemplate(w, r, templates[templateVisierungID], data)
 }
 
@@ -90,17 +109,24 @@ func visierungHandler(config *configuration.Configuration, db *sql.DB, w http.Re
 // Radiology
 //
 
-func radiologieHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+func radiologieHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	department := vars["department"]
 
-	arduinoStatus, errStatusQuery := lmdatabase.ArduinoStatusQueryWithin5MinutesFromNow(db, department, time.Now().Unix())
+	now := time.Now().Unix()
+
+	arduinoStatus, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(department, now)
 	if errStatusQuery != nil {
 		return errStatusQuery
 	}
 
-	notificationsHTML, errNotificationsHTML := getNotificationsHTML(db, department)
+	devices, errDevices := getDeviceViews(store, department, now)
+	if errDevices != nil {
+		return errDevices
+	}
+
+	notificationsHTML, errNotificationsHTML := getNotificationsHTML(store, department)
 	if errNotificationsHTML != nil {
 		return errNotificationsHTML
 	}
@@ -111,12 +137,19 @@ func radiologieHandler(config *configuration.Configuration, db *sql.DB, w http.R
 		"Version":       version.Version,
 		"BuildTime":     version.BuildTime,
 		"ArduinoStatus": arduinoStatus,
+		"Devices":       devices,
 	}
 
 	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
 		return writeJSON(w, data)
 	}
 
+	token, errToken := csrfToken(config, w, r)
+	if errToken != nil {
+		return errToken
+	}
+	data["CSRFToken"] = token
+
 	return renderTemplate(w, r, templates[templateRadiologieID], data)
 }
 
@@ -124,7 +157,7 @@ func radiologieHandler(config *configuration.Configuration, db *sql.DB, w http.R
 // Notifications
 //
 
-func notificationCreateHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+func notificationCreateHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	modality := vars["modality"]
@@ -137,33 +170,34 @@ func notificationCreateHandler(config *configuration.Configuration, db *sql.DB,
 		return errors.WithStack(errPriorityConversion)
 	}
 
-	notification, errNotificationGetByDepartmentAndModality := lmdatabase.NotificationGetOpenNotificationByDepartmentAndModality(db, department, modality)
-	if errNotificationGetByDepartmentAndModality != nil {
-		return errNotificationGetByDepartmentAndModality
+	details, validDetails := notificationDetailsFromRequest(r)
+	if !validDetails {
+		writeBadRequest(w)
+		return nil
 	}
 
 	now := time.Now().Unix()
 
-	if notification.NotificationID == "" {
-		errNotificationInsert := lmdatabase.NotificationInsert(db, department, priorityNumber, modality, now)
-		if errNotificationInsert != nil {
-			return errNotificationInsert
-		}
-
-	} else {
-
-		errNotificationUpdatePriority := lmdatabase.NotificationUpdatePriority(db, notification.NotificationID, priorityNumber)
-		if errNotificationUpdatePriority != nil {
-			return errNotificationUpdatePriority
-		}
+	event, errNotificationCreateOrEscalate := store.NotificationCreateOrEscalate(department, priorityNumber, modality, details, now, clientAddress(r))
+	if errNotificationCreateOrEscalate != nil {
+		return errNotificationCreateOrEscalate
+	}
 
+	notification, errNotificationGetByID := store.NotificationGetByID(event.NotificationID)
+	if errNotificationGetByID != nil {
+		return errNotificationGetByID
 	}
 
-	arduinoStatus, errStatusQuery := lmdatabase.ArduinoStatusQueryWithin5MinutesFromNow(db, department, now)
+	arduinoStatus, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(department, now)
 	if errStatusQuery != nil {
 		return errStatusQuery
 	}
 
+	devices, errDevices := getDeviceViews(store, department, now)
+	if errDevices != nil {
+		return errDevices
+	}
+
 	data := map[string]interface{}{
 		"Modality":       modality,
 		"Department":     department,
@@ -171,7 +205,9 @@ func notificationCreateHandler(config *configuration.Configuration, db *sql.DB,
 		"PriorityName":   priorityMap[priorityNumber],
 		"PriorityNumber": priorityNumber,
 		"ArduinoStatus":  arduinoStatus,
+		"Devices":        devices,
 		"CreatedAt":      time.Unix(now, 0).Format("15:04:05"),
+		"Details":        notification.NotificationDetails,
 	}
 
 	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
@@ -181,7 +217,26 @@ func notificationCreateHandler(config *configuration.Configuration, db *sql.DB,
 	return renderTemplateName(w, r, templates[templateCardID], "card_view", data)
 }
 
-func notificationCancelHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+// notificationDetailsFromRequest reads the optional details of a notification from the form or query parameters,
+// it reports false if a value does not fit into its column
+func notificationDetailsFromRequest(r *http.Request) (lmdatabase.NotificationDetails, bool) {
+	details := lmdatabase.NotificationDetails{
+		Message:         strings.TrimSpace(r.FormValue("message")),
+		Room:            strings.TrimSpace(r.FormValue("room")),
+		AccessionNumber: strings.TrimSpace(r.FormValue("accessionNumber")),
+	}
+
+	return details, validNotificationDetails(details)
+}
+
+// validNotificationDetails reports whether the details fit into their columns
+func validNotificationDetails(details lmdatabase.NotificationDetails) bool {
+	return utf8.RuneCountInString(details.Message) <= 1024 &&
+		utf8.RuneCountInString(details.Room) <= 255 &&
+		utf8.RuneCountInString(details.AccessionNumber) <= 64
+}
+
+func notificationCancelHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	modality := vars["modality"]
@@ -191,11 +246,12 @@ func notificationCancelHandler(config *configuration.Configuration, db *sql.DB,
 		"Modality":       modality,
 		"Department":     department,
 		"PriorityNumber": 99, // needed because of le comparison in template
+		"Details":        lmdatabase.NotificationDetails{},
 	}
 
-	errNotificationCancel := lmdatabase.NotificationCancel(db, modality, department, time.Now().Unix())
-	if errNotificationCancel != nil {
-		return errNotificationCancel
+	_, errCancelNotification := cancelNotification(store, modality, department, time.Now().Unix(), r)
+	if errCancelNotification != nil {
+		return errCancelNotification
 	}
 
 	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
@@ -205,20 +261,386 @@ func notificationCancelHandler(config *configuration.Configuration, db *sql.DB,
 	return renderTemplateName(w, r, templates[templateCardID], "card_view", data)
 }
 
-func notificationConfirmHandler(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error {
+func notificationConfirmHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
 	w.Header().Set("X-IC-Remove", "true")
 
 	vars := mux.Vars(r)
 	notificationID := vars["id"]
 
-	rowsAffected, errNotificationConfirm := lmdatabase.NotificationConfirm(db, notificationID, time.Now().Unix())
-	if errNotificationConfirm != nil {
-		return errNotificationConfirm
+	_, errConfirmNotification := confirmOpenNotification(store, notificationID, time.Now().Unix(), r)
+	if errConfirmNotification != nil {
+		// unknown notifications and notifications that were confirmed or cancelled already
+		if notificationErrorStatus(errConfirmNotification) != 0 {
+			writeBadRequest(w)
+			return nil
+		}
+		return errConfirmNotification
 	}
 
-	if rowsAffected == 0 {
+	return nil
+}
+
+func notificationForwardHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	vars := mux.Vars(r)
+	notificationID := vars["id"]
+	department := vars["department"]
+
+	if !isDepartment(department) {
 		writeBadRequest(w)
+		return nil
 	}
 
-	return nil
+	event, errNotificationForward := store.NotificationForward(notificationID, department, time.Now().Unix(), clientAddress(r))
+	if errNotificationForward != nil {
+		cause := errors.Cause(errNotificationForward)
+		if cause == lmdatabase.ErrNotificationNotOpen || cause == lmdatabase.ErrNotificationOpenInDepartment ||
+			cause == lmdatabase.ErrNotificationInDepartment {
+			writeConflict(w)
+			return nil
+		}
+		return errNotificationForward
+	}
+
+	if event == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
+		return writeJSON(w, map[string]interface{}{
+			"NotificationID": notificationID,
+			"From":           event.PreviousValue,
+			"To":             event.NewValue,
+		})
+	}
+
+	// the radiologist page of the previous department shows its remaining notifications
+	notificationsHTML, errNotificationsHTML := getNotificationsHTML(store, event.PreviousValue)
+	if errNotificationsHTML != nil {
+		return errNotificationsHTML
+	}
+
+	w.Header().Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueHTML)
+	return writeBytes(w, []byte(notificationsHTML))
+}
+
+func isDepartment(department string) bool {
+	for _, known := range departments {
+		if known == department {
+			return true
+		}
+	}
+	return false
+}
+
+func isModality(modality string) bool {
+	for _, known := range modalities {
+		if known == modality {
+			return true
+		}
+	}
+	return false
+}
+
+func notificationEventsHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	vars := mux.Vars(r)
+	notificationID := vars["id"]
+
+	notification, errNotificationGetByID := store.NotificationGetByID(notificationID)
+	if errNotificationGetByID != nil {
+		return errNotificationGetByID
+	}
+
+	if notification == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	events, errEventGetByNotificationID := store.NotificationEventGetByNotificationID(notificationID)
+	if errEventGetByNotificationID != nil {
+		return errEventGetByNotificationID
+	}
+
+	data := map[string]interface{}{
+		"Notification": notification,
+		"Events":       events,
+	}
+
+	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
+		return writeJSON(w, data)
+	}
+
+	return renderTemplate(w, r, templates[templateEventsID], data)
+}
+
+//
+// Uptime
+//
+
+// deviceUptimeView is a registered device together with its uptime over the reported period
+type deviceUptimeView struct {
+	lmdatabase.Device
+	lmdatabase.DeviceUptime
+}
+
+func uptimeHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	vars := mux.Vars(r)
+	department := vars["department"]
+
+	from, to, validPeriod := periodFromRequest(r, time.Now(), 7)
+	if !validPeriod {
+		writeBadRequest(w)
+		return nil
+	}
+
+	devices, errDeviceGetByDepartment := store.DeviceGetByDepartment(department)
+	if errDeviceGetByDepartment != nil {
+		return errDeviceGetByDepartment
+	}
+
+	intervals, errUptimeGetByDepartment := store.DeviceUptimeGetByDepartment(department, from.Unix(), to.Unix())
+	if errUptimeGetByDepartment != nil {
+		return errUptimeGetByDepartment
+	}
+
+	intervalsByDevice := make(map[string][]lmdatabase.DeviceUptimeInterval)
+	for _, interval := range *intervals {
+		intervalsByDevice[interval.DeviceID] = append(intervalsByDevice[interval.DeviceID], interval)
+	}
+
+	deviceUptimes := make([]deviceUptimeView, 0, len(*devices))
+	for _, device := range *devices {
+		deviceUptimes = append(deviceUptimes, deviceUptimeView{
+			Device:       device,
+			DeviceUptime: lmdatabase.DeviceUptimeFromIntervals(intervalsByDevice[device.DeviceID], from.Unix(), to.Unix()),
+		})
+	}
+
+	data := map[string]interface{}{
+		"Department": department,
+		"From":       from.Format("2006-01-02"),
+		"To":         to.Add(-time.Second).Format("2006-01-02"),
+		"Uptime":     lmdatabase.DeviceUptimeFromIntervals(*intervals, from.Unix(), to.Unix()),
+		"Devices":    deviceUptimes,
+		"Version":    version.Version,
+		"BuildTime":  version.BuildTime,
+	}
+
+	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
+		return writeJSON(w, data)
+	}
+
+	return renderTemplate(w, r, templates[templateUptimeID], data)
+}
+
+// periodFromRequest reads the reported period from the from and to dates of the query, see export.ParsePeriod, it
+// reports false for invalid dates or an empty period
+func periodFromRequest(r *http.Request, now time.Time, days int) (time.Time, time.Time, bool) {
+	from, to, errParsePeriod := export.ParsePeriod(r.FormValue("from"), r.FormValue("to"), now, days)
+	return from, to, errParsePeriod == nil
+}
+
+//
+// Statistics
+//
+
+func statisticsHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	now := time.Now()
+
+	from, to, validPeriod := periodFromRequest(r, now, 30)
+	if !validPeriod {
+		writeBadRequest(w)
+		return nil
+	}
+
+	groupByValue := strings.Join([]string{statistics.GroupByDepartment, statistics.GroupByPriority}, ",")
+	if values, exists := r.URL.Query()["groupBy"]; exists {
+		groupByValue = strings.Join(values, ",")
+	}
+
+	groupBy, errParseGroupBy := statistics.ParseGroupBy(groupByValue)
+	if errParseGroupBy != nil {
+		writeBadRequest(w)
+		return nil
+	}
+
+	notifications, errNotificationGetByCreatedAt := store.NotificationGetByCreatedAt(from.Unix(), to.Unix())
+	if errNotificationGetByCreatedAt != nil {
+		return errNotificationGetByCreatedAt
+	}
+
+	grouped := make(map[string]bool)
+	for _, dimension := range groupBy {
+		grouped[dimension] = true
+	}
+
+	data := map[string]interface{}{
+		"From":       from.Format("2006-01-02"),
+		"To":         to.Add(-time.Second).Format("2006-01-02"),
+		"GroupBy":    groupBy,
+		"Grouped":    grouped,
+		"Dimensions": statistics.Dimensions,
+		"Total":      statistics.Compute(*notifications, []string{}, now.Location())[0],
+		"Groups":     statistics.Compute(*notifications, groupBy, now.Location()),
+		"Version":    version.Version,
+		"BuildTime":  version.BuildTime,
+	}
+
+	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
+		return writeJSON(w, data)
+	}
+
+	return renderTemplate(w, r, templates[templateStatisticsID], data)
+}
+
+//
+// Export
+//
+
+func exportHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	contentType, knownFormat := export.ContentTypes[format]
+	if !knownFormat {
+		writeBadRequest(w)
+		return nil
+	}
+
+	from, to, validPeriod := periodFromRequest(r, time.Now(), 30)
+	if !validPeriod {
+		writeBadRequest(w)
+		return nil
+	}
+
+	notifications, errNotificationGetByCreatedAt := store.NotificationGetByCreatedAt(from.Unix(), to.Unix())
+	if errNotificationGetByCreatedAt != nil {
+		return errNotificationGetByCreatedAt
+	}
+
+	filtered := export.Filter(*notifications, r.FormValue("department"), r.FormValue("modality"))
+
+	var buffer bytes.Buffer
+	errWrite := export.Write(&buffer, format, filtered, time.Local)
+	if errWrite != nil {
+		return errWrite
+	}
+
+	fileName := fmt.Sprintf("visierungen-%s-%s.%s", from.Format("2006-01-02"), to.Add(-time.Second).Format("2006-01-02"), format)
+
+	w.Header().Set(HTMLHeaderContentType, contentType)
+	w.Header().Set("content-disposition", "attachment; filename=\""+fileName+"\"")
+
+	return writeBytes(w, buffer.Bytes())
+}
+
+//
+// History
+//
+
+// historyPageSize is the number of notifications on a page of the history
+const historyPageSize = 50
+
+func historyHandler(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error {
+
+	from, to, validPeriod := periodFromRequest(r, time.Now(), 30)
+	if !validPeriod {
+		writeBadRequest(w)
+		return nil
+	}
+
+	query, validQuery := historyQueryFromRequest(r)
+	if !validQuery {
+		writeBadRequest(w)
+		return nil
+	}
+	query.From = from.Unix()
+	query.To = to.Unix()
+
+	page := 1
+	if value := r.FormValue("page"); value != "" {
+		number, errConversion := strconv.Atoi(value)
+		if errConversion != nil || number < 1 {
+			writeBadRequest(w)
+			return nil
+		}
+		page = number
+	}
+	query.Limit = historyPageSize
+	query.Offset = (page - 1) * historyPageSize
+
+	notifications, total, errNotificationGetHistory := store.NotificationGetHistory(query)
+	if errNotificationGetHistory != nil {
+		return errNotificationGetHistory
+	}
+
+	pages := (total + historyPageSize - 1) / historyPageSize
+
+	// the page links keep the filters of the request
+	pageURL := func(number int) string {
+		if number < 1 || number > pages {
+			return ""
+		}
+		values := url.Values{}
+		for key, value := range r.URL.Query() {
+			values[key] = value
+		}
+		values.Set("page", strconv.Itoa(number))
+		return "/history?" + values.Encode()
+	}
+
+	data := map[string]interface{}{
+		"Modality":      query.Modality,
+		"Department":    query.Department,
+		"Priority":      query.Priority,
+		"Outcome":       query.Outcome,
+		"From":          from.Format("2006-01-02"),
+		"To":            to.Add(-time.Second).Format("2006-01-02"),
+		"Notifications": notifications,
+		"Total":         total,
+		"Page":          page,
+		"Pages":         pages,
+		"PreviousPage":  pageURL(page - 1),
+		"NextPage":      pageURL(page + 1),
+		"Modalities":    modalities,
+		"Departments":   departments,
+		"Version":       version.Version,
+		"BuildTime":     version.BuildTime,
+	}
+
+	if r.Header.Get(HTMLHeaderContentType) == HTMLHeaderContentTypeValueJSON {
+		return writeJSON(w, data)
+	}
+
+	return renderTemplate(w, r, templates[templateHistoryID], data)
+}
+
+// historyQueryFromRequest reads the filters of the history from the query, it reports false for unknown values
+func historyQueryFromRequest(r *http.Request) (lmdatabase.NotificationHistoryQuery, bool) {
+	query := lmdatabase.NotificationHistoryQuery{
+		Modality:   r.FormValue("modality"),
+		Department: r.FormValue("department"),
+		Outcome:    r.FormValue("outcome"),
+	}
+
+	if value := r.FormValue("priority"); value != "" {
+		priority, errConversion := strconv.Atoi(value)
+		if errConversion != nil || priorityNameMap[priority] == "" {
+			return query, false
+		}
+		query.Priority = priority
+	}
+
+	switch query.Outcome {
+	case "", lmdatabase.NotificationOutcomeConfirmed, lmdatabase.NotificationOutcomeCancelled:
+		return query, true
+	}
+	return query, false
 }
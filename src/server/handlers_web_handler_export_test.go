@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tealeg/xlsx"
+)
+
+func getResponseBody(t *testing.T, response *http.Response) []byte {
+	defer response.Body.Close()
+
+	body, errReadResponse := ioutil.ReadAll(response.Body)
+	if errReadResponse != nil {
+		t.Fatalf("%+v", errors.WithStack(errReadResponse))
+	}
+	return body
+}
+
+func TestIntegrationExportShouldReturnCSVFilteredByDepartmentAndModality(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+60, 30)
+	testNotificationConfirmAfter(t, store, "msk", 2, "mr", dayStart+120, 60)
+	testNotificationConfirmAfter(t, store, "nr", 1, "ct", dayStart+180, 90)
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+86400, 10) // next day
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/export?from=2020-01-01&to=2020-01-01&department=msk&modality=ct", nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", response.Header.Get("content-type"))
+	assert.Equal(t, `attachment; filename="visierungen-2020-01-01-2020-01-01.csv"`, response.Header.Get("content-disposition"))
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(getResponseBody(t, response), []byte("\xef\xbb\xbf"))))
+	reader.Comma = ';'
+	records, errRead := reader.ReadAll()
+	if errRead != nil {
+		t.Fatalf("%+v", errors.WithStack(errRead))
+	}
+
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "msk", records[1][1])
+	assert.Equal(t, "ct", records[1][2])
+	assert.Equal(t, time.Unix(dayStart+60, 0).Format("2006-01-02 15:04:05"), records[1][5])
+	assert.Equal(t, "30", records[1][10])
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationExportShouldReturnXLSX(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+60, 30)
+	testNotificationInsert(t, store, "nr", 3, "mr", dayStart+120)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/export?format=xlsx&from=2020-01-01&to=2020-01-01", nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", response.Header.Get("content-type"))
+
+	file, errOpen := xlsx.OpenBinary(getResponseBody(t, response))
+	if errOpen != nil {
+		t.Fatalf("%+v", errors.WithStack(errOpen))
+	}
+
+	rows := file.Sheets[0].Rows
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, "Bestätigt", rows[1].Cells[4].String())
+	assert.Equal(t, "Offen", rows[2].Cells[4].String())
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationExportShouldReturnHTTP400ForUnknownFormatOrInvalidPeriod(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/export?format=pdf", nil)
+	responseUnknownFormat := getResponse(t, request)
+
+	request, _ = http.NewRequest("GET", server.URL+"/export?from=2020-13-01", nil)
+	responseInvalidPeriod := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, responseUnknownFormat.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, responseInvalidPeriod.StatusCode)
+
+	tearDownTest(t, server, store)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationHistoryShouldReturnJSONPageOfProcessedNotifications(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	for i := int64(0); i < historyPageSize+2; i++ {
+		testNotificationConfirmAfter(t, store, "msk", 2, "ct", dayStart+i*60, 30)
+	}
+	testNotificationInsert(t, store, "nr", 1, "ct", dayStart) // open
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/history?from=2020-01-01&to=2020-01-01&modality=ct&page=2", nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	assert.Equal(t, float64(historyPageSize+2), responseBodyStrings["Total"])
+	assert.Equal(t, float64(2), responseBodyStrings["Page"])
+	assert.Equal(t, float64(2), responseBodyStrings["Pages"])
+	assert.Equal(t, "", responseBodyStrings["NextPage"])
+
+	previousPage, errParse := url.Parse(responseBodyStrings["PreviousPage"].(string))
+	if errParse != nil {
+		t.Fatalf("%+v", errors.WithStack(errParse))
+	}
+	assert.Equal(t, "/history", previousPage.Path)
+	assert.Equal(t, "1", previousPage.Query().Get("page"))
+	assert.Equal(t, "ct", previousPage.Query().Get("modality"))
+
+	notifications := responseBodyStrings["Notifications"].([]interface{})
+	assert.Equal(t, 2, len(notifications))
+	oldest := notifications[1].(map[string]interface{})
+	assert.Equal(t, float64(dayStart), oldest["CreatedAt"])
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationHistoryShouldReturnHTMLFilteredByDepartmentPriorityAndOutcome(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart, 30)
+	testNotificationConfirmAfter(t, store, "msk", 2, "ct", dayStart+60, 30)
+	testNotificationConfirmAfter(t, store, "nr", 1, "ct", dayStart+120, 30)
+	testNotificationInsert(t, store, "msk", 1, "mr", dayStart+180)
+	_, errCancel := store.NotificationCancel("mr", "msk", dayStart+190, "ws-2", "")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/history?from=2020-01-01&to=2020-01-01&department=msk&priority=1&outcome=cancelled", nil)
+
+	// then
+	doc := getResponseHTMLDoc(t, request)
+
+	rows := doc.Find("table.history tbody tr.notification")
+	assert.Equal(t, 1, rows.Length())
+	cells := rows.First().Find("td")
+	assert.Equal(t, "mr", cells.Eq(1).Text())
+	assert.Equal(t, "ws-2", cells.Eq(6).Text())
+
+	_, departmentSelected := doc.Find("select[name=department] option[value=msk]").Attr("selected")
+	assert.True(t, departmentSelected)
+	_, outcomeSelected := doc.Find("select[name=outcome] option[value=cancelled]").Attr("selected")
+	assert.True(t, outcomeSelected)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationHistoryShouldReturnHTTP400ForInvalidFilters(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	for _, query := range []string{"priority=4", "priority=high", "outcome=open", "page=0", "from=yesterday"} {
+		// when
+		request, _ := http.NewRequest("GET", server.URL+"/history?"+query, nil)
+		response := getResponse(t, request)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+
+	tearDownTest(t, server, store)
+}
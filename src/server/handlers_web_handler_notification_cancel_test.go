@@ -6,12 +6,13 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
 func TestIntegrationNotificationCancelShouldReturnJSON(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department  = "abc"
@@ -22,10 +23,10 @@ func TestIntegrationNotificationCancelShouldReturnJSON(t *testing.T) {
 		// priorityNumber float64 = 3
 	)
 
-	testNotificationInsert(t, db, department, priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, department, priorityInt, modality, now.Unix())
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -33,13 +34,13 @@ func TestIntegrationNotificationCancelShouldReturnJSON(t *testing.T) {
 	assert.Equal(t, department, responseBodyStrings["Department"].(string))
 	assert.Equal(t, modality, responseBodyStrings["Modality"].(string))
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCancelShouldReturnHTML(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department  = "abc"
@@ -50,23 +51,23 @@ func TestIntegrationNotificationCancelShouldReturnHTML(t *testing.T) {
 		// priorityNumber float64 = 3
 	)
 
-	testNotificationInsert(t, db, department, priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, department, priorityInt, modality, now.Unix())
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
 
 	// then
 	doc := getResponseHTMLDoc(t, request)
 
 	assertNotificationHTMLNoPriority(t, doc, modality, department)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCancelShouldReturnJSONWhenNoNotificationToCancel(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department = "abc"
@@ -77,10 +78,10 @@ func TestIntegrationNotificationCancelShouldReturnJSONWhenNoNotificationToCancel
 		// priorityNumber float64 = 3
 	)
 
-	// testNotificationInsert(t, db, department, priorityInt, modality, now.Unix())
+	// testNotificationInsert(t, store, department, priorityInt, modality, now.Unix())
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -89,5 +90,68 @@ func TestIntegrationNotificationCancelShouldReturnJSONWhenNoNotificationToCancel
 	assert.Equal(t, department, responseBodyStrings["Department"].(string))
 	assert.Equal(t, modality, responseBodyStrings["Modality"].(string))
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationCancelShouldRecordWorkstation(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+		now        = time.Now()
+	)
+
+	testNotificationInsert(t, store, department, 1, modality, now.Unix())
+	notification := getNotification(t, store, department, modality)
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel", nil)
+	request.Header.Set(HTMLHeaderWorkstation, "mtra-ct-1")
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	cancelled := getNotificationByID(t, store, notification.NotificationID)
+	assert.Equal(t, "mtra-ct-1", cancelled.CancelledBy)
+	assert.Empty(t, cancelled.ConfirmedBy)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationCancelShouldNotRecordEventWhenConfirmedAlready(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+		now        = time.Now()
+	)
+
+	testNotificationInsert(t, store, department, 1, modality, now.Unix())
+	notification := getNotification(t, store, department, modality)
+	testRequest(t, "DELETE", server.URL+"/notification/"+department+"/"+notification.NotificationID)
+
+	// when
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel")
+
+	// then
+	processed := getNotificationByID(t, store, notification.NotificationID)
+	assert.Equal(t, int64(-1), processed.CancelledAt)
+	assert.NotEqual(t, int64(-1), processed.ConfirmedAt)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errEvents)
+	}
+	for _, event := range *events {
+		assert.NotEqual(t, lmdatabase.NotificationEventCancelled, event.EventType)
+	}
+
+	tearDownTest(t, server, store)
 }
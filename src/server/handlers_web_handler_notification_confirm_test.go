@@ -1,7 +1,6 @@
 package server
 
 import (
-	"database/sql"
 	"net/http"
 	"testing"
 	"time"
@@ -14,7 +13,7 @@ import (
 func TestIntegrationNotificationConfirmShouldReturnHTTP200WhenNotificationExists(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department  = "abc"
@@ -25,28 +24,28 @@ func TestIntegrationNotificationConfirmShouldReturnHTTP200WhenNotificationExists
 		// priorityNumber float64 = 3
 	)
 
-	testNotificationInsert(t, db, department, priorityInt, modality, now.Unix())
-	insertedNotification := getNotification(t, db, department, modality)
+	testNotificationInsert(t, store, department, priorityInt, modality, now.Unix())
+	insertedNotification := getNotification(t, store, department, modality)
 	assert.NotNil(t, insertedNotification)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/notification/"+department+"/"+insertedNotification.NotificationID, nil)
+	request := newCSRFRequest("DELETE", server.URL+"/notification/"+department+"/"+insertedNotification.NotificationID, nil)
 
 	// then
 	response := getResponse(t, request)
 
 	assert.Equal(t, http.StatusOK, response.StatusCode)
-	notification := getNotificationByID(t, db, insertedNotification.NotificationID)
+	notification := getNotificationByID(t, store, insertedNotification.NotificationID)
 	assert.NotNil(t, notification)
 	assert.LessOrEqual(t, now.Unix(), notification.ConfirmedAt)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationConfirmShouldReturnHTTP200WhenNoNotificationExists(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department = "abc"
@@ -57,32 +56,106 @@ func TestIntegrationNotificationConfirmShouldReturnHTTP200WhenNoNotificationExis
 		// priorityNumber float64 = 3
 	)
 
-	// testNotificationInsert(t, db, department, priorityInt, modality, now.Unix())
-	// insertedNotification := getNotification(t, db, department, modality)
+	// testNotificationInsert(t, store, department, priorityInt, modality, now.Unix())
+	// insertedNotification := getNotification(t, store, department, modality)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/notification/"+department+"/xxx", nil)
+	request := newCSRFRequest("DELETE", server.URL+"/notification/"+department+"/xxx", nil)
 
 	// then
 	response := getResponse(t, request)
 
 	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
-func getNotification(t *testing.T, db *sql.DB, department string, modality string) *lmdatabase.Notification {
-	notification, err := lmdatabase.NotificationGetOpenNotificationByDepartmentAndModality(db, department, modality)
+func TestIntegrationNotificationConfirmShouldReturnHTTP400AndKeepConfirmationWhenConfirmedAlready(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	now := time.Now()
+
+	testNotificationInsert(t, store, "abc", 1, "x", now.Unix())
+	insertedNotification := getNotification(t, store, "abc", "x")
+
+	request := newCSRFRequest("DELETE", server.URL+"/notification/abc/"+insertedNotification.NotificationID, nil)
+	request.Header.Set(HTMLHeaderWorkstation, "radiologie-aod-1")
+	response := getResponse(t, request)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// when
+	request = newCSRFRequest("DELETE", server.URL+"/notification/abc/"+insertedNotification.NotificationID, nil)
+	request.Header.Set(HTMLHeaderWorkstation, "radiologie-aod-2")
+	response = getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Equal(t, "radiologie-aod-1", getNotificationByID(t, store, insertedNotification.NotificationID).ConfirmedBy)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(insertedNotification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	confirmedEvents := 0
+	for _, event := range *events {
+		if event.EventType == lmdatabase.NotificationEventConfirmed {
+			confirmedEvents++
+		}
+	}
+	assert.Equal(t, 1, confirmedEvents)
+
+	tearDownTest(t, server, store)
+}
+
+func getNotification(t *testing.T, store lmdatabase.Store, department string, modality string) *lmdatabase.Notification {
+	notification, err := store.NotificationGetOpenNotificationByDepartmentAndModality(department, modality)
 	if err != nil {
 		t.Fatalf("%+v", errors.WithStack(err))
 	}
 	return notification
 }
 
-func getNotificationByID(t *testing.T, db *sql.DB, notificationID string) *lmdatabase.Notification {
-	notification, err := lmdatabase.NotificationGetByID(db, notificationID)
+func getNotificationByID(t *testing.T, store lmdatabase.Store, notificationID string) *lmdatabase.Notification {
+	notification, err := store.NotificationGetByID(notificationID)
 	if err != nil {
 		t.Fatalf("%+v", errors.WithStack(err))
 	}
 	return notification
 }
+
+func TestIntegrationNotificationConfirmShouldRecordWorkstationOrClientAddress(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		now = time.Now()
+	)
+
+	testNotificationInsert(t, store, "abc", 1, "x", now.Unix())
+	testNotificationInsert(t, store, "def", 1, "x", now.Unix())
+	withWorkstation := getNotification(t, store, "abc", "x")
+	withoutWorkstation := getNotification(t, store, "def", "x")
+
+	// when
+	request := newCSRFRequest("DELETE", server.URL+"/notification/abc/"+withWorkstation.NotificationID, nil)
+	request.Header.Set(HTMLHeaderWorkstation, "radiologie-aod-2")
+	response := getResponse(t, request)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	request = newCSRFRequest("DELETE", server.URL+"/notification/def/"+withoutWorkstation.NotificationID, nil)
+	response = getResponse(t, request)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// then
+	assert.Equal(t, "radiologie-aod-2", getNotificationByID(t, store, withWorkstation.NotificationID).ConfirmedBy)
+	assert.Equal(t, "127.0.0.1", getNotificationByID(t, store, withoutWorkstation.NotificationID).ConfirmedBy)
+
+	request, _ = http.NewRequest("GET", server.URL+"/mtra/x", nil)
+	doc := getResponseHTMLDoc(t, request)
+	assert.Contains(t, doc.Find("td.is-family-monospace").Text(), "radiologie-aod-2")
+
+	tearDownTest(t, server, store)
+}
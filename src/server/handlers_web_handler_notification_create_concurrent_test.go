@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func TestIntegrationNotificationCreateShouldNotCreateDuplicatesWhenCalledConcurrently(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	const concurrency = 20
+
+	var (
+		department = "abc"
+		modalities = []string{"x", "y"}
+	)
+
+	// when
+	var wg sync.WaitGroup
+	statusCodes := make(chan int, concurrency*len(modalities))
+	for i := 0; i < concurrency; i++ {
+		for _, modality := range modalities {
+			wg.Add(1)
+			go func(modality string, priority int) {
+				defer wg.Done()
+				request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+strconv.Itoa(priority), nil)
+				request.Header.Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueJSON)
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					statusCodes <- -1
+					return
+				}
+				response.Body.Close()
+				statusCodes <- response.StatusCode
+			}(modality, i%3+1)
+		}
+	}
+	wg.Wait()
+	close(statusCodes)
+
+	// then
+	for statusCode := range statusCodes {
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+
+	openNotifications, errQuery := store.NotificationGetOpenNotificationsByDepartment(department)
+	if errQuery != nil {
+		t.Fatalf("%+v", errors.WithStack(errQuery))
+	}
+	assert.Equal(t, len(modalities), len(*openNotifications))
+
+	for _, notification := range *openNotifications {
+		events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+		if errEvents != nil {
+			t.Fatalf("%+v", errors.WithStack(errEvents))
+		}
+		assert.Equal(t, concurrency, len(*events))
+		assert.Equal(t, lmdatabase.NotificationEventCreated, (*events)[0].EventType)
+	}
+
+	tearDownTest(t, server, store)
+}
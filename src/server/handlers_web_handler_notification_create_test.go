@@ -1,7 +1,6 @@
 package server
 
 import (
-	"net/http"
 	"testing"
 	"time"
 
@@ -11,7 +10,7 @@ import (
 func TestIntegrationNotificationCreateShouldReturnJSONForLowPriority(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department             = "abc"
@@ -22,7 +21,7 @@ func TestIntegrationNotificationCreateShouldReturnJSONForLowPriority(t *testing.
 	)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -35,13 +34,13 @@ func TestIntegrationNotificationCreateShouldReturnJSONForLowPriority(t *testing.
 	assert.Equal(t, "is-info", responseBodyStrings["PriorityName"])
 	assert.Equal(t, priorityNumber, responseBodyStrings["PriorityNumber"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCreateShouldReturnJSONForMediumPriority(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department             = "abc"
@@ -52,7 +51,7 @@ func TestIntegrationNotificationCreateShouldReturnJSONForMediumPriority(t *testi
 	)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -65,13 +64,13 @@ func TestIntegrationNotificationCreateShouldReturnJSONForMediumPriority(t *testi
 	assert.Equal(t, "is-warning", responseBodyStrings["PriorityName"])
 	assert.Equal(t, priorityNumber, responseBodyStrings["PriorityNumber"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCreateShouldReturnJSONForHighPriority(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department             = "abc"
@@ -82,7 +81,7 @@ func TestIntegrationNotificationCreateShouldReturnJSONForHighPriority(t *testing
 	)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -95,13 +94,13 @@ func TestIntegrationNotificationCreateShouldReturnJSONForHighPriority(t *testing
 	assert.Equal(t, "is-danger", responseBodyStrings["PriorityName"])
 	assert.Equal(t, priorityNumber, responseBodyStrings["PriorityNumber"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCreateShouldReturnJSONForHighPriorityAndArduinoStatus(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department             = "abc"
@@ -111,10 +110,10 @@ func TestIntegrationNotificationCreateShouldReturnJSONForHighPriorityAndArduinoS
 		now                    = time.Now()
 	)
 
-	arduinoStatus := testArduinoStatusInsert(t, db, department, now.Unix()-1)
+	arduinoStatus := testArduinoStatusInsert(t, store, department, now.Unix()-1)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
 
 	// then
 	responseBodyStrings := getResponseBodyStrings(t, request)
@@ -130,13 +129,13 @@ func TestIntegrationNotificationCreateShouldReturnJSONForHighPriorityAndArduinoS
 	assert.Equal(t, "is-danger", responseBodyStrings["PriorityName"])
 	assert.Equal(t, priorityNumber, responseBodyStrings["PriorityNumber"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationNotificationCreateShouldReturnHTMLForMediumPriority(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department = "abc"
@@ -146,7 +145,7 @@ func TestIntegrationNotificationCreateShouldReturnHTMLForMediumPriority(t *testi
 	)
 
 	// when
-	request, _ := http.NewRequest("GET", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/"+priority, nil)
 
 	// then
 	doc := getResponseHTMLDoc(t, request)
@@ -155,5 +154,5 @@ func TestIntegrationNotificationCreateShouldReturnHTMLForMediumPriority(t *testi
 
 	assertNotificationHTMLMediumPriority(t, doc, modality, department, now)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationNotificationCreateShouldStoreDetailsFromForm(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+		form       = url.Values{
+			"message":         {"Bitte Protokoll prüfen"},
+			"room":            {"CT 2"},
+			"accessionNumber": {"A12345"},
+		}
+	)
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/2", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	doc, errHTMLDoc := goquery.NewDocumentFromResponse(response)
+	if errHTMLDoc != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTMLDoc))
+	}
+	assert.Equal(t, "Bitte Protokoll prüfen", doc.Find("input[name=message]").AttrOr("value", ""))
+	assert.Equal(t, "CT 2", doc.Find("input[name=room]").AttrOr("value", ""))
+	assert.Equal(t, "A12345", doc.Find("input[name=accessionNumber]").AttrOr("value", ""))
+
+	notification := getNotification(t, store, department, modality)
+	assert.Equal(t, "Bitte Protokoll prüfen", notification.Message)
+	assert.Equal(t, "CT 2", notification.Room)
+	assert.Equal(t, "A12345", notification.AccessionNumber)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationCreateShouldKeepDetailsWhenEscalatingWithout(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+	)
+
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/3?"+url.Values{"message": {"Rückfrage"}, "room": {"MR1"}}.Encode())
+
+	// when
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/1?room=MR2")
+
+	// then
+	notification := getNotification(t, store, department, modality)
+	assert.Equal(t, 1, notification.Priority)
+	assert.Equal(t, "Rückfrage", notification.Message)
+	assert.Equal(t, "MR2", notification.Room)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationCreateShouldReturnHTTP400WhenDetailsAreTooLong(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/modality/x/department/abc/prio/1?accessionNumber="+strings.Repeat("1", 65), nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	notification := getNotification(t, store, "abc", "x")
+	assert.Empty(t, notification.NotificationID)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationRadiologieShouldShowEscapedNotificationDetails(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "aod"
+		form       = url.Values{
+			"message":         {"<b>Kontrastmittel</b> geben?"},
+			"room":            {"CT 1"},
+			"accessionNumber": {"A999"},
+		}
+	)
+
+	testRequest(t, "POST", server.URL+"/modality/x/department/"+department+"/prio/2?"+form.Encode())
+	testRequest(t, "POST", server.URL+"/modality/y/department/"+department+"/prio/3")
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/radiologie/"+department, nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	notificationsHTML := responseBodyStrings["Notifications"].(string)
+	assert.NotContains(t, notificationsHTML, "<b>")
+
+	doc := getDocument(t, notificationsHTML)
+
+	details := doc.Find("div.notification-details")
+	assert.Equal(t, 1, details.Length())
+	assert.Equal(t, "<b>Kontrastmittel</b> geben?", strings.TrimSpace(details.Find("p").Text()))
+	assert.Contains(t, details.Text(), "CT 1")
+	assert.Contains(t, details.Text(), "A999")
+
+	tearDownTest(t, server, store)
+}
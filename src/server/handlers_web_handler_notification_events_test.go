@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func TestIntegrationNotificationEventsShouldReturnJSONWithLifecycleEvents(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+	)
+
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/3")
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/1")
+	notification := getNotification(t, store, department, modality)
+	testRequest(t, "DELETE", server.URL+"/notification/"+department+"/"+notification.NotificationID)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/notification/"+notification.NotificationID+"/events", nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	events := responseBodyStrings["Events"].([]interface{})
+	assert.Equal(t, 3, len(events))
+
+	created := events[0].(map[string]interface{})
+	assert.Equal(t, lmdatabase.NotificationEventCreated, created["EventType"])
+	assert.Equal(t, "3", created["NewValue"])
+	assert.NotEmpty(t, created["ClientAddress"])
+
+	priority := events[1].(map[string]interface{})
+	assert.Equal(t, lmdatabase.NotificationEventPriority, priority["EventType"])
+	assert.Equal(t, "3", priority["PreviousValue"])
+	assert.Equal(t, "1", priority["NewValue"])
+
+	confirmed := events[2].(map[string]interface{})
+	assert.Equal(t, lmdatabase.NotificationEventConfirmed, confirmed["EventType"])
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationEventsShouldRecordCancel(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+	)
+
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/2")
+	notification := getNotification(t, store, department, modality)
+
+	// when
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/cancel")
+
+	// then
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errEvents)
+	}
+
+	assert.Equal(t, 2, len(*events))
+	assert.Equal(t, lmdatabase.NotificationEventCreated, (*events)[0].EventType)
+	assert.Equal(t, lmdatabase.NotificationEventCancelled, (*events)[1].EventType)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationEventsShouldReturnHTMLTimeline(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "abc"
+		modality   = "x"
+	)
+
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/3")
+	testRequest(t, "POST", server.URL+"/modality/"+modality+"/department/"+department+"/prio/1")
+	notification := getNotification(t, store, department, modality)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/notification/"+notification.NotificationID+"/events", nil)
+
+	// then
+	doc := getResponseHTMLDoc(t, request)
+
+	rows := doc.Find("tr")
+	assert.Equal(t, 2, rows.Length())
+	assert.Contains(t, rows.Eq(0).Text(), "Erstellt")
+	assert.Contains(t, rows.Eq(1).Text(), "Priorität geändert")
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationEventsShouldReturnHTTP404WhenNotificationDoesNotExist(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/notification/xxx/events", nil)
+
+	// then
+	response := getResponse(t, request)
+
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func testRequest(t *testing.T, method string, url string) {
+	request := newCSRFRequest(method, url, nil)
+	response := getResponse(t, request)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode, url)
+}
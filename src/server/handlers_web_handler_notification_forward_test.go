@@ -0,0 +1,172 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func TestIntegrationNotificationForwardShouldMoveNotificationToDepartment(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		modality = "ct"
+		now      = time.Now()
+	)
+
+	testNotificationInsert(t, store, "msk", 2, modality, now.Unix()-60)
+	notification := getNotification(t, store, "msk", modality)
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/notification/"+notification.NotificationID+"/forward/nr", nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	assert.Equal(t, "msk", responseBodyStrings["From"])
+	assert.Equal(t, "nr", responseBodyStrings["To"])
+
+	forwarded := getNotificationByID(t, store, notification.NotificationID)
+	assert.Equal(t, "nr", forwarded.DepartmentID)
+	assert.Equal(t, 2, forwarded.Priority)
+	assert.Equal(t, now.Unix()-60, forwarded.CreatedAt)
+
+	assert.Equal(t, ";0;", getOpenNotificationsStatus(t, server.URL, "msk"))
+	assert.Equal(t, ";1;MEDIUM;", getOpenNotificationsStatus(t, server.URL, "nr"))
+
+	request, _ = http.NewRequest("GET", server.URL+"/mtra/"+modality, nil)
+	visierung := getResponseBodyStrings(t, request)
+	assertNotificationHTMLNoPriority(t, getDocument(t, visierung["MSK"].(string)), modality, "msk")
+	assertNotificationHTMLMediumPriority(t, getDocument(t, visierung["NR"].(string)), modality, "nr", now.Add(-time.Minute))
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Equal(t, 1, len(*events))
+	assert.Equal(t, lmdatabase.NotificationEventForwarded, (*events)[0].EventType)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationForwardShouldReturnRemainingNotificationsHTML(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		now = time.Now()
+	)
+
+	testNotificationInsert(t, store, "msk", 2, "ct", now.Unix())
+	testNotificationInsert(t, store, "msk", 1, "mr", now.Unix())
+	notification := getNotification(t, store, "msk", "ct")
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/notification/"+notification.NotificationID+"/forward/nr", nil)
+
+	// then
+	doc := getResponseHTMLDoc(t, request)
+
+	notificationsSelection := doc.Find("div.content")
+	assert.Equal(t, 1, notificationsSelection.Length())
+	assert.Equal(t, "mr", notificationsSelection.Find("span.is-uppercase").Text())
+	assert.Equal(t, 4, notificationsSelection.Find("a.dropdown-item").Length())
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationForwardShouldReturnHTTP409WhenDepartmentHasOpenNotification(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		now = time.Now()
+	)
+
+	testNotificationInsert(t, store, "msk", 2, "ct", now.Unix())
+	testNotificationInsert(t, store, "nr", 3, "ct", now.Unix())
+	notification := getNotification(t, store, "msk", "ct")
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/notification/"+notification.NotificationID+"/forward/nr", nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assert.Equal(t, "msk", getNotificationByID(t, store, notification.NotificationID).DepartmentID)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationForwardShouldReturnHTTP409WhenForwardedToItsDepartment(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		now = time.Now()
+	)
+
+	testNotificationInsert(t, store, "msk", 2, "ct", now.Unix())
+	notification := getNotification(t, store, "msk", "ct")
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/notification/"+notification.NotificationID+"/forward/msk", nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	events, errEvents := store.NotificationEventGetByNotificationID(notification.NotificationID)
+	if errEvents != nil {
+		t.Fatalf("%+v", errors.WithStack(errEvents))
+	}
+	assert.Empty(t, *events)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationNotificationForwardShouldRejectUnknownDepartmentAndNotification(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	testNotificationInsert(t, store, "msk", 2, "ct", time.Now().Unix())
+	notification := getNotification(t, store, "msk", "ct")
+
+	// when
+	request := newCSRFRequest("POST", server.URL+"/notification/"+notification.NotificationID+"/forward/xyz", nil)
+	responseUnknownDepartment := getResponse(t, request)
+
+	request = newCSRFRequest("POST", server.URL+"/notification/xxx/forward/nr", nil)
+	responseUnknownNotification := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, responseUnknownDepartment.StatusCode)
+	assert.Equal(t, http.StatusNotFound, responseUnknownNotification.StatusCode)
+
+	tearDownTest(t, server, store)
+}
+
+func getOpenNotificationsStatus(t *testing.T, serverURL string, department string) string {
+	response, errHTTPGet := http.Get(serverURL + "/nce-rest/arduino-status/" + department + "-open-notifications")
+	if errHTTPGet != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTTPGet))
+	}
+	defer response.Body.Close()
+
+	body, errReadResponse := ioutil.ReadAll(response.Body)
+	if errReadResponse != nil {
+		t.Fatalf("%+v", errors.WithStack(errReadResponse))
+	}
+	return string(body)
+}
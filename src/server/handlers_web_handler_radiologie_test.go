@@ -6,13 +6,15 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
 func TestIntegrationRadiologieShouldReturnJSONWithNotificationsHTML(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	duration, _ := time.ParseDuration("-1h")
 
@@ -21,9 +23,9 @@ func TestIntegrationRadiologieShouldReturnJSONWithNotificationsHTML(t *testing.T
 		oneHourAgo = time.Now().Add(duration)
 	)
 
-	testNotificationInsert(t, db, department, 1, "x", oneHourAgo.Unix())      // oldest, but highest prio
-	testNotificationInsert(t, db, department, 2, "y", oneHourAgo.Unix()+1000) // medium prio
-	testNotificationInsert(t, db, department, 3, "z", oneHourAgo.Unix()+2000) // most recent lowest prio
+	testNotificationInsert(t, store, department, 1, "x", oneHourAgo.Unix())      // oldest, but highest prio
+	testNotificationInsert(t, store, department, 2, "y", oneHourAgo.Unix()+1000) // medium prio
+	testNotificationInsert(t, store, department, 3, "z", oneHourAgo.Unix()+2000) // most recent lowest prio
 
 	// when
 	request, _ := http.NewRequest("GET", server.URL+"/radiologie/"+department, nil)
@@ -54,20 +56,20 @@ func TestIntegrationRadiologieShouldReturnJSONWithNotificationsHTML(t *testing.T
 		}
 	})
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationRadiologieShouldReturnJSONWithArduinoStatus(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		department = "aod"
 		now        = time.Now()
 	)
 
-	arduinoStatus := testArduinoStatusInsert(t, db, department, now.Unix())
+	arduinoStatus := testArduinoStatusInsert(t, store, department, now.Unix())
 
 	// when
 	request, _ := http.NewRequest("GET", server.URL+"/radiologie/"+department, nil)
@@ -84,13 +86,13 @@ func TestIntegrationRadiologieShouldReturnJSONWithArduinoStatus(t *testing.T) {
 	assert.Equal(t, department, arduinoStatusStrings["DepartmentID"])
 	assert.Equal(t, float64(arduinoStatus.StatusAt), arduinoStatusStrings["StatusAt"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func assertNotificationDisplayHTML(t *testing.T, notificationSelection *goquery.Selection, priorityClass string, modality string, expectedTime time.Time) {
 
 	partsSelection := notificationSelection.Find("div.control")
-	assert.Equal(t, 2, partsSelection.Length())
+	assert.Equal(t, 3, partsSelection.Length())
 
 	partsSelection.Each(func(partsSelectionIndex int, partSelection *goquery.Selection) {
 		if partsSelectionIndex == 0 {
@@ -116,5 +118,58 @@ func assertNotificationDisplayHTML(t *testing.T, notificationSelection *goquery.
 			tagsSelection := partSelection.Find("a.tag")
 			assert.Equal(t, 1, tagsSelection.Length())
 		}
+		if partsSelectionIndex == 2 {
+			forwardSelection := partSelection.Find("a.dropdown-item")
+			assert.Equal(t, len(departments)-1, forwardSelection.Length())
+		}
 	})
 }
+
+func TestIntegrationRadiologieShouldShowHealthOfEachDevice(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "aod"
+		now        = time.Now().Unix()
+	)
+
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-1", DepartmentID: department, Location: "Befundraum 1", FirmwareVersion: "1.1", LastSeenAt: now - 10, RemoteAddress: "10.0.0.1"})
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-2", DepartmentID: department, Location: "Befundraum 2", FirmwareVersion: "1.0", LastSeenAt: now - 600, RemoteAddress: "10.0.0.2"})
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-3", DepartmentID: "ctd", LastSeenAt: now})
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/radiologie/"+department, nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	doc, errHTMLDoc := goquery.NewDocumentFromResponse(response)
+	if errHTMLDoc != nil {
+		t.Fatalf("%+v", errors.WithStack(errHTMLDoc))
+	}
+
+	rows := doc.Find("table.devices tbody tr")
+	assert.Equal(t, 2, rows.Length())
+
+	connected := rows.Eq(0)
+	assert.Equal(t, 1, connected.Find("i.fa-signal").Length())
+	assert.Contains(t, connected.Text(), "light-1")
+	assert.Contains(t, connected.Text(), "Befundraum 1")
+	assert.Contains(t, connected.Text(), "1.1")
+	assert.Contains(t, connected.Text(), "10.0.0.1")
+
+	disconnected := rows.Eq(1)
+	assert.Equal(t, 1, disconnected.Find("i.fa-ban").Length())
+	assert.Contains(t, disconnected.Text(), "light-2")
+
+	request, _ = http.NewRequest("GET", server.URL+"/radiologie/"+department, nil)
+	devices := getResponseBodyStrings(t, request)["Devices"].([]interface{})
+	assert.Equal(t, 2, len(devices))
+	assert.Equal(t, true, devices[0].(map[string]interface{})["Connected"])
+	assert.Equal(t, false, devices[1].(map[string]interface{})["Connected"])
+
+	tearDownTest(t, server, store)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func testNotificationConfirmAfter(t *testing.T, store lmdatabase.Store, department string, priority int, modality string, createdAt int64, seconds int64) {
+	notificationID, errInsert := store.NotificationInsert(department, priority, modality, createdAt)
+	if errInsert != nil {
+		t.Fatalf("%+v", errors.WithStack(errInsert))
+	}
+
+	_, errConfirm := store.NotificationConfirm(notificationID, createdAt+seconds, "ws-1", "")
+	if errConfirm != nil {
+		t.Fatalf("%+v", errors.WithStack(errConfirm))
+	}
+}
+
+func TestIntegrationStatisticsShouldReturnJSONGroupedByDepartmentAndPriority(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+60, 30)
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+120, 90)
+	testNotificationConfirmAfter(t, store, "msk", 1, "mr", dayStart+180, 60)
+	testNotificationConfirmAfter(t, store, "msk", 3, "ct", dayStart+240, 600)
+	testNotificationInsert(t, store, "nr", 1, "ct", dayStart+300)
+	_, errCancel := store.NotificationCancel("ct", "nr", dayStart+310, "ws-1", "")
+	if errCancel != nil {
+		t.Fatalf("%+v", errors.WithStack(errCancel))
+	}
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart+86400, 10) // next day
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/statistics?from=2020-01-01&to=2020-01-01", nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	groups := responseBodyStrings["Groups"].([]interface{})
+	assert.Equal(t, 3, len(groups))
+
+	mskHigh := groups[0].(map[string]interface{})
+	assert.Equal(t, "msk", mskHigh["Department"])
+	assert.Equal(t, float64(1), mskHigh["Priority"])
+	assert.Equal(t, float64(3), mskHigh["Count"])
+	assert.Equal(t, float64(60), mskHigh["ConfirmMedian"])
+	assert.Equal(t, float64(90), mskHigh["ConfirmP90"])
+	assert.Equal(t, float64(90), mskHigh["ConfirmMax"])
+
+	mskLow := groups[1].(map[string]interface{})
+	assert.Equal(t, float64(3), mskLow["Priority"])
+	assert.Equal(t, float64(600), mskLow["ConfirmMax"])
+
+	nrHigh := groups[2].(map[string]interface{})
+	assert.Equal(t, "nr", nrHigh["Department"])
+	assert.Equal(t, float64(1), nrHigh["Cancelled"])
+	assert.Equal(t, float64(100), nrHigh["CancelRate"])
+
+	total := responseBodyStrings["Total"].(map[string]interface{})
+	assert.Equal(t, float64(5), total["Count"])
+	assert.Equal(t, float64(20), total["CancelRate"])
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationStatisticsShouldReturnHTMLGroupedByHour(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	dayStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+
+	testNotificationConfirmAfter(t, store, "msk", 1, "ct", dayStart, 30)
+	testNotificationConfirmAfter(t, store, "msk", 2, "mr", dayStart+60, 120)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/statistics?from=2020-01-01&to=2020-01-01&groupBy=hour", nil)
+
+	// then
+	doc := getResponseHTMLDoc(t, request)
+
+	headers := doc.Find("table.statistics thead th")
+	assert.Equal(t, "Stunde", headers.First().Text())
+
+	rows := doc.Find("table.statistics tbody tr")
+	assert.Equal(t, 1, rows.Length())
+	cells := rows.First().Find("td")
+	assert.Equal(t, "00:00", cells.Eq(0).Text())
+	assert.Equal(t, "2", cells.Eq(1).Text())
+	assert.Equal(t, "2m0s", cells.Eq(8).Text())
+
+	_, hourChecked := doc.Find("input[value=hour]").Attr("checked")
+	assert.True(t, hourChecked)
+	_, departmentChecked := doc.Find("input[value=department]").Attr("checked")
+	assert.False(t, departmentChecked)
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationStatisticsShouldReturnHTTP400ForUnknownDimension(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/statistics?groupBy=room", nil)
+	response := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	tearDownTest(t, server, store)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func TestIntegrationUptimeShouldReturnJSONWithUptimeOfDepartmentAndDevices(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "msk"
+		dayStart   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+	)
+
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-1", DepartmentID: department, LastSeenAt: dayStart + 3600})
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-1", DepartmentID: department, LastSeenAt: dayStart + 3900})
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-2", DepartmentID: department, LastSeenAt: dayStart + 2*86400})
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/uptime/"+department+"?from=2020-01-01&to=2020-01-01", nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	assert.Equal(t, "2020-01-01", responseBodyStrings["From"])
+	assert.Equal(t, "2020-01-01", responseBodyStrings["To"])
+
+	uptime := responseBodyStrings["Uptime"].(map[string]interface{})
+	assert.InDelta(t, 300*100/86400.0, uptime["UptimePercentage"], 0.001)
+	assert.Equal(t, 2, len(uptime["Outages"].([]interface{})))
+
+	devices := responseBodyStrings["Devices"].([]interface{})
+	assert.Equal(t, 2, len(devices))
+
+	device1 := devices[0].(map[string]interface{})
+	assert.Equal(t, "light-1", device1["DeviceID"])
+	assert.InDelta(t, 300*100/86400.0, device1["UptimePercentage"], 0.001)
+	outages := device1["Outages"].([]interface{})
+	assert.Equal(t, float64(dayStart), outages[0].(map[string]interface{})["StartedAt"])
+	assert.Equal(t, float64(dayStart+3600), outages[0].(map[string]interface{})["EndedAt"])
+	assert.Equal(t, float64(dayStart+3900), outages[1].(map[string]interface{})["StartedAt"])
+	assert.Equal(t, float64(dayStart+86400), outages[1].(map[string]interface{})["EndedAt"])
+
+	device2 := devices[1].(map[string]interface{})
+	assert.Equal(t, "light-2", device2["DeviceID"])
+	assert.Equal(t, float64(0), device2["UptimePercentage"])
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationUptimeShouldReturnHTMLReport(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		department = "msk"
+		now        = time.Now().Unix()
+	)
+
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-1", DepartmentID: department, Location: "Befundraum 1", LastSeenAt: now - 60})
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/uptime/"+department, nil)
+
+	// then
+	doc := getResponseHTMLDoc(t, request)
+
+	uptimeSelection := doc.Find("div.uptime")
+	assert.Equal(t, 2, uptimeSelection.Length())
+	assert.Contains(t, uptimeSelection.Eq(1).Find("h2").Text(), "light-1 (Befundraum 1)")
+	assert.Equal(t, 1, uptimeSelection.Eq(1).Find("table.outages tr").Length())
+	assert.Equal(t, time.Now().AddDate(0, 0, -6).Format("2006-01-02"), doc.Find("input[name=from]").AttrOr("value", ""))
+	assert.Equal(t, time.Now().Format("2006-01-02"), doc.Find("input[name=to]").AttrOr("value", ""))
+
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationUptimeShouldReturnHTTP400ForInvalidPeriod(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/uptime/msk?from=01.01.2020", nil)
+	responseInvalidDate := getResponse(t, request)
+
+	request, _ = http.NewRequest("GET", server.URL+"/uptime/msk?from=2020-01-02&to=2020-01-01", nil)
+	responseFromAfterTo := getResponse(t, request)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, responseInvalidDate.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, responseFromAfterTo.StatusCode)
+
+	tearDownTest(t, server, store)
+}
@@ -13,7 +13,7 @@ import (
 func TestIntegrationVisierungShouldReturnJSONForAllCards(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		modality    = "x"
@@ -23,11 +23,11 @@ func TestIntegrationVisierungShouldReturnJSONForAllCards(t *testing.T) {
 		// priorityNumber float64 = 3
 	)
 
-	testNotificationInsert(t, db, "aod", priorityInt, modality, now.Unix())
-	testNotificationInsert(t, db, "ctd", priorityInt, modality, now.Unix())
-	testNotificationInsert(t, db, "msk", priorityInt, modality, now.Unix())
-	testNotificationInsert(t, db, "nr", priorityInt, modality, now.Unix())
-	testNotificationInsert(t, db, "nuk", priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, "aod", priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, "ctd", priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, "msk", priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, "nr", priorityInt, modality, now.Unix())
+	testNotificationInsert(t, store, "nuk", priorityInt, modality, now.Unix())
 
 	// when
 	request, _ := http.NewRequest("GET", server.URL+"/mtra/"+modality, nil)
@@ -45,13 +45,13 @@ func TestIntegrationVisierungShouldReturnJSONForAllCards(t *testing.T) {
 	assertNotificationHTMLMediumPriority(t, getDocument(t, responseBodyStrings["NUK_NUK"].(string)), modality, "nuk", now)
 	assert.Empty(t, responseBodyStrings["ProcessedNotifications"])
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
 func TestIntegrationVisierungShouldReturnJSONWithProcessedNotifications(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	var (
 		modality    = "x"
@@ -62,20 +62,20 @@ func TestIntegrationVisierungShouldReturnJSONWithProcessedNotifications(t *testi
 		// priorityNumber float64 = 3
 	)
 
-	testNotificationInsert(t, db, "aod", priorityInt, modality, now.Unix()-1000) // cancelled
-	testNotificationInsert(t, db, "ctd", priorityInt, modality, now.Unix()-500)  // confirmed
+	testNotificationInsert(t, store, "aod", priorityInt, modality, now.Unix()-1000) // cancelled
+	testNotificationInsert(t, store, "ctd", priorityInt, modality, now.Unix()-500)  // confirmed
 
-	errNotificationCancel := lmdatabase.NotificationCancel(db, modality, "aod", cancelledAt)
+	_, errNotificationCancel := store.NotificationCancel(modality, "aod", cancelledAt, "ws-mtra", "")
 	if errNotificationCancel != nil {
 		t.Fatalf("%+v", errors.WithStack(errNotificationCancel))
 	}
 
-	notification, errNotificationGetByDepartmentAndModality := lmdatabase.NotificationGetOpenNotificationByDepartmentAndModality(db, "ctd", modality)
+	notification, errNotificationGetByDepartmentAndModality := store.NotificationGetOpenNotificationByDepartmentAndModality("ctd", modality)
 	if errNotificationGetByDepartmentAndModality != nil {
 		t.Fatalf("%+v", errors.WithStack(errNotificationGetByDepartmentAndModality))
 	}
 
-	_, errNotificationConfirm := lmdatabase.NotificationConfirm(db, notification.NotificationID, now.Unix())
+	_, errNotificationConfirm := store.NotificationConfirm(notification.NotificationID, now.Unix(), "ws-radiologie", "")
 	if errNotificationConfirm != nil {
 		t.Fatalf("%+v", errors.WithStack(errNotificationConfirm))
 	}
@@ -99,6 +99,7 @@ func TestIntegrationVisierungShouldReturnJSONWithProcessedNotifications(t *testi
 		assert.Equal(t, float64(-1), ctdNotification["CancelledAt"].(float64))
 		assert.Equal(t, float64(now.Unix()), ctdNotification["ConfirmedAt"].(float64))
 		assert.Equal(t, float64(now.Unix()-500), ctdNotification["CreatedAt"].(float64))
+		assert.Equal(t, "ws-radiologie", ctdNotification["ConfirmedBy"].(string))
 	}
 
 	{
@@ -110,7 +111,39 @@ func TestIntegrationVisierungShouldReturnJSONWithProcessedNotifications(t *testi
 		assert.Equal(t, float64(cancelledAt), aodNotification["CancelledAt"].(float64))
 		assert.Equal(t, float64(-1), aodNotification["ConfirmedAt"].(float64))
 		assert.Equal(t, float64(now.Unix()-1000), aodNotification["CreatedAt"].(float64))
+		assert.Equal(t, "ws-mtra", aodNotification["CancelledBy"].(string))
 	}
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
+}
+
+func TestIntegrationVisierungShouldShowHealthOfEachDeviceOnCard(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	var (
+		modality = "x"
+		now      = time.Now().Unix()
+	)
+
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-1", DepartmentID: "msk", Location: "Befundraum 1", LastSeenAt: now})
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: "light-2", DepartmentID: "msk", LastSeenAt: now - 600})
+
+	// when
+	request, _ := http.NewRequest("GET", server.URL+"/mtra/"+modality, nil)
+
+	// then
+	responseBodyStrings := getResponseBodyStrings(t, request)
+
+	devicesSelection := getDocument(t, responseBodyStrings["MSK"].(string)).Find("div.card-footer-item i.device")
+	assert.Equal(t, 2, devicesSelection.Length())
+	assert.True(t, devicesSelection.Eq(0).HasClass("fa-signal"))
+	assert.Equal(t, "light-1 (Befundraum 1): verbunden", devicesSelection.Eq(0).AttrOr("title", ""))
+	assert.True(t, devicesSelection.Eq(1).HasClass("fa-ban"))
+	assert.Contains(t, devicesSelection.Eq(1).AttrOr("title", ""), "light-2: kein Signal seit")
+
+	assertNotificationHTMLArdunioStatusNoSignal(t, getDocument(t, responseBodyStrings["NR"].(string)))
+
+	tearDownTest(t, server, store)
 }
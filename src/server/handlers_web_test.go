@@ -1,7 +1,6 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -15,10 +14,10 @@ import (
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
-func TestIntegrationIndexShouldReturnLinksForMTRAsAndRadiologists(t *testing.T) {
+func TestIntegrationIndexShouldReturnLinksForMTRAsRadiologistsAndReports(t *testing.T) {
 
 	// given
-	server, db := setupTest(t)
+	server, store := setupTest(t)
 
 	// when
 	request, _ := http.NewRequest("GET", server.URL+"/", nil)
@@ -30,26 +29,26 @@ func TestIntegrationIndexShouldReturnLinksForMTRAsAndRadiologists(t *testing.T)
 		return s.AttrOr("href", "")
 	})
 
-	expectedLinks := []string{"/mtra/ct", "/mtra/mr", "/mtra/nuk", "/radiologie/aod", "/radiologie/ctd", "/radiologie/msk", "/radiologie/nr", "/radiologie/nuk"}
+	expectedLinks := []string{"/mtra/ct", "/mtra/mr", "/mtra/nuk", "/radiologie/aod", "/radiologie/ctd", "/radiologie/msk", "/radiologie/nr", "/radiologie/nuk", "/history", "/statistics"}
 	assert.EqualValues(t, expectedLinks, links)
 
-	tearDownTest(t, server, db)
+	tearDownTest(t, server, store)
 }
 
-func testNotificationInsert(t *testing.T, db *sql.DB, department string, priority int, modality string, when int64) {
-	err := lmdatabase.NotificationInsert(db, department, priority, modality, when)
+func testNotificationInsert(t *testing.T, store lmdatabase.Store, department string, priority int, modality string, when int64) {
+	_, err := store.NotificationInsert(department, priority, modality, when)
 	if err != nil {
 		t.Fatalf("%+v", errors.WithStack(err))
 	}
 }
 
-func testArduinoStatusInsert(t *testing.T, db *sql.DB, department string, when int64) lmdatabase.ArduinoStatus {
+func testArduinoStatusInsert(t *testing.T, store lmdatabase.Store, department string, when int64) lmdatabase.ArduinoStatus {
 	arduinoStatus := lmdatabase.ArduinoStatus{
 		DepartmentID: department,
 		StatusAt:     when,
 	}
 
-	errArduinoStatusInsert := lmdatabase.ArduinoStatusInsert(db, arduinoStatus)
+	errArduinoStatusInsert := store.ArduinoStatusInsert(arduinoStatus)
 	if errArduinoStatusInsert != nil {
 		t.Fatalf("%+v", errArduinoStatusInsert)
 	}
@@ -57,6 +56,13 @@ func testArduinoStatusInsert(t *testing.T, db *sql.DB, department string, when i
 	return arduinoStatus
 }
 
+func testDeviceHeartbeat(t *testing.T, store lmdatabase.Store, device lmdatabase.Device) {
+	errDeviceHeartbeat := store.DeviceHeartbeat(device)
+	if errDeviceHeartbeat != nil {
+		t.Fatalf("%+v", errDeviceHeartbeat)
+	}
+}
+
 func getResponseHTMLDoc(t *testing.T, request *http.Request) *goquery.Document {
 	request.Header.Set(HTMLHeaderContentType, HTMLHeaderContentTypeValueHTML)
 
@@ -2,21 +2,52 @@ package server
 
 import (
 	"bytes"
-	"database/sql"
-	"text/template"
+	"html/template"
 	"time"
 
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
-func getCardHTML(db *sql.DB, modality string, department string) (string, error) {
+// deviceView is a registered device together with its health as shown on the pages
+type deviceView struct {
+	lmdatabase.Device
+	Connected bool
+	LastSeen  string
+}
+
+func getDeviceViews(store lmdatabase.Store, department string, now int64) ([]deviceView, error) {
+	devices, errDeviceGetByDepartment := store.DeviceGetByDepartment(department)
+	if errDeviceGetByDepartment != nil {
+		return nil, errDeviceGetByDepartment
+	}
+
+	views := make([]deviceView, 0, len(*devices))
+	for _, device := range *devices {
+		views = append(views, deviceView{
+			Device:    device,
+			Connected: device.SeenWithin5MinutesFrom(now),
+			LastSeen:  time.Unix(device.LastSeenAt, 0).Format("02.01.2006 15:04:05"),
+		})
+	}
+
+	return views, nil
+}
+
+// getCardHTML renders the card of the department as shown on the MTRA page, html/template escaped its values so the
+// pages embed it as is
+func getCardHTML(store lmdatabase.Store, modality string, department string) (template.HTML, error) {
 	now := time.Now().Unix()
-	arduinoStatus, errStatusQuery := lmdatabase.ArduinoStatusQueryWithin5MinutesFromNow(db, department, now)
+	arduinoStatus, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(department, now)
 	if errStatusQuery != nil {
 		return "", errStatusQuery
 	}
 
-	notification, errNotificationGetByDepartmentAndModality := lmdatabase.NotificationGetOpenNotificationByDepartmentAndModality(db, department, modality)
+	devices, errDevices := getDeviceViews(store, department, now)
+	if errDevices != nil {
+		return "", errDevices
+	}
+
+	notification, errNotificationGetByDepartmentAndModality := store.NotificationGetOpenNotificationByDepartmentAndModality(department, modality)
 	if errNotificationGetByDepartmentAndModality != nil {
 		return "", errNotificationGetByDepartmentAndModality
 	}
@@ -27,7 +58,9 @@ func getCardHTML(db *sql.DB, modality string, department string) (string, error)
 		"PriorityNumber": notification.Priority,
 		"PriorityName":   priorityMap[notification.Priority],
 		"ArduinoStatus":  arduinoStatus,
+		"Devices":        devices,
 		"CreatedAt":      time.Unix(notification.CreatedAt, 0).Format("15:04:05"),
+		"Details":        notification.NotificationDetails,
 	}
 
 	var aodBuffer bytes.Buffer
@@ -36,11 +69,11 @@ func getCardHTML(db *sql.DB, modality string, department string) (string, error)
 		return "", errExecute
 	}
 
-	return aodBuffer.String(), nil
+	return template.HTML(aodBuffer.String()), nil
 }
 
-func getNotificationsHTML(db *sql.DB, department string) (string, error) {
-	notifications, errNotificationGetByDepartment := lmdatabase.NotificationGetOpenNotificationsByDepartment(db, department)
+func getNotificationsHTML(store lmdatabase.Store, department string) (template.HTML, error) {
+	notifications, errNotificationGetByDepartment := store.NotificationGetOpenNotificationsByDepartment(department)
 	if errNotificationGetByDepartment != nil {
 		return "", errNotificationGetByDepartment
 	}
@@ -61,6 +94,7 @@ func getNotificationsHTML(db *sql.DB, department string) (string, error) {
 
 	data := map[string]interface{}{
 		"Notifications": notifications,
+		"Departments":   departments,
 	}
 
 	var notificationsBuffer bytes.Buffer
@@ -76,5 +110,48 @@ func getNotificationsHTML(db *sql.DB, department string) (string, error) {
 		return "", errExecute
 	}
 
-	return notificationsBuffer.String(), nil
+	return template.HTML(notificationsBuffer.String()), nil
+}
+
+// getRadiologieStatusHTML renders the status of the lights of the department as shown on the radiologist page
+func getRadiologieStatusHTML(store lmdatabase.Store, department string, now int64) (template.HTML, error) {
+	arduinoStatus, errStatusQuery := store.ArduinoStatusQueryWithin5MinutesFromNow(department, now)
+	if errStatusQuery != nil {
+		return "", errStatusQuery
+	}
+
+	devices, errDevices := getDeviceViews(store, department, now)
+	if errDevices != nil {
+		return "", errDevices
+	}
+
+	data := map[string]interface{}{
+		"Department":    department,
+		"ArduinoStatus": arduinoStatus,
+		"Devices":       devices,
+	}
+
+	var statusBuffer bytes.Buffer
+	errExecute := templates[templateRadiologieID].ExecuteTemplate(&statusBuffer, "status", data)
+	if errExecute != nil {
+		return "", errExecute
+	}
+
+	return template.HTML(statusBuffer.String()), nil
+}
+
+// getProcessedHTML renders the rows of the processed notifications of the modality as shown on the MTRA page
+func getProcessedHTML(store lmdatabase.Store, modality string) (template.HTML, error) {
+	processedNotifications, errNotificationGetByModality := store.NotificationGetProcessedNotificationsByModality(modality)
+	if errNotificationGetByModality != nil {
+		return "", errNotificationGetByModality
+	}
+
+	var processedBuffer bytes.Buffer
+	errExecute := templates[templateVisierungID].ExecuteTemplate(&processedBuffer, "processed", processedNotifications)
+	if errExecute != nil {
+		return "", errExecute
+	}
+
+	return template.HTML(processedBuffer.String()), nil
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// testMaliciousSegment breaks out of attributes, elements and javascript strings if it is not escaped
+const testMaliciousSegment = `"><img src=x onerror=alert(1)>'-alert(2)-'`
+
+func TestIntegrationPagesShouldEscapeMaliciousPathSegments(t *testing.T) {
+
+	// given
+	server, store := setupTest(t)
+
+	for _, path := range []string{"/mtra/", "/radiologie/", "/uptime/"} {
+
+		// when
+		request, _ := http.NewRequest("GET", server.URL+path+url.PathEscape(testMaliciousSegment), nil)
+		response := getResponse(t, request)
+		body := string(getResponseBody(t, response))
+		doc := getDocument(t, body)
+
+		// then
+		assert.NotContains(t, body, "<img src=x", path)
+		assert.NotContains(t, body, "'-alert(2)-'", path)
+		assert.Equal(t, 0, doc.Find("img[onerror]").Length(), path)
+	}
+
+	request, _ := http.NewRequest("GET", server.URL+"/mtra/"+url.PathEscape(testMaliciousSegment), nil)
+	visierung := getResponseHTMLDoc(t, request)
+	assert.Equal(t, "Visierung "+testMaliciousSegment, visierung.Find("h1.title").Text())
+
+	tearDownTest(t, server, store)
+}
+
+func TestUnitPartialsShouldEscapeStoredValues(t *testing.T) {
+
+	// given
+	if errCompile := compileTemplates(); errCompile != nil {
+		t.Fatalf("%+v", errCompile)
+	}
+
+	store := lmdatabase.NewMemoryStore()
+	testNotificationInsert(t, store, testMaliciousSegment, 1, testMaliciousSegment, time.Now().Unix())
+	testDeviceHeartbeat(t, store, lmdatabase.Device{DeviceID: testMaliciousSegment, DepartmentID: testMaliciousSegment, LastSeenAt: time.Now().Unix()})
+
+	// when
+	card, errCard := getCardHTML(store, testMaliciousSegment, testMaliciousSegment)
+	if errCard != nil {
+		t.Fatalf("%+v", errCard)
+	}
+
+	notifications, errNotifications := getNotificationsHTML(store, testMaliciousSegment)
+	if errNotifications != nil {
+		t.Fatalf("%+v", errNotifications)
+	}
+
+	cardDoc := getDocument(t, string(card))
+	notificationsDoc := getDocument(t, string(notifications))
+
+	// then
+	for _, html := range []string{string(card), string(notifications)} {
+		assert.NotContains(t, html, "<img src=x")
+		assert.False(t, strings.Contains(html, "'-alert(2)-'"))
+	}
+	assert.Equal(t, 0, cardDoc.Find("img").Length())
+	assert.Equal(t, 0, notificationsDoc.Find("img").Length())
+
+	assert.Equal(t, "/modality/"+testMaliciousSegment+"/department/"+testMaliciousSegment+"/cancel", cardDoc.Find(".tag.is-delete").AttrOr("ic-post-to", ""))
+	assert.Equal(t, testMaliciousSegment+": verbunden", cardDoc.Find("i.device").AttrOr("title", ""))
+	assert.Equal(t, testMaliciousSegment, notificationsDoc.Find(".is-uppercase").First().Text())
+}
@@ -1,21 +1,52 @@
 package server
 
 import (
-	"database/sql"
+	"context"
 	"log"
 	"net/http"
+	"net/url"
 
+	"github.com/gorilla/mux"
+	"github.com/usb-radiology/light-messenger/src/authentication"
 	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
 )
 
+// access is what a route requires of the logged in user, it is enforced when authentication is enabled
+type access int
+
+const (
+	accessPublic      access = iota // everybody, e.g. the lights and the login page
+	accessUser                      // every logged in user
+	accessMTRA                      // MTRAs of the modality of the route or of its notification, and admins
+	accessRadiologist               // radiologists of the department of the route or of its notification, and admins
+)
+
+type contextKey int
+
+const contextKeyUser contextKey = 0
+
 type handler struct {
-	db           *sql.DB
-	initConfig   *configuration.Configuration
-	routeHandler func(config *configuration.Configuration, db *sql.DB, w http.ResponseWriter, r *http.Request) error
+	store         lmdatabase.Store
+	initConfig    *configuration.Configuration
+	routeHandler  func(config *configuration.Configuration, store lmdatabase.Store, w http.ResponseWriter, r *http.Request) error
+	authenticator *authentication.Authenticator
+	access        access
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.routeHandler(h.initConfig, h.db, w, r)
+	r, status, err := authorize(h.authenticator, h.store, h.access, r)
+	if err == nil {
+		switch {
+		case status == http.StatusUnauthorized && r.Method == http.MethodGet && r.Header.Get(HTMLHeaderContentType) != HTMLHeaderContentTypeValueJSON:
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		case status != http.StatusOK:
+			http.Error(w, http.StatusText(status), status)
+		default:
+			err = h.routeHandler(h.initConfig, h.store, w, r)
+		}
+	}
+
 	if err != nil {
 		log.Printf("%+v", err)
 
@@ -23,3 +54,118 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.StatusInternalServerError)
 	}
 }
+
+// apiHandler serves the routes of the api, it only responds with json, errors included
+type apiHandler handler
+
+func (h apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !acceptsJSON(r) {
+		writeAPIError(w, http.StatusNotAcceptable, "the api responds with "+apiMediaType+" only")
+		return
+	}
+
+	// forms of other sites can post without body but not with a json content type, so they can't change anything
+	if r.Method != http.MethodGet && !sendsJSON(r) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "requests that change something must be sent as "+apiMediaType)
+		return
+	}
+
+	r, status, err := authorize(h.authenticator, h.store, h.access, r)
+	if err == nil {
+		switch status {
+		case http.StatusUnauthorized:
+			w.Header().Set("www-authenticate", `Basic realm="light-messenger"`)
+			writeAPIError(w, status, "log in or send the credentials of a user")
+		case http.StatusForbidden:
+			writeAPIError(w, status, "the role of the user does not permit "+r.Method+" "+r.URL.Path)
+		default:
+			err = h.routeHandler(h.initConfig, h.store, w, r)
+		}
+	}
+
+	if err != nil {
+		log.Printf("%+v", err)
+
+		writeAPIError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// authorize returns the request with the logged in user in its context and http.StatusOK if the user may access the
+// route, http.StatusUnauthorized if nobody is logged in and http.StatusForbidden if the role does not permit it
+func authorize(authenticator *authentication.Authenticator, store lmdatabase.Store, access access, r *http.Request) (*http.Request, int, error) {
+	if !authenticator.Enabled() || access == accessPublic {
+		return r, http.StatusOK, nil
+	}
+
+	user, errUser := authenticator.User(r)
+	if errUser != nil {
+		return r, 0, errUser
+	}
+
+	if user == nil {
+		return r, http.StatusUnauthorized, nil
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), contextKeyUser, user))
+
+	permitted, errPermits := permits(store, user, access, r)
+	if errPermits != nil {
+		return r, 0, errPermits
+	}
+
+	if !permitted {
+		return r, http.StatusForbidden, nil
+	}
+
+	return r, http.StatusOK, nil
+}
+
+// permits reports whether the role of the user permits the access to the modality and department of the route, or
+// of its notification if the route has an id
+func permits(store lmdatabase.Store, user *lmdatabase.User, access access, r *http.Request) (bool, error) {
+	if access == accessUser {
+		return true, nil
+	}
+
+	vars := mux.Vars(r)
+	modality := vars["modality"]
+	department := vars["department"]
+
+	if notificationID := vars["id"]; notificationID != "" {
+		notification, errNotification := store.NotificationGetByID(notificationID)
+		if errNotification != nil {
+			return false, errNotification
+		}
+
+		// only the role is checked for unknown notifications, the route responds with 404
+		modality, department = "", ""
+		if notification != nil {
+			modality, department = notification.Modality, notification.DepartmentID
+		}
+	}
+
+	if access == accessMTRA {
+		return authentication.MayCreateAndCancel(user, modality), nil
+	}
+	return authentication.MayConfirm(user, department), nil
+}
+
+// requestUser returns the logged in user, nil if authentication is disabled
+func requestUser(r *http.Request) *lmdatabase.User {
+	user, _ := r.Context().Value(contextKeyUser).(*lmdatabase.User)
+	return user
+}
+
+// mayCreateAndCancel applies authentication.MayCreateAndCancel to the user of the request, everybody may if
+// authentication is disabled
+func mayCreateAndCancel(r *http.Request, modality string) bool {
+	user := requestUser(r)
+	return user == nil || authentication.MayCreateAndCancel(user, modality)
+}
+
+// mayConfirm applies authentication.MayConfirm to the user of the request, everybody may if authentication is
+// disabled
+func mayConfirm(r *http.Request, department string) bool {
+	user := requestUser(r)
+	return user == nil || authentication.MayConfirm(user, department)
+}
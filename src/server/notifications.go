@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// confirmNotification confirms the open notification and records the event, it returns 0 if the notification does not
+// exist or is not open
+func confirmNotification(store lmdatabase.Store, notificationID string, now int64, r *http.Request) (int64, error) {
+	return store.NotificationConfirm(notificationID, now, requestedBy(r), clientAddress(r))
+}
+
+// cancelNotification cancels the open notification of the modality and department and records the event, it returns
+// the cancelled notification, nil if there was no open notification
+func cancelNotification(store lmdatabase.Store, modality string, department string, now int64, r *http.Request) (*lmdatabase.Notification, error) {
+	return store.NotificationCancel(modality, department, now, requestedBy(r), clientAddress(r))
+}
+
+// errNotificationUnknown is returned by the operations for ids of notifications that do not exist
+var errNotificationUnknown = errors.New("unknown notification")
+
+// notificationByID returns the notification, errNotificationUnknown if it does not exist
+func notificationByID(store lmdatabase.Store, notificationID string) (*lmdatabase.Notification, error) {
+	notification, errNotificationGetByID := store.NotificationGetByID(notificationID)
+	if errNotificationGetByID != nil {
+		return nil, errNotificationGetByID
+	}
+
+	if notification == nil {
+		return nil, errNotificationUnknown
+	}
+
+	return notification, nil
+}
+
+// openNotificationByID is notificationByID for notifications that must still be open, it returns
+// lmdatabase.ErrNotificationNotOpen for confirmed or cancelled notifications
+func openNotificationByID(store lmdatabase.Store, notificationID string) (*lmdatabase.Notification, error) {
+	notification, errNotification := notificationByID(store, notificationID)
+	if errNotification != nil {
+		return nil, errNotification
+	}
+
+	if notification.ConfirmedAt != -1 || notification.CancelledAt != -1 {
+		return nil, lmdatabase.ErrNotificationNotOpen
+	}
+
+	return notification, nil
+}
+
+// confirmOpenNotification confirms the open notification and returns it confirmed
+func confirmOpenNotification(store lmdatabase.Store, notificationID string, now int64, r *http.Request) (*lmdatabase.Notification, error) {
+	notification, errNotification := openNotificationByID(store, notificationID)
+	if errNotification != nil {
+		return nil, errNotification
+	}
+
+	rowsAffected, errConfirmNotification := confirmNotification(store, notification.NotificationID, now, r)
+	if errConfirmNotification != nil {
+		return nil, errConfirmNotification
+	}
+
+	// confirmed or cancelled concurrently
+	if rowsAffected == 0 {
+		return nil, lmdatabase.ErrNotificationNotOpen
+	}
+
+	return notificationByID(store, notificationID)
+}
+
+// cancelOpenNotification cancels the open notification and returns it cancelled
+func cancelOpenNotification(store lmdatabase.Store, notificationID string, now int64, r *http.Request) (*lmdatabase.Notification, error) {
+	notification, errNotification := openNotificationByID(store, notificationID)
+	if errNotification != nil {
+		return nil, errNotification
+	}
+
+	cancelled, errCancelNotification := cancelNotification(store, notification.Modality, notification.DepartmentID, now, r)
+	if errCancelNotification != nil {
+		return nil, errCancelNotification
+	}
+
+	// confirmed or cancelled concurrently
+	if cancelled == nil {
+		return nil, lmdatabase.ErrNotificationNotOpen
+	}
+
+	return notificationByID(store, notificationID)
+}
+
+// changeNotificationPriority changes the priority of the open notification, records the event and returns the
+// notification with its new priority
+func changeNotificationPriority(store lmdatabase.Store, notificationID string, priority int, now int64, r *http.Request) (*lmdatabase.Notification, error) {
+	notification, errChangePriority := store.NotificationChangePriority(notificationID, priority, now, clientAddress(r))
+	if errChangePriority != nil {
+		return nil, errChangePriority
+	}
+
+	if notification == nil {
+		return nil, errNotificationUnknown
+	}
+
+	return notification, nil
+}
@@ -2,19 +2,23 @@ package server
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 
 	rice "github.com/GeertJohan/go.rice"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/authentication"
 	"github.com/usb-radiology/light-messenger/src/configuration"
+	"github.com/usb-radiology/light-messenger/src/eventbus"
 	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+	"github.com/usb-radiology/light-messenger/src/statistics"
 )
 
 // globals ...
@@ -23,10 +27,16 @@ const (
 	templateCardID                 = "card"
 	templateRadiologieID           = "radiologie"
 	templateVisierungID            = "visierung"
+	templateEventsID               = "events"
+	templateUptimeID               = "uptime"
+	templateStatisticsID           = "statistics"
+	templateHistoryID              = "history"
+	templateLoginID                = "login"
 	HTMLHeaderContentType          = "content-type"
 	HTMLHeaderContentTypeValueJSON = "text/json; charset=utf-8"
 	HTMLHeaderContentTypeValueHTML = "text/html; charset=utf-8"
 	HTMLHeaderContentTypeValueText = "text/plain; charset=utf-8"
+	HTMLHeaderWorkstation          = "x-workstation"
 )
 
 var (
@@ -37,18 +47,38 @@ var (
 		2: "is-warning",
 		3: "is-info",
 	}
+	departments     = []string{"aod", "ctd", "msk", "nr", "nuk"}
+	modalities      = []string{"ct", "mr", "nuk"}
+	priorityNameMap = map[int]string{
+		1: "Hoch",
+		2: "Mittel",
+		3: "Tief",
+	}
+	eventNameMap = map[string]string{
+		lmdatabase.NotificationEventCreated:   "Erstellt",
+		lmdatabase.NotificationEventPriority:  "Priorität geändert",
+		lmdatabase.NotificationEventForwarded: "Weitergeleitet",
+		lmdatabase.NotificationEventCancelled: "Zurückgenommen",
+		lmdatabase.NotificationEventConfirmed: "Bestätigt",
+	}
+	dimensionNameMap = map[string]string{
+		statistics.GroupByDepartment: "Abteilung",
+		statistics.GroupByModality:   "Modalität",
+		statistics.GroupByPriority:   "Priorität",
+		statistics.GroupByHour:       "Stunde",
+	}
 )
 
 // InitServer ...
 func InitServer(initConfig *configuration.Configuration) *http.Server {
-	db, errDb := lmdatabase.GetDB(initConfig)
-	if errDb != nil {
-		log.Fatalf("%+v", errors.WithStack(errDb))
+	store, errStore := lmdatabase.GetStore(initConfig)
+	if errStore != nil {
+		log.Fatalf("%+v", errors.WithStack(errStore))
 		return nil
 	}
 
 	port := strconv.Itoa(initConfig.Server.HTTPPort)
-	r := getRouter(initConfig, db)
+	r := getRouter(initConfig, store)
 	server := &http.Server{Addr: ":" + port, Handler: r}
 	return server
 }
@@ -63,34 +93,70 @@ func Start(server *http.Server, port int) {
 	}
 }
 
-func getRouter(initConfig *configuration.Configuration, db *sql.DB) *mux.Router {
+func getRouter(initConfig *configuration.Configuration, store lmdatabase.Store) *mux.Router {
 
 	errCompileTemplates := compileTemplates()
 	if errCompileTemplates != nil {
 		log.Fatalf("%+v", errCompileTemplates)
 	}
 
+	// the pages are updated by the changes of notifications published on the bus
+	bus := eventbus.New()
+	store = eventbus.NewStore(store, bus)
+
+	authenticator, errAuthenticator := authentication.New(initConfig, store)
+	if errAuthenticator != nil {
+		log.Fatalf("%+v", errAuthenticator)
+	}
+
+	// the nonces of signed requests of the lights
+	nonces := authentication.NewNonces(signatureMaxAge(initConfig), time.Now())
+
 	r := mux.NewRouter()
 
 	// index
-	r.Handle("/", handler{db, initConfig, mainHandler})
+	r.Handle("/", handler{store, initConfig, mainHandler, authenticator, accessUser}).Methods(http.MethodGet)
+
+	// login
+	r.Handle("/login", handler{store, initConfig, loginHandler(authenticator), authenticator, accessPublic}).Methods(http.MethodGet)
+	r.Handle("/login", csrfProtect(handler{store, initConfig, loginHandler(authenticator), authenticator, accessPublic})).Methods(http.MethodPost)
+	r.Handle("/logout", csrfProtect(handler{store, initConfig, logoutHandler(authenticator), authenticator, accessPublic})).Methods(http.MethodPost)
 
 	// MTRA
-	r.Handle("/mtra/{modality}", handler{db, initConfig, visierungHandler})
+	r.Handle("/mtra/{modality}", handler{store, initConfig, visierungHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	r.Handle("/mtra/{modality}/events", handler{store, initConfig, visierungEventsHandler(bus), authenticator, accessUser}).Methods(http.MethodGet)
 
 	// Radiology
-	r.Handle("/radiologie/{department}", handler{db, initConfig, radiologieHandler})
+	r.Handle("/radiologie/{department}", handler{store, initConfig, radiologieHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	r.Handle("/radiologie/{department}/events", handler{store, initConfig, radiologieEventsHandler(bus), authenticator, accessUser}).Methods(http.MethodGet)
+
+	// Uptime
+	r.Handle("/uptime/{department}", handler{store, initConfig, uptimeHandler, authenticator, accessUser}).Methods(http.MethodGet)
+
+	// Statistics
+	r.Handle("/statistics", handler{store, initConfig, statisticsHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	r.Handle("/export", handler{store, initConfig, exportHandler, authenticator, accessUser}).Methods(http.MethodGet)
+
+	// History
+	r.Handle("/history", handler{store, initConfig, historyHandler, authenticator, accessUser}).Methods(http.MethodGet)
 
 	// arduino
-	r.Handle("/nce-rest/arduino-status/{department}-status", handler{db, initConfig, arduinoStatusHandler})
-	r.Handle("/nce-rest/arduino-status/{department}-open-notifications", handler{db, initConfig, openStatusHandler})
+	r.Handle("/nce-rest/arduino-status/{department}-status", handler{store, initConfig, arduinoStatusHandler(nonces), authenticator, accessPublic}).Methods(http.MethodGet)
+	r.Handle("/nce-rest/arduino-status/{department}-open-notifications", handler{store, initConfig, openStatusHandler(nonces), authenticator, accessPublic}).Methods(http.MethodGet)
+
+	// notifications, the actions of intercooler send the CSRF token of the pages
+	r.Handle("/modality/{modality}/department/{department}/prio/{priority}", csrfProtect(handler{store, initConfig, notificationCreateHandler, authenticator, accessMTRA})).Methods(http.MethodPost)
+	// needs to be registered before the confirm route which would match as well
+	r.Handle("/notification/{id}/events", handler{store, initConfig, notificationEventsHandler, authenticator, accessUser}).Methods(http.MethodGet)
+	r.Handle("/notification/{id}/forward/{department}", csrfProtect(handler{store, initConfig, notificationForwardHandler, authenticator, accessRadiologist})).Methods(http.MethodPost)
+	r.Handle("/notification/{department}/{id}", csrfProtect(handler{store, initConfig, notificationConfirmHandler, authenticator, accessRadiologist})).Methods(http.MethodDelete) // TODO: get rid of the department here?
+	r.Handle("/modality/{modality}/department/{department}/cancel", csrfProtect(handler{store, initConfig, notificationCancelHandler, authenticator, accessMTRA})).Methods(http.MethodPost)
 
-	// notifications
-	r.Handle("/modality/{modality}/department/{department}/prio/{priority}", handler{db, initConfig, notificationCreateHandler})
-	r.Handle("/notification/{department}/{id}", handler{db, initConfig, notificationConfirmHandler}) // TODO: get rid of the department here?
-	r.Handle("/modality/{modality}/department/{department}/cancel", handler{db, initConfig, notificationCancelHandler})
+	// api
+	r.Handle("/api/openapi.json", handler{store, initConfig, openAPIHandler, authenticator, accessPublic}).Methods(http.MethodGet)
+	registerAPIRoutes(r, initConfig, store, bus, authenticator)
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(box.HTTPBox())))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(box.HTTPBox()))).Methods(http.MethodGet)
 
 	return r
 }
@@ -116,38 +182,115 @@ func compileTemplates() error {
 		if err != nil {
 			return err
 		}
-		radiologieTpl, _ := template.New("radiologie").Parse(templateString)
+		radiologieTpl, errParse := template.New("radiologie").Parse(templateString)
+		if errParse != nil {
+			return errors.WithStack(errParse)
+		}
 		templates[templateRadiologieID] = radiologieTpl
 	}
 
+	funcMap := template.FuncMap{
+		"priorityMap": func(prio int) string {
+			return priorityMap[prio]
+		},
+		"priorityName": func(prio int) string {
+			return priorityNameMap[prio]
+		},
+		"toTime": func(now int64) string {
+			if now == -1 {
+				return ""
+			}
+			return time.Unix(now, 0).Format("2006-01-02 15:04:05")
+		},
+	}
+
 	{
-		funcMap := template.FuncMap{
-			"priorityMap": func(prio int) string {
-				return priorityMap[prio]
+		templateString, err := box.String("templates/visierung.html")
+		if err != nil {
+			return err
+		}
+
+		visierungTpl := template.Must(template.New("visierung.html").Funcs(funcMap).Parse(templateString))
+		templates[templateVisierungID] = visierungTpl
+	}
+
+	{
+		eventsFuncMap := template.FuncMap{
+			"eventName": func(eventType string) string {
+				return eventNameMap[eventType]
 			},
-			"priorityName": func(prio int) string {
-				priorityMap := map[int]string{
-					1: "Hoch",
-					2: "Mittel",
-					3: "Tief",
+			// event values are stored as strings, for priority changes they hold the priority number
+			"priorityValueName": func(value string) string {
+				prio, errConversion := strconv.Atoi(value)
+				if errConversion != nil {
+					return value
 				}
-				return priorityMap[prio]
+				return priorityNameMap[prio]
 			},
-			"toTime": func(now int64) string {
-				if now == -1 {
-					return ""
-				}
-				return time.Unix(now, 0).Format("2006-01-02 15:04:05")
+		}
+
+		templateString, err := box.String("templates/events.html")
+		if err != nil {
+			return err
+		}
+
+		eventsTpl := template.Must(template.New("events").Funcs(funcMap).Funcs(eventsFuncMap).Parse(templateString))
+		templates[templateEventsID] = eventsTpl
+	}
+
+	{
+		uptimeFuncMap := template.FuncMap{
+			"outageDuration": func(outage lmdatabase.DeviceOutage) string {
+				return (time.Duration(outage.EndedAt-outage.StartedAt) * time.Second).String()
 			},
 		}
 
-		templateString, err := box.String("templates/visierung.html")
+		templateString, err := box.String("templates/uptime.html")
 		if err != nil {
 			return err
 		}
 
-		visierungTpl := template.Must(template.New("visierung.html").Funcs(funcMap).Parse(templateString))
-		templates[templateVisierungID] = visierungTpl
+		uptimeTpl := template.Must(template.New("uptime").Funcs(funcMap).Funcs(uptimeFuncMap).Parse(templateString))
+		templates[templateUptimeID] = uptimeTpl
+	}
+
+	{
+		statisticsFuncMap := template.FuncMap{
+			"seconds": func(seconds int64) string {
+				return (time.Duration(seconds) * time.Second).String()
+			},
+			"dimensionName": func(dimension string) string {
+				return dimensionNameMap[dimension]
+			},
+		}
+
+		templateString, err := box.String("templates/statistics.html")
+		if err != nil {
+			return err
+		}
+
+		statisticsTpl := template.Must(template.New("statistics").Funcs(funcMap).Funcs(statisticsFuncMap).Parse(templateString))
+		templates[templateStatisticsID] = statisticsTpl
+	}
+
+	{
+		templateString, err := box.String("templates/history.html")
+		if err != nil {
+			return err
+		}
+
+		historyTpl := template.Must(template.New("history").Funcs(funcMap).Parse(templateString))
+		templates[templateHistoryID] = historyTpl
+	}
+
+	{
+		templateString, err := box.String("templates/login.html")
+		if err != nil {
+			return err
+		}
+
+		loginTpl := template.Must(template.New("login").Parse(templateString))
+		templates[templateLoginID] = loginTpl
 	}
 	return nil
 }
@@ -207,3 +350,30 @@ func writeJSON(w http.ResponseWriter, data map[string]interface{}) error {
 func writeBadRequest(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusBadRequest)
 }
+
+func writeConflict(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusConflict)
+}
+
+// clientAddress returns the host of the remote address without the port
+func clientAddress(r *http.Request) string {
+	host, _, errSplit := net.SplitHostPort(r.RemoteAddr)
+	if errSplit != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestedBy identifies who issued the request, i.e. the logged in user, the workstation identifier sent by the
+// client in the x-workstation header or else its address
+func requestedBy(r *http.Request) string {
+	if user := requestUser(r); user != nil {
+		return user.Username
+	}
+
+	workstation := strings.TrimSpace(r.Header.Get(HTMLHeaderWorkstation))
+	if workstation != "" {
+		return workstation
+	}
+	return clientAddress(r)
+}
@@ -1,7 +1,6 @@
 package server
 
 import (
-	"database/sql"
 	"net/http/httptest"
 	"path/filepath"
 	"testing"
@@ -13,13 +12,26 @@ import (
 
 var statements []string
 
-func setupTest(t *testing.T) (*httptest.Server, *sql.DB) {
+// setupTest runs the server against the database from config-sample.json, or against an in-memory store with `go test -short`
+func setupTest(t *testing.T) (*httptest.Server, lmdatabase.Store) {
+	return setupTestWithConfiguration(t, func(initConfig *configuration.Configuration) {})
+}
+
+// setupTestWithConfiguration is setupTest with config-sample.json changed by configure
+func setupTestWithConfiguration(t *testing.T, configure func(initConfig *configuration.Configuration)) (*httptest.Server, lmdatabase.Store) {
 
 	initConfig, err := configuration.LoadAndSetConfiguration(filepath.Join("..", "..", "config-sample.json"))
 	if err != nil {
 		t.Fatalf("%+v", errors.WithStack(err))
 	}
 
+	configure(initConfig)
+
+	if testing.Short() {
+		store := lmdatabase.NewMemoryStore()
+		return httptest.NewServer(getRouter(initConfig, store)), store
+	}
+
 	db, errDb := lmdatabase.GetDB(initConfig)
 	if errDb != nil {
 		t.Fatal(errDb)
@@ -48,13 +60,14 @@ func setupTest(t *testing.T) (*httptest.Server, *sql.DB) {
 		}
 	*/
 
-	router := getRouter(initConfig, db)
+	store := lmdatabase.NewSQLStore(db)
+	router := getRouter(initConfig, store)
 	ts := httptest.NewServer(router)
 
-	return ts, db
+	return ts, store
 }
 
-func tearDownTest(t *testing.T, server *httptest.Server, db *sql.DB) {
+func tearDownTest(t *testing.T, server *httptest.Server, store lmdatabase.Store) {
 	server.Close()
-	db.Close()
+	store.Close()
 }
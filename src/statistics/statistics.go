@@ -0,0 +1,158 @@
+// Package statistics computes how fast notifications are confirmed and how often they are cancelled
+package statistics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+// dimensions notifications can be grouped by
+const (
+	GroupByDepartment = "department"
+	GroupByModality   = "modality"
+	GroupByPriority   = "priority"
+	GroupByHour       = "hour"
+)
+
+// Dimensions are all dimensions notifications can be grouped by, in the order they are sorted by
+var Dimensions = []string{GroupByDepartment, GroupByModality, GroupByPriority, GroupByHour}
+
+// Group are the statistics of the notifications that share the values of the grouped dimensions. Dimensions that are
+// not grouped by are empty, i.e. "", a priority of 0 and an hour of -1. Times to confirm are in seconds.
+type Group struct {
+	Department string
+	Modality   string
+	Priority   int
+	Hour       int // hour of the day the notifications were created at
+
+	Count      int
+	Confirmed  int
+	Cancelled  int
+	Open       int
+	CancelRate float64 // cancelled notifications in percent of all notifications
+
+	ConfirmMedian int64
+	ConfirmP90    int64
+	ConfirmMax    int64
+}
+
+// ParseGroupBy parses the comma separated dimensions, it fails for unknown dimensions
+func ParseGroupBy(value string) ([]string, error) {
+	groupBy := make([]string, 0)
+	for _, dimension := range strings.Split(value, ",") {
+		dimension = strings.TrimSpace(dimension)
+		if dimension == "" {
+			continue
+		}
+		if !isDimension(dimension) {
+			return nil, errors.Errorf("unknown dimension %s", dimension)
+		}
+		groupBy = append(groupBy, dimension)
+	}
+	return groupBy, nil
+}
+
+func isDimension(value string) bool {
+	for _, dimension := range Dimensions {
+		if dimension == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Compute groups the notifications by the dimensions and returns the statistics of each group, sorted by department,
+// modality, priority and hour. The hour of day is taken in the location. Without dimensions there is a single group of
+// all notifications.
+func Compute(notifications []lmdatabase.Notification, groupBy []string, location *time.Location) []Group {
+	grouped := make(map[Group][]lmdatabase.Notification)
+
+	for _, notification := range notifications {
+		key := Group{Hour: -1}
+		for _, dimension := range groupBy {
+			switch dimension {
+			case GroupByDepartment:
+				key.Department = notification.DepartmentID
+			case GroupByModality:
+				key.Modality = notification.Modality
+			case GroupByPriority:
+				key.Priority = notification.Priority
+			case GroupByHour:
+				key.Hour = time.Unix(notification.CreatedAt, 0).In(location).Hour()
+			}
+		}
+		grouped[key] = append(grouped[key], notification)
+	}
+
+	if len(groupBy) == 0 && len(grouped) == 0 {
+		grouped[Group{Hour: -1}] = nil
+	}
+
+	groups := make([]Group, 0, len(grouped))
+	for key, groupNotifications := range grouped {
+		groups = append(groups, computeGroup(key, groupNotifications))
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Department != groups[j].Department {
+			return groups[i].Department < groups[j].Department
+		}
+		if groups[i].Modality != groups[j].Modality {
+			return groups[i].Modality < groups[j].Modality
+		}
+		if groups[i].Priority != groups[j].Priority {
+			return groups[i].Priority < groups[j].Priority
+		}
+		return groups[i].Hour < groups[j].Hour
+	})
+
+	return groups
+}
+
+func computeGroup(group Group, notifications []lmdatabase.Notification) Group {
+	timesToConfirm := make([]int64, 0, len(notifications))
+
+	for _, notification := range notifications {
+		group.Count++
+		switch {
+		case notification.ConfirmedAt != -1:
+			group.Confirmed++
+			timesToConfirm = append(timesToConfirm, notification.ConfirmedAt-notification.CreatedAt)
+		case notification.CancelledAt != -1:
+			group.Cancelled++
+		default:
+			group.Open++
+		}
+	}
+
+	if group.Count > 0 {
+		group.CancelRate = float64(group.Cancelled) * 100 / float64(group.Count)
+	}
+
+	sort.Slice(timesToConfirm, func(i, j int) bool {
+		return timesToConfirm[i] < timesToConfirm[j]
+	})
+
+	group.ConfirmMedian = percentile(timesToConfirm, 50)
+	group.ConfirmP90 = percentile(timesToConfirm, 90)
+	group.ConfirmMax = percentile(timesToConfirm, 100)
+
+	return group
+}
+
+// percentile returns the p-th percentile of the sorted values by the nearest-rank method, 0 without values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,85 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/usb-radiology/light-messenger/src/lmdatabase"
+)
+
+func notification(department string, modality string, priority int, createdAt int64, confirmedAt int64, cancelledAt int64) lmdatabase.Notification {
+	return lmdatabase.Notification{
+		DepartmentID: department,
+		Modality:     modality,
+		Priority:     priority,
+		CreatedAt:    createdAt,
+		ConfirmedAt:  confirmedAt,
+		CancelledAt:  cancelledAt,
+	}
+}
+
+func TestUnitShouldComputeTimesToConfirmAndCancelRatePerGroup(t *testing.T) {
+
+	// given
+	notifications := []lmdatabase.Notification{
+		notification("msk", "ct", 1, 0, 30, -1),
+		notification("msk", "ct", 1, 100, 110, -1),
+		notification("msk", "mr", 1, 200, 300, -1),
+		notification("msk", "ct", 1, 300, 320, -1),
+		notification("msk", "ct", 1, 400, -1, 450),
+		notification("msk", "ct", 2, 500, 1100, -1),
+		notification("nr", "ct", 1, 600, -1, -1),
+	}
+
+	// when
+	groups := Compute(notifications, []string{GroupByDepartment, GroupByPriority}, time.UTC)
+
+	// then
+	assert.Equal(t, []Group{
+		{Department: "msk", Priority: 1, Hour: -1, Count: 5, Confirmed: 4, Cancelled: 1, CancelRate: 20, ConfirmMedian: 20, ConfirmP90: 100, ConfirmMax: 100},
+		{Department: "msk", Priority: 2, Hour: -1, Count: 1, Confirmed: 1, ConfirmMedian: 600, ConfirmP90: 600, ConfirmMax: 600},
+		{Department: "nr", Priority: 1, Hour: -1, Count: 1, Open: 1},
+	}, groups)
+}
+
+func TestUnitShouldGroupByHourOfDayInLocation(t *testing.T) {
+
+	// given
+	location := time.FixedZone("UTC+1", 3600)
+	notifications := []lmdatabase.Notification{
+		notification("msk", "ct", 1, 7*3600+59*60, 8*3600, -1),
+		notification("nr", "mr", 2, 8*3600, 8*3600+60, -1),
+	}
+
+	// when
+	groups := Compute(notifications, []string{GroupByHour}, location)
+
+	// then
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, 8, groups[0].Hour)
+	assert.Equal(t, int64(60), groups[0].ConfirmMax)
+	assert.Equal(t, 9, groups[1].Hour)
+	assert.Empty(t, groups[1].Department)
+}
+
+func TestUnitShouldReturnSingleGroupWithoutDimensions(t *testing.T) {
+
+	// when
+	groups := Compute([]lmdatabase.Notification{}, []string{}, time.UTC)
+
+	// then
+	assert.Equal(t, []Group{{Hour: -1}}, groups)
+}
+
+func TestUnitShouldParseGroupBy(t *testing.T) {
+
+	// when
+	groupBy, errParse := ParseGroupBy("department, hour,")
+	_, errParseUnknown := ParseGroupBy("department,room")
+
+	// then
+	assert.Nil(t, errParse)
+	assert.Equal(t, []string{GroupByDepartment, GroupByHour}, groupBy)
+	assert.NotNil(t, errParseUnknown)
+}